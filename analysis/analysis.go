@@ -0,0 +1,179 @@
+// Package analysis computes confidence intervals over sim statistics,
+// either across independent replications or, with batch means, within a
+// single long run.
+package analysis
+
+import (
+    "fmt"
+    "io"
+    "math"
+    "slices"
+    "strings"
+    "github.com/nidoro/sim"
+    "gonum.org/v1/gonum/stat"
+    "gonum.org/v1/gonum/stat/distuv"
+)
+
+const DefaultConfidence = 0.95
+
+// Interval is a confidence interval for the mean of a set of samples.
+type Interval struct {
+    Mean        float64
+    HalfWidth   float64
+    StdDev      float64
+    Min         float64
+    Max         float64
+    N           int
+    Confidence  float64
+}
+
+func (interval Interval) GetLow() float64 {
+    return interval.Mean - interval.HalfWidth
+}
+
+func (interval Interval) GetHigh() float64 {
+    return interval.Mean + interval.HalfWidth
+}
+
+func (interval Interval) Contains(x float64) bool {
+    return x >= interval.GetLow() && x <= interval.GetHigh()
+}
+
+func (interval Interval) String() string {
+    return fmt.Sprintf("%.4g ± %.4g", interval.Mean, interval.HalfWidth)
+}
+
+// GetTQuantile returns the two-sided Student's t critical value for the
+// given confidence and degrees of freedom.
+func GetTQuantile(confidence float64, dof int) float64 {
+    t := distuv.StudentsT{Mu: 0, Sigma: 1, Nu: float64(dof)}
+    return t.Quantile(1 - (1 - confidence)/2)
+}
+
+// NewInterval computes the t confidence interval of the mean of samples.
+// With less than two samples the half-width is +Inf.
+func NewInterval(samples []float64, confidence float64) Interval {
+    interval := Interval{N: len(samples), Confidence: confidence, HalfWidth: math.Inf(1)}
+    if len(samples) == 0 {
+        interval.Mean = math.NaN()
+        return interval
+    }
+    
+    interval.Min = slices.Min(samples)
+    interval.Max = slices.Max(samples)
+    
+    if len(samples) == 1 {
+        interval.Mean = samples[0]
+        return interval
+    }
+    
+    interval.Mean, interval.StdDev = stat.MeanStdDev(samples, nil)
+    interval.HalfWidth = GetTQuantile(confidence, len(samples)-1) * interval.StdDev / math.Sqrt(float64(len(samples)))
+    return interval
+}
+
+// BatchMeans computes a confidence interval for the steady-state mean of a
+// statistic of a single run, treating the means of n batches as independent
+// samples. Returns false if the statistic does not have enough batches yet.
+func BatchMeans(st sim.Batched, n int, confidence float64) (Interval, bool) {
+    means := st.GetBatchMeans(n)
+    if means == nil {
+        return Interval{}, false
+    }
+    return NewInterval(means, confidence), true
+}
+
+// SummarizeRun computes batch means intervals for every tally and
+// time-persistent statistic of a single run. Statistics without enough
+// batches are left out.
+func SummarizeRun(env *sim.Environment, n int, confidence float64) *Summary {
+    summary := &Summary{Confidence: confidence, Replications: 1, Intervals: make(map[string]Interval)}
+    
+    for key, st := range env.GetBatchedStatistics() {
+        if interval, ok := BatchMeans(st, n, confidence); ok {
+            summary.Intervals[key] = interval
+        }
+    }
+    
+    return summary
+}
+
+// GetLag1Correlation returns the lag-1 autocorrelation of a series, like
+// batch means. Values far from zero suggest the batches are too small to
+// be treated as independent.
+func GetLag1Correlation(x []float64) float64 {
+    if len(x) < 3 {
+        return math.NaN()
+    }
+    return stat.Correlation(x[:len(x)-1], x[1:], nil)
+}
+
+// Summary holds a confidence interval for each statistic of a set of
+// replications.
+type Summary struct {
+    Confidence      float64
+    Replications    int
+    Intervals       map[string]Interval
+}
+
+// Summarize computes a confidence interval across replications for every
+// statistic in their results.
+func Summarize(all []*sim.Results, confidence float64) *Summary {
+    summary := &Summary{Confidence: confidence, Replications: len(all), Intervals: make(map[string]Interval)}
+    samples := make(map[string][]float64)
+    
+    for _, results := range all {
+        for key, value := range results.Values {
+            samples[key] = append(samples[key], value)
+        }
+    }
+    
+    for key, values := range samples {
+        summary.Intervals[key] = NewInterval(values, confidence)
+    }
+    
+    return summary
+}
+
+func (summary *Summary) Get(kind string, id string, statistic string) Interval {
+    return summary.Intervals[sim.GetResultsKey(kind, id, statistic)]
+}
+
+func (summary *Summary) GetKeys() []string {
+    keys := make([]string, 0, len(summary.Intervals))
+    for key, _ := range summary.Intervals {
+        keys = append(keys, key)
+    }
+    slices.Sort(keys)
+    return keys
+}
+
+// Print prints the statistics whose keys contain any of filters, or all of
+// them if no filter is given.
+func (summary *Summary) Print(filters ...string) {
+    fmt.Printf("[SUMMARY] Replications: %d | Confidence: %.0f%%\n", summary.Replications, summary.Confidence*100)
+    fmt.Printf("%64s%14s%14s%14s%14s%14s\n", "Statistic", "Mean", "Half Width", "Std Dev", "Min", "Max")
+    
+    for _, key := range summary.GetKeys() {
+        if len(filters) > 0 && !slices.ContainsFunc(filters, func (filter string) bool { return strings.Contains(key, filter) }) {
+            continue
+        }
+        
+        in := summary.Intervals[key]
+        fmt.Printf("%64.64s%14.4g%14.4g%14.4g%14.4g%14.4g\n", key, in.Mean, in.HalfWidth, in.StdDev, in.Min, in.Max)
+    }
+}
+
+func (summary *Summary) WriteTSV(w io.Writer) error {
+    if _, err := fmt.Fprintf(w, "Statistic\tMean\tHalfWidth\tStdDev\tMin\tMax\tN\n"); err != nil {
+        return err
+    }
+    
+    for _, key := range summary.GetKeys() {
+        in := summary.Intervals[key]
+        if _, err := fmt.Fprintf(w, "%s\t%g\t%g\t%g\t%g\t%g\t%d\n", key, in.Mean, in.HalfWidth, in.StdDev, in.Min, in.Max, in.N); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,155 @@
+package analysis
+
+import (
+    "math"
+    "testing"
+    "github.com/nidoro/sim"
+)
+
+func IsClose(a float64, b float64, tolerance float64) bool {
+    return math.Abs(a - b) <= tolerance * max(1, math.Abs(a), math.Abs(b))
+}
+
+func TestGetTQuantile(t *testing.T) {
+    // from tables of Student's t distribution
+    tests := []struct {
+        confidence  float64
+        dof         int
+        want        float64
+    }{
+        {0.95, 1, 12.7062},
+        {0.95, 4, 2.7764},
+        {0.95, 9, 2.2622},
+        {0.95, 30, 2.0423},
+        {0.90, 9, 1.8331},
+        {0.99, 9, 3.2498},
+    }
+    
+    for _, test := range tests {
+        got := GetTQuantile(test.confidence, test.dof)
+        if !IsClose(got, test.want, 1e-4) {
+            t.Errorf("GetTQuantile(%g, %d): got %g, want %g", test.confidence, test.dof, got, test.want)
+        }
+    }
+}
+
+func TestNewInterval(t *testing.T) {
+    tests := []struct {
+        name        string
+        samples     []float64
+        confidence  float64
+        mean        float64
+        halfWidth   float64
+    }{
+        {"empty", []float64{}, 0.95, math.NaN(), math.Inf(1)},
+        {"one", []float64{4}, 0.95, 4, math.Inf(1)},
+        {"constant", []float64{2, 2, 2}, 0.95, 2, 0},
+        // s = sqrt(2.5), t(0.975, 4) = 2.7764
+        {"five", []float64{1, 2, 3, 4, 5}, 0.95, 3, 2.7764 * math.Sqrt(2.5) / math.Sqrt(5)},
+        // s = sqrt(8/3), t(0.95, 3) = 2.3534
+        {"four 90%", []float64{10, 12, 14, 12}, 0.90, 12, 2.3534 * math.Sqrt(8.0/3) / 2},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            interval := NewInterval(test.samples, test.confidence)
+            
+            if interval.N != len(test.samples) {
+                t.Errorf("n: got %d, want %d", interval.N, len(test.samples))
+            }
+            if math.IsNaN(test.mean) != math.IsNaN(interval.Mean) || !math.IsNaN(test.mean) && !IsClose(interval.Mean, test.mean, 1e-9) {
+                t.Errorf("mean: got %g, want %g", interval.Mean, test.mean)
+            }
+            if math.IsInf(test.halfWidth, 1) != math.IsInf(interval.HalfWidth, 1) || !math.IsInf(test.halfWidth, 1) && !IsClose(interval.HalfWidth, test.halfWidth, 1e-4) {
+                t.Errorf("half width: got %g, want %g", interval.HalfWidth, test.halfWidth)
+            }
+        })
+    }
+}
+
+// Intervals of the mean of normal samples cover it about as often as their
+// confidence says.
+func TestNewIntervalCoverage(t *testing.T) {
+    rng := sim.NewRNGNormal(10, 3)
+    rng.Seed(1)
+    
+    for _, confidence := range []float64{0.90, 0.95} {
+        covered := 0
+        trials := 2000
+        for i := 0; i < trials; i++ {
+            samples := make([]float64, 8)
+            for j := range samples {
+                samples[j] = rng.Next()
+            }
+            if NewInterval(samples, confidence).Contains(10) {
+                covered++
+            }
+        }
+        
+        coverage := float64(covered) / float64(trials)
+        if math.Abs(coverage - confidence) > 0.02 {
+            t.Errorf("coverage at %g: got %g", confidence, coverage)
+        }
+    }
+}
+
+func TestBatchMeans(t *testing.T) {
+    tests := []struct {
+        name        string
+        count       int
+        n           int
+        ok          bool
+    }{
+        {"enough", 100, 10, true},
+        {"merged", 5000, 20, true},
+        {"not enough", 9, 10, false},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            var tally sim.Tally
+            for i := 0; i < test.count; i++ {
+                tally.Record(float64(i % 7))
+            }
+            
+            interval, ok := BatchMeans(&tally, test.n, 0.95)
+            if ok != test.ok {
+                t.Fatalf("ok: got %v, want %v", ok, test.ok)
+            }
+            if !ok {
+                return
+            }
+            
+            want := NewInterval(tally.GetBatchMeans(test.n), 0.95)
+            if interval.N != test.n || !IsClose(interval.Mean, want.Mean, 1e-12) || !IsClose(interval.HalfWidth, want.HalfWidth, 1e-12) {
+                t.Errorf("got %v (n %d), want %v (n %d)", interval, interval.N, want, test.n)
+            }
+            if !interval.Contains(3) {
+                t.Errorf("%v does not contain the mean 3", interval)
+            }
+        })
+    }
+}
+
+func TestSummarize(t *testing.T) {
+    all := make([]*sim.Results, 0)
+    for _, value := range []float64{1, 2, 3, 4, 5} {
+        results := &sim.Results{Values: make(map[string]float64)}
+        results.Set("Process", "P", "EntitiesOut", value)
+        results.Set("Resource", "R", "Utilization", 0.5)
+        all = append(all, results)
+    }
+    
+    summary := Summarize(all, 0.95)
+    if summary.Replications != 5 {
+        t.Errorf("replications: got %d, want 5", summary.Replications)
+    }
+    
+    want := NewInterval([]float64{1, 2, 3, 4, 5}, 0.95)
+    if got := summary.Get("Process", "P", "EntitiesOut"); got != want {
+        t.Errorf("got %v, want %v", got, want)
+    }
+    if got := summary.Get("Resource", "R", "Utilization"); got.Mean != 0.5 || got.HalfWidth != 0 {
+        t.Errorf("got %v, want 0.5 ± 0", got)
+    }
+}
@@ -0,0 +1,583 @@
+// Package anim animates a simulation on a layout in a window, with ebiten.
+// Entities are drawn in the stations they are in and move along the paths
+// of the layout when they go from one station to another. The simulation
+// runs as the animation plays, in real time or faster.
+package anim
+
+import (
+    "fmt"
+    "hash/fnv"
+    "image/color"
+    "math"
+    
+    "github.com/nidoro/sim"
+    "github.com/nidoro/sim/render"
+    
+    "github.com/hajimehoshi/ebiten/v2"
+    "github.com/hajimehoshi/ebiten/v2/ebitenutil"
+    "github.com/hajimehoshi/ebiten/v2/inpututil"
+    "github.com/hajimehoshi/ebiten/v2/text"
+    "github.com/hajimehoshi/ebiten/v2/vector"
+    
+    "golang.org/x/image/font"
+    "golang.org/x/image/font/basicfont"
+)
+
+// Track is where an entity is drawn. An entity that changes stations
+// follows Route, taking TransitTime real seconds.
+type Track struct {
+    Entity      sim.Entity
+    Station     string
+    Position    sim.LayoutPoint
+    Route       []sim.LayoutPoint // nil if not moving
+    Elapsed     float64
+    Seen        bool
+}
+
+// Animation is an ebiten.Game that runs and draws an environment. Date is
+// the simulated time shown, which advances by TimeScale simulated seconds
+// per real second; 1 is real time. Pictures are drawn for entities of each
+// type instead of the colored squares of Style. Plan is the layout drawn,
+// named so as not to clash with ebiten's Layout method.
+type Animation struct {
+    Env             *sim.Environment
+    Plan            *sim.Layout
+    Style           render.Style
+    Face            font.Face
+    Pictures        map[string]*ebiten.Image
+    TimeScale       float64
+    Paused          bool
+    TransitTime     float64
+    Camera          *Camera
+    Canvas          *ebiten.Image
+    Date            float64
+    Started         bool // env.Begin was called
+    Ended           bool
+    Selected        *sim.LayoutNode
+    Tracks          map[int]*Track
+}
+
+func NewAnimation(env *sim.Environment, layout *sim.Layout) *Animation {
+    style := render.DefaultStyle
+    style.EntitySize = 8
+    
+    return &Animation{
+        Env: env,
+        Plan: layout,
+        Style: style,
+        Face: basicfont.Face7x13,
+        Pictures: make(map[string]*ebiten.Image),
+        TimeScale: 1,
+        TransitTime: 0.5,
+        Camera: NewCamera(float64(layout.Width), float64(layout.Height)),
+        Tracks: make(map[int]*Track),
+    }
+}
+
+// SetPicture sets the image drawn for entities of a type, scaled to the
+// entity size of the style.
+func (animation *Animation) SetPicture(entityType string, picture *ebiten.Image) {
+    animation.Pictures[entityType] = picture
+}
+
+// LoadPicture loads the image drawn for entities of a type from a file.
+func (animation *Animation) LoadPicture(entityType string, path string) error {
+    picture, _, err := ebitenutil.NewImageFromFile(path)
+    if err != nil {
+        return err
+    }
+    animation.SetPicture(entityType, picture)
+    return nil
+}
+
+// Run opens a window and plays the animation until it is closed.
+func (animation *Animation) Run(title string) error {
+    ebiten.SetWindowTitle(title)
+    ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
+    return ebiten.RunGame(animation)
+}
+
+func (animation *Animation) GetEntityColor(entity sim.Entity) color.RGBA {
+    hash := fnv.New32a()
+    hash.Write([]byte(entity.GetType()))
+    colors := animation.Style.EntityColors
+    return colors[int(hash.Sum32() % uint32(len(colors)))]
+}
+
+func (animation *Animation) GetLineHeight() float64 {
+    return float64(animation.Face.Metrics().Height.Ceil())
+}
+
+// DrawText draws text with its top-left corner at x, y.
+func (animation *Animation) DrawText(dst *ebiten.Image, x float64, y float64, str string) {
+    text.Draw(dst, str, animation.Face, int(x), int(y) + animation.Face.Metrics().Ascent.Ceil(), animation.Style.Text)
+}
+
+// GetSlot returns the center of the i-th entity drawn in a box, in rows, or
+// false if it doesn't fit.
+func (animation *Animation) GetSlot(i int, x0 float64, y0 float64, x1 float64, y1 float64) (sim.LayoutPoint, bool) {
+    size := float64(animation.Style.EntitySize)
+    step := size + 2
+    perRow := max(1, int((x1 - x0) / step))
+    rows := max(1, int((y1 - y0) / step))
+    if i >= perRow * rows {
+        return sim.LayoutPoint{}, false
+    }
+    return sim.LayoutPoint{X: x0 + float64(i % perRow) * step + size/2, Y: y0 + float64(i / perRow) * step + size/2}, true
+}
+
+// GetStationSlots returns where each entity in a process or hold is drawn:
+// the entities in process on the first line and the queue below, like in
+// the renderer.
+func (animation *Animation) GetStationSlots(node *sim.LayoutNode, active []sim.Entity, queue []sim.Entity, slots map[int]sim.LayoutPoint) {
+    line := animation.GetLineHeight()
+    step := float64(animation.Style.EntitySize + 2)
+    x0, x1 := node.X + 4, node.X + node.Width - 4
+    top := node.Y + 4 + 2*line
+    
+    for i, entity := range active {
+        if slot, ok := animation.GetSlot(i, x0, top, x1, top + step); ok {
+            slots[entity.GetId()] = slot
+        }
+    }
+    
+    for i, entity := range queue {
+        if slot, ok := animation.GetSlot(i, x0, top + step + 4, x1, node.Y + node.Height - 4); ok {
+            slots[entity.GetId()] = slot
+        }
+    }
+}
+
+// GetStationEntities returns the entities in each station of the layout and
+// in process in each process.
+func (animation *Animation) GetStationEntities() (map[string][]sim.Entity, map[string][]sim.Entity) {
+    env := animation.Env
+    active := make(map[string][]sim.Entity)
+    for _, ongoing := range env.OngoingProcesses {
+        active[ongoing.Process.GetId()] = append(active[ongoing.Process.GetId()], ongoing.Entity)
+    }
+    
+    queues := make(map[string][]sim.Entity)
+    for _, node := range animation.Plan.Nodes {
+        if node.Kind == sim.LayoutKind_Process {
+            if process := env.GetProcess(node.Id); process != nil {
+                queues[node.Id] = process.GetProcessBase().Queue
+            }
+        } else if node.Kind == sim.LayoutKind_Hold {
+            if hold := env.GetHold(node.Id); hold != nil {
+                queues[node.Id] = hold.Queue
+            }
+        } else if node.Kind == sim.LayoutKind_Conveyor {
+            if conveyor := env.GetConveyor(node.Id); conveyor != nil {
+                queues[node.Id] = conveyor.Queue
+            }
+        }
+    }
+    return active, queues
+}
+
+// GetRoutePosition returns the point at a fraction of the length of a route.
+func GetRoutePosition(route []sim.LayoutPoint, f float64) sim.LayoutPoint {
+    if len(route) == 0 {
+        return sim.LayoutPoint{}
+    }
+    
+    total := 0.0
+    for i := 1; i < len(route); i++ {
+        total += math.Hypot(route[i].X - route[i-1].X, route[i].Y - route[i-1].Y)
+    }
+    
+    distance := max(0, min(1, f)) * total
+    for i := 1; i < len(route); i++ {
+        length := math.Hypot(route[i].X - route[i-1].X, route[i].Y - route[i-1].Y)
+        if distance <= length && length > 0 {
+            g := distance / length
+            return sim.LayoutPoint{X: route[i-1].X + (route[i].X - route[i-1].X) * g, Y: route[i-1].Y + (route[i].Y - route[i-1].Y) * g}
+        }
+        distance -= length
+    }
+    return route[len(route)-1]
+}
+
+// UpdateTracks moves the entities drawn towards the stations they are in,
+// dt real seconds after the last update. Entities that left the stations
+// of the layout are no longer drawn.
+func (animation *Animation) UpdateTracks(dt float64) {
+    active, queues := animation.GetStationEntities()
+    slots := make(map[int]sim.LayoutPoint)
+    stations := make(map[int]string)
+    entities := make(map[int]sim.Entity)
+    for _, node := range animation.Plan.Nodes {
+        if node.Kind == sim.LayoutKind_Process || node.Kind == sim.LayoutKind_Hold {
+            animation.GetStationSlots(node, active[node.Id], queues[node.Id], slots)
+        } else if node.Kind == sim.LayoutKind_Conveyor {
+            belt := animation.GetBeltTop(node)
+            top := belt + float64(animation.Style.EntitySize) + 8
+            for i, entity := range queues[node.Id] {
+                if slot, ok := animation.GetSlot(i, node.X + 4, top, node.X + node.Width - 4, node.Y + node.Height - 4); ok {
+                    slots[entity.GetId()] = slot
+                }
+            }
+            
+            // items are drawn by their front, along the belt
+            if conveyor := animation.Env.GetConveyor(node.Id); conveyor != nil && conveyor.Length > 0 {
+                for _, item := range conveyor.Items {
+                    x := node.X + 4 + item.Position / conveyor.Length * (node.Width - 8)
+                    slots[item.Entity.GetId()] = sim.LayoutPoint{X: x - float64(animation.Style.EntitySize)/2, Y: belt + float64(animation.Style.EntitySize)/2 + 2}
+                    active[node.Id] = append(active[node.Id], item.Entity)
+                }
+            }
+        }
+        
+        for _, entity := range active[node.Id] {
+            stations[entity.GetId()] = node.Id
+            entities[entity.GetId()] = entity
+        }
+        for _, entity := range queues[node.Id] {
+            stations[entity.GetId()] = node.Id
+            entities[entity.GetId()] = entity
+        }
+    }
+    
+    for _, track := range animation.Tracks {
+        track.Seen = false
+    }
+    
+    for id, station := range stations {
+        slot, ok := slots[id]
+        if !ok {
+            // entities that don't fit wait at the center of the station
+            slot, _ = animation.Plan.GetLocation(station)
+        }
+        
+        track, ok := animation.Tracks[id]
+        if !ok {
+            track = &Track{Entity: entities[id], Station: station, Position: slot}
+            animation.Tracks[id] = track
+        }
+        track.Seen = true
+        
+        if track.Station != station {
+            track.Route = animation.Plan.GetRoute(track.Station, station)
+            if len(track.Route) == 0 {
+                track.Route = []sim.LayoutPoint{track.Position, slot}
+            }
+            track.Route[0] = track.Position
+            track.Station = station
+            track.Elapsed = 0
+        }
+        
+        if track.Route != nil {
+            track.Route[len(track.Route)-1] = slot
+            track.Elapsed += dt
+            if track.Elapsed >= animation.TransitTime {
+                track.Route = nil
+            } else {
+                track.Position = GetRoutePosition(track.Route, track.Elapsed / animation.TransitTime)
+                continue
+            }
+        }
+        track.Position = slot
+    }
+    
+    for id, track := range animation.Tracks {
+        if !track.Seen {
+            delete(animation.Tracks, id)
+        }
+    }
+}
+
+func (animation *Animation) GetBeltTop(node *sim.LayoutNode) float64 {
+    return node.Y + animation.GetLineHeight() + 6
+}
+
+// Advance moves the animation dt real seconds forward, running the
+// environment up to the new date.
+func (animation *Animation) Advance(dt float64) {
+    env := animation.Env
+    if !animation.Started {
+        env.Begin()
+        animation.Date = env.Now
+        animation.Started = true
+    }
+    
+    if !animation.Paused && !animation.Ended {
+        animation.Date += dt * animation.TimeScale
+        if env.EndDate > 0 {
+            animation.Date = min(animation.Date, env.EndDate)
+        }
+        
+        // state changes at env.Now are only applied by the next step
+        for env.Now <= animation.Date {
+            if !env.Advance() {
+                animation.Ended = true
+                break
+            }
+        }
+    }
+    
+    animation.UpdateTracks(dt)
+}
+
+// GetNodeAt returns the node of the layout at a point of the canvas.
+func (animation *Animation) GetNodeAt(x float64, y float64) *sim.LayoutNode {
+    for _, node := range animation.Plan.Nodes {
+        if x >= node.X && x < node.X + node.Width && y >= node.Y && y < node.Y + node.Height {
+            return node
+        }
+    }
+    return nil
+}
+
+// Update handles the controls: space pauses, ] and [ double and halve the
+// time scale and clicking a station shows its statistics.
+func (animation *Animation) Update() error {
+    if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+        animation.Paused = !animation.Paused
+    }
+    
+    if inpututil.IsKeyJustPressed(ebiten.KeyBracketRight) {
+        animation.TimeScale *= 2
+    }
+    
+    if inpututil.IsKeyJustPressed(ebiten.KeyBracketLeft) {
+        animation.TimeScale /= 2
+    }
+    
+    animation.Camera.Update()
+    if inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) && !animation.Camera.Dragged {
+        animation.Selected = animation.GetNodeAt(animation.Camera.GetCursorCanvasPosition())
+    }
+    
+    animation.Advance(1 / float64(ebiten.TPS()))
+    return nil
+}
+
+// GetStatistics returns the lines shown for a selected node.
+func (animation *Animation) GetStatistics(node *sim.LayoutNode) []string {
+    env := animation.Env
+    lines := []string{node.GetLabel()}
+    queueLines := func (queue int, st sim.QueueStatistics) []string {
+        return []string{
+            fmt.Sprintf("Queue: %d", queue),
+            fmt.Sprintf("Entities in: %d", st.TotalEntitiesIn),
+            fmt.Sprintf("Entities out: %d", st.TotalEntitiesOut),
+            fmt.Sprintf("Avg queue length: %.2f", st.QueueLength.GetMean(env.Now)),
+            fmt.Sprintf("Avg time in queue: %s", sim.GetHumanTime(st.TimeInQueue.GetMean())),
+            fmt.Sprintf("Max time in queue: %s", sim.GetHumanTime(st.TimeInQueue.Max)),
+        }
+    }
+    
+    if node.Kind == sim.LayoutKind_Process {
+        if process := env.GetProcess(node.Id); process != nil {
+            base := process.GetProcessBase()
+            lines = append(lines, queueLines(len(base.Queue), base.GetStatistics())...)
+            lines = append(lines, fmt.Sprintf("Processed: %d", base.TotalEntitiesOut))
+            lines = append(lines, fmt.Sprintf("Avg duration: %s", sim.GetHumanTime(base.Durations.GetMean())))
+        }
+    } else if node.Kind == sim.LayoutKind_Hold {
+        if hold := env.GetHold(node.Id); hold != nil {
+            lines = append(lines, queueLines(len(hold.Queue), hold.GetStatistics())...)
+        }
+    } else if node.Kind == sim.LayoutKind_Conveyor {
+        if conveyor := env.GetConveyor(node.Id); conveyor != nil {
+            lines = append(lines, queueLines(len(conveyor.Queue), conveyor.GetStatistics())...)
+            lines = append(lines, fmt.Sprintf("Items: %d", len(conveyor.Items)))
+            lines = append(lines, fmt.Sprintf("Utilization: %.1f%%", 100 * conveyor.GetUtilization()))
+        }
+    } else if node.Kind == sim.LayoutKind_Resource {
+        if resource, ok := env.Resources[node.Id]; ok {
+            base := resource.GetResourceBase()
+            lines = append(lines, fmt.Sprintf("Amount: %g/%g", base.Amount, base.Capacity))
+            lines = append(lines, fmt.Sprintf("Queue: %d", len(base.Queue)))
+            lines = append(lines, fmt.Sprintf("Utilization: %.1f%%", 100 * base.GetUtilization(env.Now)))
+        }
+    }
+    return lines
+}
+
+// DrawEntity draws an entity centered at a point, as its picture if it has
+// one.
+func (animation *Animation) DrawEntity(dst *ebiten.Image, entity sim.Entity, point sim.LayoutPoint) {
+    size := float64(animation.Style.EntitySize)
+    if picture, ok := animation.Pictures[entity.GetType()]; ok {
+        bounds := picture.Bounds()
+        scale := size / float64(max(bounds.Dx(), bounds.Dy()))
+        op := &ebiten.DrawImageOptions{}
+        op.GeoM.Scale(scale, scale)
+        op.GeoM.Translate(point.X - float64(bounds.Dx()) * scale / 2, point.Y - float64(bounds.Dy()) * scale / 2)
+        op.Filter = ebiten.FilterLinear
+        dst.DrawImage(picture, op)
+        return
+    }
+    
+    vector.DrawFilledRect(dst, float32(point.X - size/2), float32(point.Y - size/2), float32(size), float32(size), animation.GetEntityColor(entity), false)
+}
+
+// DrawPaths draws the paths of the layout as lines.
+func (animation *Animation) DrawPaths(dst *ebiten.Image) {
+    for _, path := range animation.Plan.Paths {
+        route := animation.Plan.GetRoute(path.From, path.To)
+        for i := 1; i < len(route); i++ {
+            vector.StrokeLine(dst, float32(route[i-1].X), float32(route[i-1].Y), float32(route[i].X), float32(route[i].Y), 2, animation.Style.Node, true)
+        }
+    }
+}
+
+func (animation *Animation) DrawNode(dst *ebiten.Image, node *sim.LayoutNode) {
+    env := animation.Env
+    x, y := float32(node.X), float32(node.Y)
+    width, height := float32(node.Width), float32(node.Height)
+    vector.DrawFilledRect(dst, x, y, width, height, animation.Style.Node, false)
+    
+    border := animation.Style.Border
+    if node.Kind == sim.LayoutKind_Hold {
+        border = animation.Style.HoldBorder
+    }
+    if node == animation.Selected {
+        border = animation.Style.Text
+    }
+    vector.StrokeRect(dst, x, y, width, height, 1, border, false)
+    
+    line := animation.GetLineHeight()
+    if node.Kind == sim.LayoutKind_Resource {
+        resource, ok := env.Resources[node.Id]
+        if !ok {
+            return
+        }
+        
+        base := resource.GetResourceBase()
+        animation.DrawText(dst, node.X + 4, node.Y + 2, fmt.Sprintf("%s  %g/%g", node.GetLabel(), base.Amount, base.Capacity))
+        capacity := math.Ceil(base.Capacity)
+        top, bottom := node.Y + line + 4, node.Y + node.Height - 4
+        if capacity <= 0 || bottom <= top {
+            return
+        }
+        
+        busy := math.Ceil(base.Capacity - base.Amount)
+        cell := (node.Width - 8) / capacity
+        for u := 0.0; u < capacity; u++ {
+            c := animation.Style.Idle
+            if u < busy {
+                c = animation.Style.Busy
+            }
+            vector.DrawFilledRect(dst, float32(node.X + 4 + u * cell), float32(top), float32(max(1, cell - 1)), float32(bottom - top), c, false)
+        }
+        return
+    }
+    
+    animation.DrawText(dst, node.X + 4, node.Y + 2, node.GetLabel())
+    if node.Kind == sim.LayoutKind_Conveyor {
+        belt := animation.GetBeltTop(node)
+        vector.DrawFilledRect(dst, float32(node.X + 4), float32(belt), float32(node.Width - 8), float32(animation.Style.EntitySize + 4), animation.Style.Background, false)
+    } else {
+        animation.DrawText(dst, node.X + 4, node.Y + 2 + line, animation.GetCountLabel(node))
+    }
+}
+
+func (animation *Animation) GetCountLabel(node *sim.LayoutNode) string {
+    queue, active := 0, 0
+    if node.Kind == sim.LayoutKind_Process {
+        if process := animation.Env.GetProcess(node.Id); process != nil {
+            queue = len(process.GetProcessBase().Queue)
+        }
+        for _, ongoing := range animation.Env.OngoingProcesses {
+            if ongoing.Process.GetId() == node.Id {
+                active++
+            }
+        }
+    } else if hold := animation.Env.GetHold(node.Id); hold != nil {
+        queue = len(hold.Queue)
+    }
+    return fmt.Sprintf("active %d  queue %d", active, queue)
+}
+
+func (animation *Animation) DrawTransporters(dst *ebiten.Image) {
+    size := float64(animation.Style.EntitySize + 4)
+    for _, transporter := range animation.Env.Transporters {
+        for _, vehicle := range transporter.Vehicles {
+            point, ok := animation.Plan.GetVehiclePosition(vehicle, animation.Date)
+            if !ok {
+                continue
+            }
+            
+            c := animation.Style.VehicleEmpty
+            if vehicle.Status == sim.VehicleStatus_MovingLoaded {
+                c = animation.Style.VehicleLoaded
+            }
+            
+            // vehicles at the same place are spread by index
+            x := point.X - size/2 + float64(vehicle.Index % 4) * 2
+            y := point.Y - size/2 + float64(vehicle.Index % 4) * 2
+            vector.DrawFilledRect(dst, float32(x), float32(y), float32(size), float32(size), c, false)
+            vector.StrokeRect(dst, float32(x), float32(y), float32(size), float32(size), 1, animation.Style.Background, false)
+        }
+    }
+}
+
+// DrawStatus draws the date, the time scale and the statistics of the
+// selected station on the screen.
+func (animation *Animation) DrawStatus(screen *ebiten.Image) {
+    status := fmt.Sprintf("%s  x%g", animation.Env.GetHumanTime(animation.Date), animation.TimeScale)
+    if animation.Ended {
+        status += "  ended"
+    } else if animation.Paused {
+        status += "  paused"
+    }
+    ebitenutil.DebugPrintAt(screen, status, 4, 4)
+    ebitenutil.DebugPrintAt(screen, "space: pause  [ ]: speed  home: fit  click: statistics", 4, 20)
+    
+    if animation.Selected == nil {
+        return
+    }
+    
+    lines := animation.GetStatistics(animation.Selected)
+    width, height := 0, 16 * len(lines) + 8
+    for _, line := range lines {
+        width = max(width, 6 * len(line) + 8)
+    }
+    
+    x := screen.Bounds().Dx() - width - 4
+    vector.DrawFilledRect(screen, float32(x), 4, float32(width), float32(height), animation.Style.Node, false)
+    vector.StrokeRect(screen, float32(x), 4, float32(width), float32(height), 1, animation.Style.Border, false)
+    for i, line := range lines {
+        ebitenutil.DebugPrintAt(screen, line, x + 4, 8 + 16*i)
+    }
+}
+
+func (animation *Animation) Draw(screen *ebiten.Image) {
+    if animation.Canvas == nil {
+        animation.Canvas = ebiten.NewImage(animation.Plan.Width, animation.Plan.Height)
+    }
+    
+    canvas := animation.Canvas
+    canvas.Fill(animation.Style.Background)
+    animation.DrawPaths(canvas)
+    for _, node := range animation.Plan.Nodes {
+        animation.DrawNode(canvas, node)
+    }
+    
+    for _, track := range animation.Tracks {
+        animation.DrawEntity(canvas, track.Entity, track.Position)
+    }
+    animation.DrawTransporters(canvas)
+    
+    screen.Fill(animation.Style.Background)
+    op := &ebiten.DrawImageOptions{}
+    op.GeoM = animation.Camera.GetGeoM()
+    op.Filter = ebiten.FilterLinear
+    screen.DrawImage(canvas, op)
+    
+    animation.DrawStatus(screen)
+}
+
+// Layout makes the screen the size of the window. The camera is fit to the
+// canvas the first time.
+func (animation *Animation) Layout(outsideWidth int, outsideHeight int) (int, int) {
+    fit := animation.Camera.ScreenWidth == 0
+    animation.Camera.SetScreenSize(float64(outsideWidth), float64(outsideHeight))
+    if fit {
+        animation.Camera.Fit()
+    }
+    return outsideWidth, outsideHeight
+}
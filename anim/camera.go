@@ -0,0 +1,166 @@
+package anim
+
+import (
+    "github.com/hajimehoshi/ebiten/v2"
+    "github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// Camera is the part of the canvas shown on the screen. X and Y are the
+// canvas point at the top-left corner of the screen and Scale the screen
+// pixels per canvas pixel. It is moved with the arrow keys or by dragging,
+// and zoomed with ctrl+= and ctrl+- or the mouse wheel.
+type Camera struct {
+    X               float64
+    Y               float64
+    Scale           float64
+    MinScale        float64
+    MaxScale        float64
+    ScreenWidth     float64
+    ScreenHeight    float64
+    CanvasWidth     float64
+    CanvasHeight    float64
+    
+    IsDragging          bool
+    Dragged             bool // the cursor moved since the button was pressed
+    DragCursorStartX    float64
+    DragCursorStartY    float64
+    DragCameraStartX    float64
+    DragCameraStartY    float64
+}
+
+func NewCamera(canvasWidth float64, canvasHeight float64) *Camera {
+    return &Camera{
+        Scale: 1,
+        MinScale: 0.1,
+        MaxScale: 8,
+        CanvasWidth: canvasWidth,
+        CanvasHeight: canvasHeight,
+    }
+}
+
+func (camera *Camera) SetScreenSize(width float64, height float64) {
+    camera.ScreenWidth = width
+    camera.ScreenHeight = height
+}
+
+// Fit zooms to show the whole canvas, centered on the screen.
+func (camera *Camera) Fit() {
+    if camera.ScreenWidth <= 0 || camera.ScreenHeight <= 0 {
+        return
+    }
+    
+    camera.Scale = min(camera.ScreenWidth / camera.CanvasWidth, camera.ScreenHeight / camera.CanvasHeight)
+    camera.Scale = max(camera.MinScale, min(camera.MaxScale, camera.Scale))
+    camera.X = (camera.CanvasWidth - camera.ScreenWidth / camera.Scale) / 2
+    camera.Y = (camera.CanvasHeight - camera.ScreenHeight / camera.Scale) / 2
+}
+
+// ToCanvas converts a point on the screen to the canvas.
+func (camera *Camera) ToCanvas(x float64, y float64) (float64, float64) {
+    return camera.X + x / camera.Scale, camera.Y + y / camera.Scale
+}
+
+func (camera *Camera) GetCursorCanvasPosition() (float64, float64) {
+    x, y := ebiten.CursorPosition()
+    return camera.ToCanvas(float64(x), float64(y))
+}
+
+// ZoomAt multiplies the scale by factor, keeping the canvas point under the
+// screen point x, y in place.
+func (camera *Camera) ZoomAt(factor float64, x float64, y float64) {
+    canx, cany := camera.ToCanvas(x, y)
+    camera.Scale = max(camera.MinScale, min(camera.MaxScale, camera.Scale * factor))
+    camera.X = canx - x / camera.Scale
+    camera.Y = cany - y / camera.Scale
+}
+
+// Clamp keeps the camera over the canvas. A canvas smaller than the screen
+// is centered.
+func (camera *Camera) Clamp() {
+    width := camera.ScreenWidth / camera.Scale
+    height := camera.ScreenHeight / camera.Scale
+    
+    if width >= camera.CanvasWidth {
+        camera.X = (camera.CanvasWidth - width) / 2
+    } else {
+        camera.X = max(0, min(camera.CanvasWidth - width, camera.X))
+    }
+    
+    if height >= camera.CanvasHeight {
+        camera.Y = (camera.CanvasHeight - height) / 2
+    } else {
+        camera.Y = max(0, min(camera.CanvasHeight - height, camera.Y))
+    }
+}
+
+func (camera *Camera) Update() {
+    step := 0.02 / camera.Scale
+    if ebiten.IsKeyPressed(ebiten.KeyArrowRight) {
+        camera.X += step * camera.ScreenWidth
+    }
+    
+    if ebiten.IsKeyPressed(ebiten.KeyArrowLeft) {
+        camera.X -= step * camera.ScreenWidth
+    }
+    
+    if ebiten.IsKeyPressed(ebiten.KeyArrowUp) {
+        camera.Y -= step * camera.ScreenHeight
+    }
+    
+    if ebiten.IsKeyPressed(ebiten.KeyArrowDown) {
+        camera.Y += step * camera.ScreenHeight
+    }
+    
+    if ebiten.IsKeyPressed(ebiten.KeyControl) && ebiten.IsKeyPressed(ebiten.KeyEqual) {
+        camera.ZoomAt(1.02, camera.ScreenWidth/2, camera.ScreenHeight/2)
+    }
+    
+    if ebiten.IsKeyPressed(ebiten.KeyControl) && ebiten.IsKeyPressed(ebiten.KeyMinus) {
+        camera.ZoomAt(0.98, camera.ScreenWidth/2, camera.ScreenHeight/2)
+    }
+    
+    if inpututil.IsKeyJustPressed(ebiten.KeyHome) {
+        camera.Fit()
+    }
+    
+    cursorX, cursorY := ebiten.CursorPosition()
+    if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+        camera.IsDragging = true
+        camera.Dragged = false
+        camera.DragCursorStartX = float64(cursorX)
+        camera.DragCursorStartY = float64(cursorY)
+        camera.DragCameraStartX = camera.X
+        camera.DragCameraStartY = camera.Y
+    }
+    
+    if inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
+        camera.IsDragging = false
+    }
+    
+    if camera.IsDragging {
+        dx := camera.DragCursorStartX - float64(cursorX)
+        dy := camera.DragCursorStartY - float64(cursorY)
+        if dx*dx + dy*dy > 9 {
+            camera.Dragged = true
+        }
+        camera.X = camera.DragCameraStartX + dx / camera.Scale
+        camera.Y = camera.DragCameraStartY + dy / camera.Scale
+    }
+    
+    _, wheelDeltaY := ebiten.Wheel()
+    if wheelDeltaY > 0 {
+        camera.ZoomAt(1.1, float64(cursorX), float64(cursorY))
+    } else if wheelDeltaY < 0 {
+        camera.ZoomAt(1/1.1, float64(cursorX), float64(cursorY))
+    }
+    
+    camera.Clamp()
+}
+
+// GetGeoM returns the transform from the canvas to the screen.
+func (camera *Camera) GetGeoM() ebiten.GeoM {
+    geom := ebiten.GeoM{}
+    geom.Translate(-camera.X, -camera.Y)
+    geom.Scale(camera.Scale, camera.Scale)
+    return geom
+}
@@ -0,0 +1,73 @@
+package sim
+
+import (
+    "time"
+)
+
+// Simulation time is kept in seconds since env.StartTime. The calendar
+// functions below map it to real dates in the location of StartTime, so
+// months have their actual lengths, leap years are handled and daylight
+// saving time shifts are honored. If StartTime is not set, the simulation
+// starts at 0001-01-01 00:00:00 UTC, which is a Monday in a non-leap year.
+
+// GetDate returns the calendar time s seconds after the start.
+func (env *Environment) GetDate(s float64) time.Time {
+    return env.StartTime.Add(time.Duration(s * float64(time.Second)))
+}
+
+// GetSeconds returns the simulation time of a calendar time.
+func (env *Environment) GetSeconds(t time.Time) float64 {
+    return t.Sub(env.StartTime).Seconds()
+}
+
+func (env *Environment) GetCurrentDate() time.Time {
+    return env.GetDate(env.Now)
+}
+
+func (env *Environment) GetCurrentYear() int {
+    return env.GetCurrentDate().Year()
+}
+
+// GetCurrentMonth returns the current month, from 0 (January) to 11.
+func (env *Environment) GetCurrentMonth() int {
+    return int(env.GetCurrentDate().Month()) - 1
+}
+
+// GetCurrentDay returns the current day of the month, from 1 to 31.
+func (env *Environment) GetCurrentDay() int {
+    return env.GetCurrentDate().Day()
+}
+
+func (env *Environment) GetCurrentWeekday() time.Weekday {
+    return env.GetCurrentDate().Weekday()
+}
+
+// GetCurrentHour returns the current hour of the day, from 0 to 23.
+func (env *Environment) GetCurrentHour() int {
+    return env.GetCurrentDate().Hour()
+}
+
+// GetMonthStart returns the simulation time at the first second of the
+// given month (0 to 11) of the given year.
+func (env *Environment) GetMonthStart(year int, month int) float64 {
+    return env.GetSeconds(time.Date(year, time.Month(month+1), 1, 0, 0, 0, 0, env.StartTime.Location()))
+}
+
+// GetDaysInMonth returns the number of days in the given month (0 to 11) of
+// the given year.
+func GetDaysInMonth(year int, month int) int {
+    return time.Date(year, time.Month(month+2), 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func IsLeapYear(year int) bool {
+    return GetDaysInMonth(year, 1) == 29
+}
+
+// GetHumanTime formats s as a calendar date if StartTime is set, or as the
+// time elapsed since the start otherwise.
+func (env *Environment) GetHumanTime(s float64) string {
+    if env.StartTime.IsZero() {
+        return GetHumanTime(s)
+    }
+    return env.GetDate(s).Format("2006-01-02 Mon 15:04:05.00 MST")
+}
@@ -0,0 +1,285 @@
+package sim
+
+import (
+    "fmt"
+    "log/slog"
+    "slices"
+)
+
+// EntityTypeStatistics are the statistics of the entities of a type, over
+// their lives from AddEntity to Dispose. Wait time is the time spent in
+// process queues, holds and transporter and conveyor queues; process time
+// is the time in processes; transfer time is the time riding transporters
+// and conveyors and in processes marked Transfer.
+type EntityTypeStatistics struct {
+    Created     int
+    Disposed    int
+    WIP         TimePersistent
+    WaitTime    Tally
+    ProcessTime Tally
+    TransferTime Tally
+    SystemTime  Tally
+    Costs       Costs // accrued by all entities of the type
+    EntityCost  Tally // total cost of each disposed entity
+}
+
+func (st *EntityTypeStatistics) Reset(date float64) {
+    st.Created = 0
+    st.Disposed = 0
+    st.WIP.Reset(date)
+    st.WaitTime.Reset()
+    st.ProcessTime.Reset()
+    st.TransferTime.Reset()
+    st.SystemTime.Reset()
+    st.Costs = Costs{}
+    st.EntityCost.Reset()
+}
+
+// ProcessTypeStatistics are the statistics of a process for the entities
+// of one type.
+type ProcessTypeStatistics struct {
+    EntitiesOut int
+    TimeInQueue Tally
+    Duration    Tally
+}
+
+func (env *Environment) GetEntityTypeStatistics(entityType string) *EntityTypeStatistics {
+    st, ok := env.EntityTypes[entityType]
+    if !ok {
+        st = &EntityTypeStatistics{}
+        st.WIP.Reset(env.StatisticsStart)
+        env.EntityTypes[entityType] = st
+    }
+    return st
+}
+
+// RecordCreate updates the statistics of the type of an entity added to
+// the environment.
+func (env *Environment) RecordCreate(entity Entity) {
+    st := env.GetEntityTypeStatistics(entity.GetType())
+    st.Created++
+    st.WIP.Update(env.Now, st.WIP.Value + 1)
+}
+
+// Dispose ends the life of an entity, recording its times in the
+// statistics of its type and removing it from env.Entities. Entities
+// leaving a process, hold or conveyor with nowhere to go next are disposed;
+// models that end the life of entities otherwise should call it.
+func (env *Environment) Dispose(entity Entity) {
+    base := entity.GetEntityBase()
+    if base.Disposed {
+        return
+    }
+    base.Disposed = true
+    
+    st := env.GetEntityTypeStatistics(base.Type)
+    st.Disposed++
+    st.WIP.Update(env.Now, max(0, st.WIP.Value - 1))
+    st.WaitTime.Record(base.WaitTime)
+    st.ProcessTime.Record(base.ProcessTime)
+    st.TransferTime.Record(base.TransferTime)
+    st.SystemTime.Record(env.Now - base.DateCreated)
+    st.EntityCost.Record(base.Costs.GetTotal())
+    delete(env.Entities, base.Id)
+    
+    if env.IsLogging(slog.LevelDebug, LogComponent_Run) {
+        env.Debug(LogComponent_Run, "DISPOSED", "entity", entity)
+    }
+    if env.Tracer != nil {
+        env.Trace(TraceRecord{Type: TraceType_Dispose, Entity: entity.GetName()})
+    }
+}
+
+// RecordProcessEnd updates the statistics of a process by entity type and
+// the times of the entity, when the entity finishes the process.
+func (env *Environment) RecordProcessEnd(process Process, entity Entity) {
+    base := process.GetProcessBase()
+    duration := entity.GetProcessDuration()
+    allocation := base.GetAllocation()
+    env.AddEntityTime(entity.GetEntityBase(), allocation, duration)
+    for rid, amount := range process.GetNeeds() {
+        resource := env.Resources[rid].GetResourceBase()
+        env.AddEntityCost(entity.GetEntityBase(), allocation, amount * duration * resource.BusyCost / Hours(1))
+    }
+    
+    if base.TypeStats == nil {
+        base.TypeStats = make(map[string]*ProcessTypeStatistics)
+    }
+    
+    st, ok := base.TypeStats[entity.GetType()]
+    if !ok {
+        st = &ProcessTypeStatistics{}
+        base.TypeStats[entity.GetType()] = st
+    }
+    st.EntitiesOut++
+    st.TimeInQueue.Record(entity.GetTimeInQueue())
+    st.Duration.Record(duration)
+}
+
+// GetGroups returns the groups of the processes of the environment.
+func (env *Environment) GetGroups() []string {
+    groups := make([]string, 0)
+    for _, process := range env.Processes {
+        for _, group := range process.GetProcessBase().Groups {
+            if !slices.Contains(groups, group) {
+                groups = append(groups, group)
+            }
+        }
+    }
+    slices.Sort(groups)
+    return groups
+}
+
+func (env *Environment) GetEntityTypes() []string {
+    return GetSortedKeys(env.EntityTypes)
+}
+
+// GroupStatistics aggregate the processes of a group. Times in queue and
+// durations are averaged over entities rather than processes, and WIP is
+// the number of entities waiting for or in the processes of the group.
+type GroupStatistics struct {
+    Id              string
+    Processes       int
+    EntitiesIn      int
+    EntitiesOut     int
+    AvgTimeInQueue  float64
+    AvgDuration     float64
+    WIP             int
+    AvgWIP          float64
+}
+
+func (env *Environment) GetGroupStatistics(group string) GroupStatistics {
+    st := GroupStatistics{Id: group}
+    elapsed := env.Now - env.StatisticsStart
+    timeInQueue := 0.0
+    queued := 0
+    duration := 0.0
+    
+    for _, process := range env.Processes {
+        base := process.GetProcessBase()
+        if !slices.Contains(base.Groups, group) {
+            continue
+        }
+        
+        st.Processes++
+        st.EntitiesIn += base.QueueStats.TotalEntitiesIn
+        st.EntitiesOut += base.TotalEntitiesOut
+        timeInQueue += base.QueueStats.TimeInQueue.GetSum()
+        queued += base.QueueStats.TimeInQueue.Count
+        duration += base.AccumDuration
+        st.WIP += process.GetQueueSize()
+        st.AvgWIP += base.QueueStats.QueueLength.GetMean(env.Now)
+        if elapsed > 0 {
+            st.AvgWIP += base.AccumDuration / elapsed
+        }
+    }
+    
+    for _, ongoing := range env.OngoingProcesses {
+        if slices.Contains(ongoing.Process.GetProcessBase().Groups, group) {
+            st.WIP++
+        }
+    }
+    
+    if queued > 0 {
+        st.AvgTimeInQueue = timeInQueue / float64(queued)
+    }
+    if st.EntitiesOut > 0 {
+        st.AvgDuration = duration / float64(st.EntitiesOut)
+    }
+    return st
+}
+
+// GetGroupTypeStatistics returns the statistics of the processes of a group
+// for the entities of a type.
+func (env *Environment) GetGroupTypeStatistics(group string, entityType string) ProcessTypeStatistics {
+    st := ProcessTypeStatistics{}
+    for _, process := range env.Processes {
+        base := process.GetProcessBase()
+        typeStats, ok := base.TypeStats[entityType]
+        if !ok || !slices.Contains(base.Groups, group) {
+            continue
+        }
+        
+        st.EntitiesOut += typeStats.EntitiesOut
+        st.TimeInQueue.Merge(&typeStats.TimeInQueue)
+        st.Duration.Merge(&typeStats.Duration)
+    }
+    return st
+}
+
+func (results *Results) SetCategories(env *Environment) {
+    for _, group := range env.GetGroups() {
+        st := env.GetGroupStatistics(group)
+        results.Set("Group", group, "EntitiesIn", float64(st.EntitiesIn))
+        results.Set("Group", group, "EntitiesOut", float64(st.EntitiesOut))
+        results.Set("Group", group, "AvgTimeInQueue", st.AvgTimeInQueue)
+        results.Set("Group", group, "AvgDuration", st.AvgDuration)
+        results.Set("Group", group, "WIP", float64(st.WIP))
+        results.Set("Group", group, "AvgWIP", st.AvgWIP)
+        
+        for _, entityType := range env.GetEntityTypes() {
+            typeStats := env.GetGroupTypeStatistics(group, entityType)
+            if typeStats.EntitiesOut == 0 {
+                continue
+            }
+            id := fmt.Sprintf("%s:%s", group, entityType)
+            results.Set("GroupType", id, "EntitiesOut", float64(typeStats.EntitiesOut))
+            results.Set("GroupType", id, "AvgTimeInQueue", typeStats.TimeInQueue.GetMean())
+            results.Set("GroupType", id, "AvgDuration", typeStats.Duration.GetMean())
+        }
+    }
+    
+    for entityType, st := range env.EntityTypes {
+        results.Set("EntityType", entityType, "Created", float64(st.Created))
+        results.Set("EntityType", entityType, "Disposed", float64(st.Disposed))
+        results.SetTimePersistent("EntityType", entityType, "WIP", &st.WIP, env.Now)
+        results.SetTally("EntityType", entityType, "WaitTime", &st.WaitTime)
+        results.SetTally("EntityType", entityType, "ProcessTime", &st.ProcessTime)
+        results.SetTally("EntityType", entityType, "TransferTime", &st.TransferTime)
+        results.SetTally("EntityType", entityType, "SystemTime", &st.SystemTime)
+    }
+}
+
+func (env *Environment) PrintGroupsStatistics() {
+    fmt.Printf("[GROUP STATISTICS]\n")
+    
+    fmt.Printf("%24s%12s%16s%16s%16s%18s%12s%12s\n", "Group", "Processes", "Entities In", "Entities Out", "Avg Q Time (s)", "Avg Duration (s)", "WIP", "Avg WIP")
+    
+    for _, group := range env.GetGroups() {
+        st := env.GetGroupStatistics(group)
+        fmt.Printf("%24.24s%12d%16d%16d%16.2f%18.2f%12d%12.2f\n", group, st.Processes, st.EntitiesIn, st.EntitiesOut, st.AvgTimeInQueue, st.AvgDuration, st.WIP, st.AvgWIP)
+    }
+}
+
+func (env *Environment) PrintEntityTypesStatistics() {
+    fmt.Printf("[ENTITY TYPE STATISTICS]\n")
+    
+    fmt.Printf("%24s%12s%12s%12s%16s%16s%16s%16s\n", "Entity Type", "Created", "Disposed", "Avg WIP", "Avg Wait (s)", "Avg Process (s)", "Avg Transfer (s)", "Avg System (s)")
+    
+    for _, entityType := range env.GetEntityTypes() {
+        st := env.EntityTypes[entityType]
+        fmt.Printf("%24.24s%12d%12d%12.2f%16.2f%16.2f%16.2f%16.2f\n", entityType, st.Created, st.Disposed, st.WIP.GetMean(env.Now), st.WaitTime.GetMean(), st.ProcessTime.GetMean(), st.TransferTime.GetMean(), st.SystemTime.GetMean())
+    }
+}
+
+// PrintGroupTypeStatistics prints the throughput and average time in queue
+// of each group for each entity type, with a column per entity type.
+func (env *Environment) PrintGroupTypeStatistics() {
+    types := env.GetEntityTypes()
+    
+    fmt.Printf("[GROUP BY ENTITY TYPE] Entities Out | Avg Q Time (s)\n")
+    fmt.Printf("%24s", "Group")
+    for _, entityType := range types {
+        fmt.Printf("%24.24s", entityType)
+    }
+    fmt.Println()
+    
+    for _, group := range env.GetGroups() {
+        fmt.Printf("%24.24s", group)
+        for _, entityType := range types {
+            st := env.GetGroupTypeStatistics(group, entityType)
+            fmt.Printf("%24.24s", fmt.Sprintf("%d | %.2f", st.EntitiesOut, st.TimeInQueue.GetMean()))
+        }
+        fmt.Println()
+    }
+}
@@ -0,0 +1,424 @@
+package sim
+
+import (
+    "fmt"
+    "log"
+    "math"
+    "slices"
+)
+
+const (
+    EventType_ConveyorUpdate string = "ConveyorUpdate"
+)
+
+const conveyorEpsilon = 1e-9
+
+// Load can be implemented by entities that carry a bulk quantity, like a lot
+// of grain. On a conveyor with CellCapacity > 0, they occupy as many cells
+// as needed to hold their load.
+type Load interface {
+    GetLoad() float64
+}
+
+type ConveyorItem struct {
+    Entity      Entity
+    Size        float64
+    Position    float64 // of the item's front, from the entrance
+    DateIn      float64
+}
+
+// ConveyorBase moves entities from its entrance to its exit at a constant
+// speed. Each entity takes one cell of the belt, or more if it carries a
+// Load. Entities wait at the entrance until there is room for them.
+//
+// A non-accumulating conveyor stops as a whole when the entity at its exit
+// cannot leave, while an accumulating one keeps moving the other entities
+// until they pile up behind it. Exits are only blocked when the next
+// station is a conveyor without room at its entrance.
+type ConveyorBase struct {
+    Id              string
+    Groups          []string
+    Length          float64
+    Speed           float64
+    CellSize        float64
+    CellCapacity    float64
+    Accumulating    bool
+    NextProcess     string
+    Forward         func (entity Entity)
+    Env             *Environment
+    
+    // Simulation
+    Queue           []Entity
+    Items           []*ConveyorItem
+    Blocked         bool
+    LastUpdate      float64
+    NextUpdate      float64
+    Waiting         []*ConveyorBase // upstream conveyors blocked by this one
+    updating        bool
+    
+    // Statistics
+    QueueStats      QueueStatistics
+    TotalEntitiesOut int
+    TotalLoadOut    float64
+    AccumTransitTime float64
+    AvgTransitTime  float64
+    OccupiedTime    float64
+    BlockedTime     float64
+    BlockedSince    float64
+    Blockages       int
+    ResetDate       float64 // statistics start
+}
+
+func (conveyor *ConveyorBase) GetId() string {
+    return conveyor.Id
+}
+
+func (conveyor *ConveyorBase) GetQueueSize() int {
+    return len(conveyor.Queue)
+}
+
+func (conveyor *ConveyorBase) GetStatistics() QueueStatistics {
+    return conveyor.QueueStats
+}
+
+func (conveyor *ConveyorBase) GetNumCells() int {
+    return int(math.Floor(conveyor.Length / conveyor.CellSize))
+}
+
+func (conveyor *ConveyorBase) GetItemSize(entity Entity) float64 {
+    cells := 1.0
+    if load, ok := entity.(Load); ok && conveyor.CellCapacity > 0 {
+        cells = max(1, math.Ceil(load.GetLoad() / conveyor.CellCapacity))
+    }
+    return cells * conveyor.CellSize
+}
+
+func (conveyor *ConveyorBase) GetOccupiedLength() float64 {
+    occupied := 0.0
+    for _, item := range conveyor.Items {
+        occupied += item.Size
+    }
+    return occupied
+}
+
+// GetEntranceSpace returns how much of the belt is free at the entrance.
+func (conveyor *ConveyorBase) GetEntranceSpace() float64 {
+    if len(conveyor.Items) == 0 {
+        return conveyor.Length
+    }
+    last := conveyor.Items[len(conveyor.Items)-1]
+    return last.Position - last.Size
+}
+
+// CanAccept tells whether the entity would get on the belt right away.
+func (conveyor *ConveyorBase) CanAccept(entity Entity) bool {
+    conveyor.Update()
+    return len(conveyor.Queue) == 0 && conveyor.GetEntranceSpace() + conveyorEpsilon >= conveyor.GetItemSize(entity)
+}
+
+func (conveyor *ConveyorBase) Receive(entity Entity) {
+    env := conveyor.Env
+    conveyor.Update()
+    
+    if conveyor.GetItemSize(entity) > conveyor.Length {
+        log.Fatalf("Entity does not fit in conveyor: %s | %s", conveyor.Id, entity.GetName())
+    }
+    
+    conveyor.Queue = append(conveyor.Queue, entity)
+    conveyor.QueueStats.RecordIn(env.Now, len(conveyor.Queue))
+    entity.EnterQueue(QueueType_Conveyor, conveyor.Id, env.Now)
+    env.NotifyChange(conveyor.Id)
+    
+    if env.Tracer != nil {
+        env.Trace(TraceRecord{Type: TraceType_Convey, Entity: entity.GetName(), Id: conveyor.Id, Queue: len(conveyor.Queue)})
+    }
+    
+    if env.Debugger != nil {
+        env.Debugger.OnEnter(entity, conveyor.Id, len(conveyor.Queue))
+    }
+    
+    conveyor.Update()
+}
+
+// IsMoving tells whether the i-th item on the belt is moving.
+func (conveyor *ConveyorBase) IsMoving(i int) bool {
+    if !conveyor.Accumulating {
+        return !conveyor.Blocked
+    }
+    
+    for ; i >= 0; i-- {
+        item := conveyor.Items[i]
+        if i == 0 {
+            return !(conveyor.Blocked && item.Position >= conveyor.Length - conveyorEpsilon)
+        }
+        
+        ahead := conveyor.Items[i-1]
+        if item.Position < ahead.Position - ahead.Size - conveyorEpsilon {
+            return true
+        }
+    }
+    return true
+}
+
+// Update brings the belt up to the current time: it moves the items, lets
+// them leave and enter, and schedules the next time something happens.
+func (conveyor *ConveyorBase) Update() {
+    if conveyor.updating {
+        return
+    }
+    conveyor.updating = true
+    defer func() { conveyor.updating = false }()
+    
+    env := conveyor.Env
+    dt := env.Now - conveyor.LastUpdate
+    
+    conveyor.OccupiedTime += dt * conveyor.GetOccupiedLength() / conveyor.Length
+    if conveyor.Blocked {
+        conveyor.BlockedTime += dt
+    }
+    
+    if dt > 0 {
+        conveyor.MoveItems(dt)
+    }
+    conveyor.LastUpdate = env.Now
+    
+    for len(conveyor.Items) > 0 && conveyor.Items[0].Position >= conveyor.Length - conveyorEpsilon {
+        if !conveyor.Exit() {
+            break
+        }
+    }
+    
+    for len(conveyor.Queue) > 0 {
+        entity := conveyor.Queue[0]
+        size := conveyor.GetItemSize(entity)
+        
+        if conveyor.GetEntranceSpace() + conveyorEpsilon < size {
+            break
+        }
+        
+        conveyor.Queue = conveyor.Queue[1:]
+        entity.LeaveQueue(QueueType_Conveyor, conveyor.Id, env.Now)
+        st := entity.GetEntityBase().GetQueueStats(QueueType_Conveyor, conveyor.Id)
+        conveyor.QueueStats.RecordOut(env.Now, len(conveyor.Queue), st.DateOut - st.DateIn)
+        
+        conveyor.Items = append(conveyor.Items, &ConveyorItem{Entity: entity, Size: size, Position: size, DateIn: env.Now})
+        env.Debug(LogComponent_Conveyor, "CONVEYOR ENTERED", "conveyor", conveyor.Id, "entity", entity)
+        env.NotifyChange(conveyor.Id)
+        
+        if env.Tracer != nil {
+            env.Trace(TraceRecord{Type: TraceType_Board, Entity: entity.GetName(), Id: conveyor.Id, Queue: len(conveyor.Queue)})
+        }
+    }
+    
+    conveyor.ScheduleNextUpdate()
+    
+    if len(conveyor.Waiting) > 0 && len(conveyor.Queue) == 0 {
+        waiting := conveyor.Waiting
+        conveyor.Waiting = nil
+        conveyor.updating = false
+        for _, upstream := range waiting {
+            upstream.Update()
+        }
+    }
+}
+
+func (conveyor *ConveyorBase) MoveItems(dt float64) {
+    distance := conveyor.Speed * dt
+    
+    if !conveyor.Accumulating {
+        if conveyor.Blocked {
+            return
+        }
+        for _, item := range conveyor.Items {
+            item.Position = min(item.Position + distance, conveyor.Length)
+        }
+        return
+    }
+    
+    for i, item := range conveyor.Items {
+        limit := conveyor.Length
+        if i > 0 {
+            ahead := conveyor.Items[i-1]
+            limit = ahead.Position - ahead.Size
+        }
+        item.Position = max(item.Position, min(item.Position + distance, limit))
+    }
+}
+
+// Exit tries to send the item at the exit forward. Returns false if the
+// next station is a conveyor that can't take it yet.
+func (conveyor *ConveyorBase) Exit() bool {
+    env := conveyor.Env
+    item := conveyor.Items[0]
+    
+    if conveyor.Forward == nil && conveyor.NextProcess != "" {
+        if next, ok := env.Stations[conveyor.NextProcess].(*ConveyorBase); ok && !next.CanAccept(item.Entity) {
+            if !conveyor.Blocked {
+                conveyor.Blocked = true
+                conveyor.BlockedSince = env.Now
+                conveyor.Blockages++
+                env.Debug(LogComponent_Conveyor, "CONVEYOR BLOCKED", "conveyor", conveyor.Id, "entity", item.Entity)
+            }
+            if !slices.Contains(next.Waiting, conveyor) {
+                next.Waiting = append(next.Waiting, conveyor)
+            }
+            return false
+        }
+    }
+    
+    conveyor.Blocked = false
+    conveyor.Items = conveyor.Items[1:]
+    conveyor.TotalEntitiesOut++
+    if load, ok := item.Entity.(Load); ok {
+        conveyor.TotalLoadOut += load.GetLoad()
+    }
+    conveyor.AccumTransitTime += env.Now - item.DateIn
+    env.AddEntityTime(item.Entity.GetEntityBase(), Allocation_Transfer, env.Now - item.DateIn)
+    conveyor.AvgTransitTime = conveyor.AccumTransitTime / float64(conveyor.TotalEntitiesOut)
+    
+    env.Debug(LogComponent_Conveyor, "CONVEYOR EXITED", "conveyor", conveyor.Id, "entity", item.Entity)
+    env.NotifyChange(conveyor.Id)
+    
+    if env.Tracer != nil {
+        env.Trace(TraceRecord{Type: TraceType_Exit, Entity: item.Entity.GetName(), Id: conveyor.Id, Queue: len(conveyor.Queue)})
+    }
+    
+    if conveyor.Forward != nil {
+        conveyor.Forward(item.Entity)
+    } else if conveyor.NextProcess != "" {
+        env.ForwardTo(item.Entity, conveyor.NextProcess)
+    } else {
+        env.Dispose(item.Entity)
+    }
+    
+    return true
+}
+
+func (conveyor *ConveyorBase) ScheduleNextUpdate() {
+    env := conveyor.Env
+    next := math.Inf(1)
+    
+    if len(conveyor.Items) > 0 && conveyor.IsMoving(0) {
+        next = min(next, (conveyor.Length - conveyor.Items[0].Position) / conveyor.Speed)
+    }
+    
+    // the next entity to enter is either queued or blocking an upstream
+    // conveyor
+    var entering Entity
+    if len(conveyor.Queue) > 0 {
+        entering = conveyor.Queue[0]
+    } else if len(conveyor.Waiting) > 0 && len(conveyor.Waiting[0].Items) > 0 {
+        entering = conveyor.Waiting[0].Items[0].Entity
+    }
+    
+    if entering != nil && len(conveyor.Items) > 0 && conveyor.IsMoving(len(conveyor.Items)-1) {
+        needed := conveyor.GetItemSize(entering) - conveyor.GetEntranceSpace()
+        next = min(next, max(0, needed) / conveyor.Speed)
+    }
+    
+    if math.IsInf(next, 1) {
+        conveyor.NextUpdate = math.Inf(1)
+        return
+    }
+    
+    date := env.Now + next
+    if date == conveyor.NextUpdate {
+        return
+    }
+    
+    conveyor.NextUpdate = date
+    env.Schedule(Event{Date: date, Type: EventType_ConveyorUpdate, Id: conveyor.Id})
+}
+
+func (env *Environment) HandleConveyorUpdate(event Event) {
+    conveyor := env.GetConveyor(event.Id)
+    if event.Date != conveyor.NextUpdate {
+        // superseded by a later schedule
+        return
+    }
+    conveyor.NextUpdate = math.Inf(1)
+    conveyor.Update()
+}
+
+func (env *Environment) AddConveyor(base ConveyorBase) {
+    if base.Speed <= 0 || base.Length <= 0 {
+        log.Fatalf("Invalid conveyor: %s | length %g, speed %g", base.Id, base.Length, base.Speed)
+    }
+    
+    if len(base.Groups) == 0 {
+        base.Groups = []string{"Unnamed"}
+    }
+    
+    if base.CellSize <= 0 {
+        base.CellSize = base.Length
+    }
+    
+    base.Env = env
+    base.Queue = make([]Entity, 0)
+    base.Items = make([]*ConveyorItem, 0)
+    base.LastUpdate = env.Now
+    base.NextUpdate = math.Inf(1)
+    
+    conveyor := &base
+    env.Conveyors = append(env.Conveyors, conveyor)
+    env.Stations[conveyor.Id] = conveyor
+    env.AddEventHandler(EventType_ConveyorUpdate, env.HandleConveyorUpdate)
+}
+
+func (env *Environment) GetConveyor(cid string) *ConveyorBase {
+    for _, conveyor := range env.Conveyors {
+        if conveyor.Id == cid {
+            return conveyor
+        }
+    }
+    return nil
+}
+
+// GetUtilization returns the average fraction of the belt that was occupied.
+// The time since the last update is counted with the items on the belt
+// then, which stay the same until the next update, without updating it.
+func (conveyor *ConveyorBase) GetUtilization() float64 {
+    env := conveyor.Env
+    if env.Now <= conveyor.ResetDate {
+        return 0
+    }
+    occupied := conveyor.OccupiedTime + (env.Now - conveyor.LastUpdate) * conveyor.GetOccupiedLength() / conveyor.Length
+    return occupied / (env.Now - conveyor.ResetDate)
+}
+
+// GetBlockedTime returns the time the belt was blocked, up to now.
+func (conveyor *ConveyorBase) GetBlockedTime() float64 {
+    if conveyor.Blocked {
+        return conveyor.BlockedTime + conveyor.Env.Now - conveyor.LastUpdate
+    }
+    return conveyor.BlockedTime
+}
+
+// Reset clears the statistics of the conveyor as if it had started now.
+func (conveyor *ConveyorBase) Reset() {
+    env := conveyor.Env
+    conveyor.Update()
+    conveyor.QueueStats.Reset(env.Now)
+    conveyor.TotalEntitiesOut = 0
+    conveyor.TotalLoadOut = 0
+    conveyor.AccumTransitTime = 0
+    conveyor.AvgTransitTime = 0
+    conveyor.OccupiedTime = 0
+    conveyor.BlockedTime = 0
+    conveyor.BlockedSince = env.Now
+    conveyor.Blockages = 0
+    conveyor.ResetDate = env.Now
+}
+
+func (env *Environment) PrintConveyorsStatistics(groupId string) {
+    fmt.Printf("[CONVEYOR STATISTICS] Group: %s\n", groupId)
+    
+    fmt.Printf("%24s%16s%16s%16s%14s%16s%12s\n", "Conveyor", "Entities Out", "Avg Q Time (s)", "Avg Transit (s)", "Utilization", "Blocked (s)", "Blockages")
+    
+    for _, conveyor := range env.Conveyors {
+        if slices.Contains(conveyor.Groups, groupId) {
+            utilization := conveyor.GetUtilization()
+            fmt.Printf("%24.24s%16d%16.2f%16.2f%13.2f%%%16.2f%12d\n", conveyor.Id, conveyor.TotalEntitiesOut, conveyor.QueueStats.AvgTimeInQueue, conveyor.AvgTransitTime, utilization*100, conveyor.GetBlockedTime(), conveyor.Blockages)
+        }
+    }
+}
@@ -0,0 +1,67 @@
+package sim
+
+import (
+    "testing"
+)
+
+// Three boxes get on a belt of 4 m at 2 m/s, one every 0.5 s, and go on to
+// a belt that holds one box at a time, 2 s after it got on.
+func TestConveyorBlocking(t *testing.T) {
+    tests := []struct {
+        name            string
+        accumulating    bool
+        speed           float64 // of the second belt
+        blockages       int
+        blockedTime     float64
+        transitTime     float64
+        area            float64 // occupied length of the first belt, integrated
+    }{
+        // the second box blocks from 2 to 3.5 and the third from 4 to 5.5
+        {"blocks", false, 1, 2, 3, 3, 9},
+        {"blocks accumulating", true, 1, 2, 3, 3, 9},
+        {"never blocks", false, 10, 0, 0, 1.5, 4.5},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            env := NewEnvironment()
+            env.EndDate = 10
+            env.AddConveyor(ConveyorBase{Id: "A", Length: 4, Speed: 2, CellSize: 1, Accumulating: test.accumulating, NextProcess: "B"})
+            env.AddConveyor(ConveyorBase{Id: "B", Length: 4, Speed: test.speed, CellSize: 2})
+            env.AddEntitySource(NewTestSource("A", 3))
+            
+            a := env.GetConveyor("A")
+            b := env.GetConveyor("B")
+            
+            env.Begin()
+            for env.Advance() {
+                // reading statistics must not move the belt
+                lastUpdate := a.LastUpdate
+                a.GetUtilization()
+                a.GetBlockedTime()
+                if a.LastUpdate != lastUpdate {
+                    t.Fatalf("GetUtilization updated the conveyor at %g", env.Now)
+                }
+            }
+            
+            if a.TotalEntitiesOut != 3 || b.TotalEntitiesOut != 3 {
+                t.Errorf("entities out: got %d and %d, want 3", a.TotalEntitiesOut, b.TotalEntitiesOut)
+            }
+            if a.Blocked {
+                t.Errorf("still blocked")
+            }
+            if a.Blockages != test.blockages {
+                t.Errorf("blockages: got %d, want %d", a.Blockages, test.blockages)
+            }
+            if !IsClose(a.GetBlockedTime(), test.blockedTime) {
+                t.Errorf("blocked time: got %g, want %g", a.GetBlockedTime(), test.blockedTime)
+            }
+            if !IsClose(a.AvgTransitTime, test.transitTime) {
+                t.Errorf("transit time: got %g, want %g", a.AvgTransitTime, test.transitTime)
+            }
+            if !IsClose(a.GetUtilization(), test.area / a.Length / env.Now) {
+                t.Errorf("utilization: got %g, want %g", a.GetUtilization(), test.area / a.Length / env.Now)
+            }
+        })
+    }
+}
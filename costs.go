@@ -0,0 +1,142 @@
+package sim
+
+import (
+    "fmt"
+    "log"
+)
+
+// Costs are accrued by entities, in the categories of activity-based
+// costing: value-added and non-value-added processing, waiting and
+// transfer. The time an entity spends in each category costs its holding
+// cost, set by entity type; the time it keeps resources busy in processes
+// costs their busy cost, plus their use cost every time they are seized.
+// Resources also accrue idle cost, which is not charged to entities.
+
+const (
+    Allocation_ValueAdded       string = "ValueAdded"
+    Allocation_NonValueAdded    string = "NonValueAdded"
+    Allocation_Waiting          string = "Waiting"
+    Allocation_Transfer         string = "Transfer"
+)
+
+type Costs struct {
+    ValueAdded      float64
+    NonValueAdded   float64
+    Waiting         float64
+    Transfer        float64
+}
+
+func (costs *Costs) Add(allocation string, cost float64) {
+    if allocation == Allocation_ValueAdded {
+        costs.ValueAdded += cost
+    } else if allocation == Allocation_NonValueAdded {
+        costs.NonValueAdded += cost
+    } else if allocation == Allocation_Waiting {
+        costs.Waiting += cost
+    } else if allocation == Allocation_Transfer {
+        costs.Transfer += cost
+    } else {
+        log.Fatalf("Invalid allocation: %s", allocation)
+    }
+}
+
+func (costs *Costs) GetTotal() float64 {
+    return costs.ValueAdded + costs.NonValueAdded + costs.Waiting + costs.Transfer
+}
+
+// SetHoldingCost sets the cost per hour of the entities of a type, for all
+// the time they spend in the system.
+func (env *Environment) SetHoldingCost(entityType string, perHour float64) {
+    env.HoldingCosts[entityType] = perHour
+}
+
+// GetAllocation returns the cost category of the time in the process.
+func (process *ProcessBase) GetAllocation() string {
+    if process.Transfer {
+        return Allocation_Transfer
+    } else if process.NonValueAdded {
+        return Allocation_NonValueAdded
+    }
+    return Allocation_ValueAdded
+}
+
+// AddEntityTime adds to the times of an entity and charges its holding
+// cost for them.
+func (env *Environment) AddEntityTime(base *EntityBase, allocation string, duration float64) {
+    if allocation == Allocation_Waiting {
+        base.WaitTime += duration
+    } else if allocation == Allocation_Transfer {
+        base.TransferTime += duration
+    } else {
+        base.ProcessTime += duration
+    }
+    env.AddEntityCost(base, allocation, duration * env.HoldingCosts[base.Type] / Hours(1))
+}
+
+func (env *Environment) AddEntityCost(base *EntityBase, allocation string, cost float64) {
+    if cost == 0 {
+        return
+    }
+    base.Costs.Add(allocation, cost)
+    env.GetEntityTypeStatistics(base.Type).Costs.Add(allocation, cost)
+}
+
+// GetBusyCost returns the cost of the time the resource was busy since its
+// statistics started.
+func (res *ResourceBase) GetBusyCost(now float64) float64 {
+    busy := res.Busy.GetMean(now) * (now - res.Busy.StartDate)
+    return busy * res.BusyCost / Hours(1)
+}
+
+func (res *ResourceBase) GetIdleCost(now float64) float64 {
+    idle := max(0, res.Capacity - res.Busy.GetMean(now)) * (now - res.Busy.StartDate)
+    return idle * res.IdleCost / Hours(1)
+}
+
+func (res *ResourceBase) GetUseCost() float64 {
+    return float64(res.Uses) * res.UseCost
+}
+
+func (res *ResourceBase) GetCost(now float64) float64 {
+    return res.GetBusyCost(now) + res.GetIdleCost(now) + res.GetUseCost()
+}
+
+func (results *Results) SetCosts(env *Environment) {
+    for rid, resource := range env.Resources {
+        base := resource.GetResourceBase()
+        results.Set("Resource", rid, "Uses", float64(base.Uses))
+        results.Set("Resource", rid, "BusyCost", base.GetBusyCost(env.Now))
+        results.Set("Resource", rid, "IdleCost", base.GetIdleCost(env.Now))
+        results.Set("Resource", rid, "UseCost", base.GetUseCost())
+        results.Set("Resource", rid, "Cost", base.GetCost(env.Now))
+    }
+    
+    for entityType, st := range env.EntityTypes {
+        results.Set("EntityType", entityType, "ValueAddedCost", st.Costs.ValueAdded)
+        results.Set("EntityType", entityType, "NonValueAddedCost", st.Costs.NonValueAdded)
+        results.Set("EntityType", entityType, "WaitingCost", st.Costs.Waiting)
+        results.Set("EntityType", entityType, "TransferCost", st.Costs.Transfer)
+        results.Set("EntityType", entityType, "Cost", st.Costs.GetTotal())
+        results.SetTally("EntityType", entityType, "EntityCost", &st.EntityCost)
+    }
+}
+
+func (env *Environment) PrintCostsStatistics() {
+    fmt.Printf("[RESOURCE COSTS]\n")
+    
+    fmt.Printf("%24s%12s%16s%16s%16s%16s\n", "Resource", "Uses", "Busy", "Idle", "Use", "Total")
+    
+    for _, rid := range GetSortedKeys(env.Resources) {
+        base := env.Resources[rid].GetResourceBase()
+        fmt.Printf("%24.24s%12d%16.2f%16.2f%16.2f%16.2f\n", rid, base.Uses, base.GetBusyCost(env.Now), base.GetIdleCost(env.Now), base.GetUseCost(), base.GetCost(env.Now))
+    }
+    
+    fmt.Printf("[ENTITY TYPE COSTS]\n")
+    
+    fmt.Printf("%24s%16s%16s%16s%16s%16s%16s\n", "Entity Type", "Value Added", "Non-Value Added", "Waiting", "Transfer", "Total", "Avg per Entity")
+    
+    for _, entityType := range env.GetEntityTypes() {
+        st := env.EntityTypes[entityType]
+        fmt.Printf("%24.24s%16.2f%16.2f%16.2f%16.2f%16.2f%16.2f\n", entityType, st.Costs.ValueAdded, st.Costs.NonValueAdded, st.Costs.Waiting, st.Costs.Transfer, st.Costs.GetTotal(), st.EntityCost.GetMean())
+    }
+}
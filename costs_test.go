@@ -0,0 +1,42 @@
+package sim
+
+import (
+    "testing"
+)
+
+// Five boxes are weighed one at a time, for 10 s each. Every seize of the
+// scale charges its use cost to the box, even if the run ends before the
+// box leaves the scale.
+func TestUseCost(t *testing.T) {
+    tests := []struct {
+        name        string
+        endDate     float64
+        uses        int
+        queue       int
+    }{
+        {"all weighed", 60, 5, 0},
+        {"weighing the third", 25, 3, 2},
+        {"weighing the first", 5, 1, 4},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            env := NewEnvironment()
+            env.EndDate = test.endDate
+            env.AddEntitySource(NewTestSource("Weigh", 5))
+            env.AddResource(&ResourceBase{Id: "Scale", Amount: 1, UseCost: 50})
+            env.AddProcess(ProcessBase{Id: "Weigh", Needs: map[string]float64{"Scale": 1}, RNG: &RNGConstant{Value: 10}})
+            env.Run()
+            
+            scale := env.Resources["Scale"].GetResourceBase()
+            if scale.Uses != test.uses || len(scale.Queue) != test.queue {
+                t.Errorf("got %d uses and %d in queue, want %d and %d", scale.Uses, len(scale.Queue), test.uses, test.queue)
+            }
+            
+            costs := env.GetEntityTypeStatistics("Box").Costs.GetTotal()
+            if costs != scale.GetUseCost() {
+                t.Errorf("cost of the boxes: got %g, want %g", costs, scale.GetUseCost())
+            }
+        })
+    }
+}
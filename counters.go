@@ -0,0 +1,84 @@
+package sim
+
+import (
+    "fmt"
+    "slices"
+)
+
+// Counters and tallies are user statistics, like the tons exported by a
+// harbor or the round-trip time of trains. They are created the first time
+// they are used; adding them beforehand makes them show in the results
+// even if nothing is recorded. Like the built-in statistics, they are reset
+// at the end of the warm-up period.
+
+func (env *Environment) AddCounter(id string) *Counter {
+    if counter, ok := env.Counters[id]; ok {
+        return counter
+    }
+    counter := &Counter{}
+    env.Counters[id] = counter
+    return counter
+}
+
+func (env *Environment) AddTally(id string) *Tally {
+    if tally, ok := env.Tallies[id]; ok {
+        return tally
+    }
+    tally := &Tally{}
+    env.Tallies[id] = tally
+    return tally
+}
+
+// Count adds quantity to a counter.
+func (env *Environment) Count(id string, quantity float64) {
+    env.AddCounter(id).Add(quantity)
+}
+
+// Record adds an observation to a tally.
+func (env *Environment) Record(id string, x float64) {
+    env.AddTally(id).Record(x)
+}
+
+func (env *Environment) GetCounter(id string) *Counter {
+    return env.Counters[id]
+}
+
+func (env *Environment) GetTally(id string) *Tally {
+    return env.Tallies[id]
+}
+
+func GetSortedKeys[T any](m map[string]T) []string {
+    keys := make([]string, 0, len(m))
+    for key, _ := range m {
+        keys = append(keys, key)
+    }
+    slices.Sort(keys)
+    return keys
+}
+
+func (env *Environment) PrintCountersStatistics() {
+    fmt.Printf("[COUNTER STATISTICS]\n")
+    
+    fmt.Printf("%24s%16s%16s%16s\n", "Counter", "Value", "Count", "Rate (/day)")
+    
+    elapsed := env.Now - env.StatisticsStart
+    for _, id := range GetSortedKeys(env.Counters) {
+        counter := env.Counters[id]
+        rate := 0.0
+        if elapsed > 0 {
+            rate = counter.Value / elapsed * Days(1)
+        }
+        fmt.Printf("%24.24s%16.2f%16d%16.2f\n", id, counter.Value, counter.Count, rate)
+    }
+}
+
+func (env *Environment) PrintTalliesStatistics() {
+    fmt.Printf("[TALLY STATISTICS]\n")
+    
+    fmt.Printf("%24s%16s%16s%16s%16s%16s\n", "Tally", "Count", "Mean", "Std Dev", "Min", "Max")
+    
+    for _, id := range GetSortedKeys(env.Tallies) {
+        tally := env.Tallies[id]
+        fmt.Printf("%24.24s%16d%16.2f%16.2f%16.2f%16.2f\n", id, tally.Count, tally.GetMean(), tally.GetStdDev(), tally.Min, tally.Max)
+    }
+}
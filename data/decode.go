@@ -0,0 +1,266 @@
+package data
+
+import (
+    "fmt"
+    "math"
+    "reflect"
+    "strconv"
+    "strings"
+)
+
+// Units converts values read from tables to the units used by models:
+// tonnes, seconds and meters. Units can be added by models.
+var Units = map[string]float64{
+    "kg": 0.001,
+    "t": 1,
+    "kt": 1000,
+    "Mt": 1000000,
+    "s": 1,
+    "min": 60,
+    "h": 3600,
+    "d": 86400,
+    "m": 1,
+    "km": 1000,
+    "t/h": 1.0 / 3600,
+    "kt/h": 1000.0 / 3600,
+    "t/d": 1.0 / 86400,
+    "kt/d": 1000.0 / 86400,
+    "km/h": 1000.0 / 3600,
+}
+
+// Blanks are the cell values that are considered empty.
+var Blanks = []string{"", "-"}
+
+// DecodeError reports a cell that could not be decoded.
+type DecodeError struct {
+    Source  string
+    Row     int
+    Column  string
+    Value   string
+    Err     error
+}
+
+func (err *DecodeError) Error() string {
+    if err.Row == 0 {
+        return fmt.Sprintf("%s: column %q: %s", err.Source, err.Column, err.Err)
+    }
+    return fmt.Sprintf("%s: row %d, column %q: %q: %s", err.Source, err.Row, err.Column, err.Value, err.Err)
+}
+
+func (err *DecodeError) Unwrap() error {
+    return err.Err
+}
+
+// FieldTag is the parsed `data` tag of a struct field:
+//
+//     `data:"Column,unit=kt,default=0"`
+//
+// Column is a column name or position ("#2"). Arrays and slices read a range
+// of columns, like "Jan:Dec" or "#2:#13". Cells that are blank (see Blanks)
+// are an error unless a default is given. Fields without a tag are
+// skipped.
+type FieldTag struct {
+    From        string
+    To          string
+    Unit        string
+    Default     string
+    HasDefault  bool
+}
+
+func ParseFieldTag(tag string) (FieldTag, error) {
+    parts := strings.Split(tag, ",")
+    fieldTag := FieldTag{}
+    
+    columns := strings.SplitN(parts[0], ":", 2)
+    fieldTag.From = strings.TrimSpace(columns[0])
+    if len(columns) == 2 {
+        fieldTag.To = strings.TrimSpace(columns[1])
+    }
+    
+    for _, option := range parts[1:] {
+        key, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+        if key == "unit" {
+            if _, ok := Units[value]; !ok {
+                return fieldTag, fmt.Errorf("unknown unit: %s", value)
+            }
+            fieldTag.Unit = value
+        } else if key == "default" {
+            fieldTag.Default = value
+            fieldTag.HasDefault = true
+        } else {
+            return fieldTag, fmt.Errorf("unknown option: %s", key)
+        }
+    }
+    
+    return fieldTag, nil
+}
+
+func IsBlank(value string) bool {
+    value = strings.TrimSpace(value)
+    for _, blank := range Blanks {
+        if value == blank {
+            return true
+        }
+    }
+    return false
+}
+
+// ParseCell sets a value of kind string, bool, int, uint or float from a
+// cell, converting numbers from unit.
+func ParseCell(cell string, unit string, v reflect.Value) error {
+    cell = strings.TrimSpace(cell)
+    scale := 1.0
+    if unit != "" {
+        scale = Units[unit]
+    }
+    
+    kind := v.Kind()
+    if kind == reflect.String {
+        v.SetString(cell)
+    } else if kind == reflect.Bool {
+        b, err := strconv.ParseBool(cell)
+        if err != nil {
+            return fmt.Errorf("invalid boolean")
+        }
+        v.SetBool(b)
+    } else if kind == reflect.Float32 || kind == reflect.Float64 {
+        f, err := strconv.ParseFloat(cell, 64)
+        if err != nil {
+            return fmt.Errorf("invalid number")
+        }
+        v.SetFloat(f * scale)
+    } else if kind >= reflect.Int && kind <= reflect.Uint64 {
+        f, err := strconv.ParseFloat(cell, 64)
+        if err != nil {
+            return fmt.Errorf("invalid number")
+        }
+        
+        f *= scale
+        if f != math.Trunc(f) {
+            return fmt.Errorf("not an integer")
+        }
+        
+        if kind >= reflect.Uint {
+            if f < 0 {
+                return fmt.Errorf("negative number")
+            }
+            v.SetUint(uint64(f))
+        } else {
+            v.SetInt(int64(f))
+        }
+    } else {
+        return fmt.Errorf("unsupported type: %s", v.Type())
+    }
+    return nil
+}
+
+// Decode decodes each row of the table into an element of dst, a pointer
+// to a slice of structs (or of pointers to structs) whose fields are bound
+// to columns with `data` tags (see FieldTag).
+func (table *Table) Decode(dst any) error {
+    slice := reflect.ValueOf(dst)
+    if slice.Kind() != reflect.Pointer || slice.Elem().Kind() != reflect.Slice {
+        return fmt.Errorf("decode %s: destination must be a pointer to a slice", table.Name)
+    }
+    slice = slice.Elem()
+    
+    elemType := slice.Type().Elem()
+    isPointer := elemType.Kind() == reflect.Pointer
+    structType := elemType
+    if isPointer {
+        structType = elemType.Elem()
+    }
+    
+    if structType.Kind() != reflect.Struct {
+        return fmt.Errorf("decode %s: destination must be a slice of structs", table.Name)
+    }
+    
+    // resolve the columns of each field before reading rows
+    type binding struct {
+        Field   int
+        Tag     FieldTag
+        Columns []int
+    }
+    bindings := make([]binding, 0)
+    
+    for f := 0; f < structType.NumField(); f++ {
+        field := structType.Field(f)
+        tagValue, ok := field.Tag.Lookup("data")
+        if !ok || tagValue == "-" {
+            continue
+        }
+        
+        tag, err := ParseFieldTag(tagValue)
+        if err != nil {
+            return &DecodeError{Source: table.Source, Column: field.Name, Err: err}
+        }
+        
+        from := table.GetColumnIndex(tag.From)
+        if from < 0 {
+            return &DecodeError{Source: table.Source, Column: tag.From, Err: fmt.Errorf("column not found")}
+        }
+        
+        columns := []int{from}
+        if tag.To != "" {
+            to := table.GetColumnIndex(tag.To)
+            if to < from {
+                return &DecodeError{Source: table.Source, Column: tag.To, Err: fmt.Errorf("column not found")}
+            }
+            
+            columns = columns[:0]
+            for c := from; c <= to; c++ {
+                columns = append(columns, c)
+            }
+            
+            kind := field.Type.Kind()
+            if kind != reflect.Array && kind != reflect.Slice {
+                return &DecodeError{Source: table.Source, Column: field.Name, Err: fmt.Errorf("column range needs an array or slice")}
+            }
+            
+            if kind == reflect.Array && field.Type.Len() != len(columns) {
+                return &DecodeError{Source: table.Source, Column: field.Name, Err: fmt.Errorf("%d columns for an array of %d", len(columns), field.Type.Len())}
+            }
+        }
+        
+        bindings = append(bindings, binding{Field: f, Tag: tag, Columns: columns})
+    }
+    
+    for r, row := range table.Rows {
+        elem := reflect.New(structType).Elem()
+        
+        for _, b := range bindings {
+            field := elem.Field(b.Field)
+            
+            if b.Tag.To != "" && field.Kind() == reflect.Slice {
+                field.Set(reflect.MakeSlice(field.Type(), len(b.Columns), len(b.Columns)))
+            }
+            
+            for i, c := range b.Columns {
+                v := field
+                if b.Tag.To != "" {
+                    v = field.Index(i)
+                }
+                
+                cell := row[c]
+                if IsBlank(cell) {
+                    if !b.Tag.HasDefault {
+                        return &DecodeError{Source: table.Source, Row: table.RowNumbers[r], Column: table.Columns[c], Value: cell, Err: fmt.Errorf("blank value")}
+                    }
+                    cell = b.Tag.Default
+                }
+                
+                if err := ParseCell(cell, b.Tag.Unit, v); err != nil {
+                    return &DecodeError{Source: table.Source, Row: table.RowNumbers[r], Column: table.Columns[c], Value: cell, Err: err}
+                }
+            }
+        }
+        
+        if isPointer {
+            slice.Set(reflect.Append(slice, elem.Addr()))
+        } else {
+            slice.Set(reflect.Append(slice, elem))
+        }
+    }
+    
+    return nil
+}
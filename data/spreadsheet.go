@@ -0,0 +1,443 @@
+package data
+
+import (
+    "archive/zip"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "path"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// ReadSheet reads a range of a sheet of an OpenDocument (.ods) or Excel
+// (.xlsx) spreadsheet as a table whose header is the first row of the
+// range. An empty sheet name selects the first sheet. The range is given
+// in A1 notation, like "B3:M20"; the end, the rows ("B:M") or the whole
+// range may be left out to take everything up to the last non-empty cell.
+// Numeric cells are read as their raw values, not as displayed.
+func ReadSheet(path string, sheet string, cellRange string) (*Table, error) {
+    ext := strings.ToLower(filepath.Ext(path))
+    var grid [][]string
+    var err error
+    
+    if ext == ".ods" {
+        grid, sheet, err = ReadODSGrid(path, sheet)
+    } else if ext == ".xlsx" {
+        grid, sheet, err = ReadXLSXGrid(path, sheet)
+    } else {
+        return nil, fmt.Errorf("unknown spreadsheet format: %s", path)
+    }
+    
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    
+    source := fmt.Sprintf("%s[%s]", path, sheet)
+    table, err := NewTableFromGrid(grid, cellRange)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", source, err)
+    }
+    
+    table.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+    table.Source = source
+    return table, nil
+}
+
+// ParseCellRef parses a cell reference like "B3" into 0-based column and
+// row indices. Either may be missing, in which case it is -1.
+func ParseCellRef(ref string) (int, int, error) {
+    ref = strings.ToUpper(strings.TrimSpace(strings.ReplaceAll(ref, "$", "")))
+    col, row := -1, -1
+    
+    i := 0
+    for i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z' {
+        col = (col+1)*26 + int(ref[i]-'A')
+        i++
+    }
+    
+    if i < len(ref) {
+        n, err := strconv.Atoi(ref[i:])
+        if err != nil || n < 1 {
+            return 0, 0, fmt.Errorf("invalid cell reference: %q", ref)
+        }
+        row = n-1
+    }
+    
+    return col, row, nil
+}
+
+// NewTableFromGrid takes a range of a grid of cells as a table.
+func NewTableFromGrid(grid [][]string, cellRange string) (*Table, error) {
+    firstCol, firstRow, lastCol, lastRow := 0, 0, -1, -1
+    
+    if cellRange != "" {
+        from, to, _ := strings.Cut(cellRange, ":")
+        c, r, err := ParseCellRef(from)
+        if err != nil {
+            return nil, err
+        }
+        firstCol, firstRow = max(0, c), max(0, r)
+        
+        if to != "" {
+            if lastCol, lastRow, err = ParseCellRef(to); err != nil {
+                return nil, err
+            }
+        }
+    }
+    
+    if lastRow < 0 {
+        lastRow = len(grid)-1
+    }
+    
+    if lastCol < 0 {
+        for r := firstRow; r <= lastRow && r < len(grid); r++ {
+            lastCol = max(lastCol, len(grid[r])-1)
+        }
+    }
+    
+    cell := func (r int, c int) string {
+        if r < len(grid) && c < len(grid[r]) {
+            return grid[r][c]
+        }
+        return ""
+    }
+    
+    if firstRow > lastRow || firstCol > lastCol {
+        return nil, fmt.Errorf("empty range: %q", cellRange)
+    }
+    
+    table := &Table{}
+    for c := firstCol; c <= lastCol; c++ {
+        table.Columns = append(table.Columns, cell(firstRow, c))
+    }
+    
+    for r := firstRow+1; r <= lastRow; r++ {
+        row := make([]string, 0, lastCol-firstCol+1)
+        empty := true
+        for c := firstCol; c <= lastCol; c++ {
+            row = append(row, cell(r, c))
+            empty = empty && cell(r, c) == ""
+        }
+        
+        if !empty {
+            table.AddRow(row, r+1)
+        }
+    }
+    
+    return table, nil
+}
+
+func readZipFile(archive *zip.ReadCloser, name string) ([]byte, error) {
+    for _, file := range archive.File {
+        if file.Name == name {
+            reader, err := file.Open()
+            if err != nil {
+                return nil, err
+            }
+            defer reader.Close()
+            return io.ReadAll(reader)
+        }
+    }
+    return nil, fmt.Errorf("file not found in archive: %s", name)
+}
+
+func getAttr(element xml.StartElement, name string) string {
+    for _, attr := range element.Attr {
+        if attr.Name.Local == name {
+            return attr.Value
+        }
+    }
+    return ""
+}
+
+// ReadODSGrid reads the cells of a sheet of an OpenDocument spreadsheet.
+// It returns the name of the sheet read.
+func ReadODSGrid(path string, sheet string) ([][]string, string, error) {
+    archive, err := zip.OpenReader(path)
+    if err != nil {
+        return nil, "", err
+    }
+    defer archive.Close()
+    
+    content, err := readZipFile(archive, "content.xml")
+    if err != nil {
+        return nil, "", err
+    }
+    
+    decoder := xml.NewDecoder(strings.NewReader(string(content)))
+    var grid [][]string
+    var row []string
+    found := false
+    inTable := false
+    emptyRows := 0
+    emptyCells := 0
+    rowRepeat := 1
+    
+    // cell being read
+    inCell := false
+    cellValue := ""
+    cellText := strings.Builder{}
+    cellRepeat := 1
+    paragraphs := 0
+    
+    for {
+        token, err := decoder.Token()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, "", err
+        }
+        
+        if element, ok := token.(xml.StartElement); ok {
+            name := element.Name.Local
+            
+            if name == "table" && !found {
+                tableName := getAttr(element, "name")
+                if sheet == "" || tableName == sheet {
+                    sheet = tableName
+                    found = true
+                    inTable = true
+                }
+            } else if !inTable {
+                continue
+            } else if name == "table-row" {
+                row = make([]string, 0)
+                emptyCells = 0
+                rowRepeat = 1
+                if n, err := strconv.Atoi(getAttr(element, "number-rows-repeated")); err == nil {
+                    rowRepeat = n
+                }
+            } else if name == "table-cell" || name == "covered-table-cell" {
+                inCell = true
+                cellText.Reset()
+                paragraphs = 0
+                cellRepeat = 1
+                if n, err := strconv.Atoi(getAttr(element, "number-columns-repeated")); err == nil {
+                    cellRepeat = n
+                }
+                
+                valueType := getAttr(element, "value-type")
+                cellValue = ""
+                if valueType == "float" || valueType == "percentage" || valueType == "currency" {
+                    cellValue = getAttr(element, "value")
+                } else if valueType == "boolean" {
+                    cellValue = getAttr(element, "boolean-value")
+                } else if valueType == "date" {
+                    cellValue = getAttr(element, "date-value")
+                } else if valueType == "time" {
+                    cellValue = getAttr(element, "time-value")
+                }
+            } else if name == "p" && inCell {
+                if paragraphs > 0 {
+                    cellText.WriteString("\n")
+                }
+                paragraphs++
+            } else if name == "s" && inCell {
+                n, err := strconv.Atoi(getAttr(element, "c"))
+                if err != nil {
+                    n = 1
+                }
+                cellText.WriteString(strings.Repeat(" ", n))
+            } else if name == "tab" && inCell {
+                cellText.WriteString("\t")
+            } else if name == "line-break" && inCell {
+                cellText.WriteString("\n")
+            }
+        } else if text, ok := token.(xml.CharData); ok && inCell && paragraphs > 0 {
+            cellText.Write(text)
+        } else if element, ok := token.(xml.EndElement); ok && inTable {
+            name := element.Name.Local
+            
+            if name == "table" {
+                break
+            } else if name == "table-cell" || name == "covered-table-cell" {
+                inCell = false
+                value := cellValue
+                if value == "" {
+                    value = cellText.String()
+                }
+                
+                // empty cells are only added when followed by a value,
+                // since sheets end with huge repeated empty ranges
+                if value == "" {
+                    emptyCells += cellRepeat
+                } else {
+                    for ; emptyCells > 0; emptyCells-- {
+                        row = append(row, "")
+                    }
+                    for i := 0; i < cellRepeat; i++ {
+                        row = append(row, value)
+                    }
+                }
+            } else if name == "table-row" {
+                if len(row) == 0 {
+                    emptyRows += rowRepeat
+                } else {
+                    for ; emptyRows > 0; emptyRows-- {
+                        grid = append(grid, nil)
+                    }
+                    for i := 0; i < rowRepeat; i++ {
+                        grid = append(grid, row)
+                    }
+                }
+            }
+        }
+    }
+    
+    if !found {
+        return nil, "", fmt.Errorf("sheet not found: %s", sheet)
+    }
+    return grid, sheet, nil
+}
+
+type xlsxWorkbook struct {
+    Sheets []struct {
+        Name    string `xml:"name,attr"`
+        Id      string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+    } `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+    Relationships []struct {
+        Id      string `xml:"Id,attr"`
+        Target  string `xml:"Target,attr"`
+    } `xml:"Relationship"`
+}
+
+type xlsxRichText struct {
+    Text    string `xml:"t"`
+    Runs    []struct {
+        Text    string `xml:"t"`
+    } `xml:"r"`
+}
+
+func (text *xlsxRichText) String() string {
+    if len(text.Runs) == 0 {
+        return text.Text
+    }
+    
+    s := strings.Builder{}
+    for _, run := range text.Runs {
+        s.WriteString(run.Text)
+    }
+    return s.String()
+}
+
+type xlsxSharedStrings struct {
+    Items   []xlsxRichText `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+    Rows []struct {
+        Cells []struct {
+            Ref     string `xml:"r,attr"`
+            Type    string `xml:"t,attr"`
+            Value   string `xml:"v"`
+            Inline  xlsxRichText `xml:"is"`
+        } `xml:"c"`
+    } `xml:"sheetData>row"`
+}
+
+// ReadXLSXGrid reads the cells of a sheet of an Excel workbook. It returns
+// the name of the sheet read.
+func ReadXLSXGrid(filePath string, sheet string) ([][]string, string, error) {
+    archive, err := zip.OpenReader(filePath)
+    if err != nil {
+        return nil, "", err
+    }
+    defer archive.Close()
+    
+    readXML := func (name string, v any) error {
+        content, err := readZipFile(archive, name)
+        if err != nil {
+            return err
+        }
+        return xml.Unmarshal(content, v)
+    }
+    
+    workbook := xlsxWorkbook{}
+    if err := readXML("xl/workbook.xml", &workbook); err != nil {
+        return nil, "", err
+    }
+    
+    rels := xlsxRelationships{}
+    if err := readXML("xl/_rels/workbook.xml.rels", &rels); err != nil {
+        return nil, "", err
+    }
+    
+    target := ""
+    for _, s := range workbook.Sheets {
+        if sheet == "" || s.Name == sheet {
+            sheet = s.Name
+            for _, rel := range rels.Relationships {
+                if rel.Id == s.Id {
+                    target = rel.Target
+                }
+            }
+            break
+        }
+    }
+    
+    if target == "" {
+        return nil, "", fmt.Errorf("sheet not found: %s", sheet)
+    }
+    
+    if strings.HasPrefix(target, "/") {
+        target = strings.TrimPrefix(target, "/")
+    } else {
+        target = path.Join("xl", target)
+    }
+    
+    shared := xlsxSharedStrings{}
+    if _, err := readZipFile(archive, "xl/sharedStrings.xml"); err == nil {
+        if err := readXML("xl/sharedStrings.xml", &shared); err != nil {
+            return nil, "", err
+        }
+    }
+    
+    worksheet := xlsxWorksheet{}
+    if err := readXML(target, &worksheet); err != nil {
+        return nil, "", err
+    }
+    
+    var grid [][]string
+    for r, row := range worksheet.Rows {
+        for c, cell := range row.Cells {
+            col, rowIndex := c, r
+            if cell.Ref != "" {
+                var err error
+                if col, rowIndex, err = ParseCellRef(cell.Ref); err != nil {
+                    return nil, "", err
+                }
+            }
+            
+            value := cell.Value
+            if cell.Type == "s" {
+                i, err := strconv.Atoi(cell.Value)
+                if err != nil || i < 0 || i >= len(shared.Items) {
+                    return nil, "", fmt.Errorf("invalid shared string: %s", cell.Ref)
+                }
+                value = shared.Items[i].String()
+            } else if cell.Type == "inlineStr" {
+                value = cell.Inline.String()
+            }
+            
+            if value == "" {
+                continue
+            }
+            
+            for len(grid) <= rowIndex {
+                grid = append(grid, nil)
+            }
+            for len(grid[rowIndex]) <= col {
+                grid[rowIndex] = append(grid[rowIndex], "")
+            }
+            grid[rowIndex][col] = value
+        }
+    }
+    
+    return grid, sheet, nil
+}
@@ -0,0 +1,241 @@
+// Package data loads model inputs from tables (TSV, CSV and spreadsheets)
+// into typed structs.
+package data
+
+import (
+    "encoding/csv"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "slices"
+    "strings"
+)
+
+// Table is a grid of cells with a header. RowNumbers keeps the number of
+// each row in its source (the line where it starts in a file) so that
+// errors point to the right place after rows are excluded.
+type Table struct {
+    Name        string
+    Source      string
+    Columns     []string
+    Rows        [][]string
+    RowNumbers  []int
+}
+
+// NewTable creates a table from a header and its rows. Rows have no source,
+// so they are numbered from 2, as if the header were row 1.
+func NewTable(name string, columns []string, rows [][]string) *Table {
+    table := &Table{Name: name, Source: name, Columns: columns, Rows: rows}
+    for i := range rows {
+        table.RowNumbers = append(table.RowNumbers, i+2)
+    }
+    return table
+}
+
+func ReadTSV(path string) (*Table, error) {
+    return ReadDelimited(path, '\t')
+}
+
+func ReadCSV(path string) (*Table, error) {
+    return ReadDelimited(path, ',')
+}
+
+// ReadDelimited reads a text table whose first line is the header. Empty
+// lines are skipped and short rows are padded with blank cells. Rows are
+// numbered by the line they start on, which quoted cells with line breaks
+// and skipped lines make different from their position.
+func ReadDelimited(path string, comma rune) (*Table, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    
+    reader := csv.NewReader(file)
+    reader.Comma = comma
+    reader.FieldsPerRecord = -1
+    reader.LazyQuotes = true
+    
+    header, err := reader.Read()
+    if err == io.EOF {
+        return nil, fmt.Errorf("%s: no header", path)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    
+    name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+    table := &Table{Name: name, Source: path, Columns: header}
+    
+    for {
+        record, err := reader.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", path, err)
+        }
+        
+        if len(record) == 1 && record[0] == "" {
+            continue
+        }
+        line, _ := reader.FieldPos(0)
+        table.AddRow(record, line)
+    }
+    
+    return table, nil
+}
+
+// AddRow adds a row, padded or cut to the number of columns.
+func (table *Table) AddRow(row []string, number int) {
+    cells := make([]string, len(table.Columns))
+    copy(cells, row)
+    table.Rows = append(table.Rows, cells)
+    table.RowNumbers = append(table.RowNumbers, number)
+}
+
+func (table *Table) GetNumRows() int {
+    return len(table.Rows)
+}
+
+// GetColumnIndex returns the index of a column given by name or by position,
+// as "#1" for the first column. Returns -1 if not found.
+func (table *Table) GetColumnIndex(column string) int {
+    if strings.HasPrefix(column, "#") {
+        var n int
+        if _, err := fmt.Sscanf(column, "#%d", &n); err == nil && n >= 1 && n <= len(table.Columns) {
+            return n-1
+        }
+        return -1
+    }
+    
+    for i, name := range table.Columns {
+        if strings.TrimSpace(name) == strings.TrimSpace(column) {
+            return i
+        }
+    }
+    return -1
+}
+
+// Get returns the cell of a row in a column, or "" if there is no such
+// column.
+func (table *Table) Get(row int, column string) string {
+    c := table.GetColumnIndex(column)
+    if c < 0 {
+        return ""
+    }
+    return table.Rows[row][c]
+}
+
+// Filter returns a table with the rows for which keep returns true.
+func (table *Table) Filter(keep func (row []string) bool) *Table {
+    filtered := &Table{Name: table.Name, Source: table.Source, Columns: table.Columns}
+    for i, row := range table.Rows {
+        if keep(row) {
+            filtered.Rows = append(filtered.Rows, row)
+            filtered.RowNumbers = append(filtered.RowNumbers, table.RowNumbers[i])
+        }
+    }
+    return filtered
+}
+
+// Exclude returns a table without the rows whose cell in column is one of
+// values, like totals at the bottom of a table.
+func (table *Table) Exclude(column string, values ...string) *Table {
+    c := table.GetColumnIndex(column)
+    return table.Filter(func (row []string) bool {
+        return c < 0 || !slices.Contains(values, strings.TrimSpace(row[c]))
+    })
+}
+
+// TableSource is where a table of a catalog is read from. Sheet and Range
+// only apply to spreadsheets (see ReadSheet).
+type TableSource struct {
+    Path    string
+    Sheet   string
+    Range   string
+}
+
+// Catalog is a set of named tables. Tables can be registered with the path
+// of their file, relative to Dir, and are read the first time they are
+// requested.
+type Catalog struct {
+    Dir     string
+    Sources map[string]TableSource
+    Tables  map[string]*Table
+}
+
+func NewCatalog(dir string) *Catalog {
+    return &Catalog{Dir: dir, Sources: make(map[string]TableSource), Tables: make(map[string]*Table)}
+}
+
+func (catalog *Catalog) Add(table *Table) {
+    catalog.Tables[table.Name] = table
+}
+
+func (catalog *Catalog) Register(name string, path string) {
+    catalog.Sources[name] = TableSource{Path: path}
+    delete(catalog.Tables, name)
+}
+
+// RegisterSheet registers a range of a sheet of a spreadsheet as a table.
+func (catalog *Catalog) RegisterSheet(name string, path string, sheet string, cellRange string) {
+    catalog.Sources[name] = TableSource{Path: path, Sheet: sheet, Range: cellRange}
+    delete(catalog.Tables, name)
+}
+
+// Get returns a table, reading it from its file if needed.
+func (catalog *Catalog) Get(name string) (*Table, error) {
+    if table, ok := catalog.Tables[name]; ok {
+        return table, nil
+    }
+    
+    source, ok := catalog.Sources[name]
+    if !ok {
+        return nil, fmt.Errorf("table not found: %s", name)
+    }
+    
+    path := source.Path
+    if !filepath.IsAbs(path) {
+        path = filepath.Join(catalog.Dir, path)
+    }
+    
+    var table *Table
+    var err error
+    if source.Sheet != "" || source.Range != "" {
+        table, err = ReadSheet(path, source.Sheet, source.Range)
+    } else {
+        table, err = ReadTable(path)
+    }
+    if err != nil {
+        return nil, err
+    }
+    
+    table.Name = name
+    catalog.Tables[name] = table
+    return table, nil
+}
+
+// Decode decodes the rows of a table into dst (see Table.Decode).
+func (catalog *Catalog) Decode(name string, dst any) error {
+    table, err := catalog.Get(name)
+    if err != nil {
+        return err
+    }
+    return table.Decode(dst)
+}
+
+// ReadTable reads a table from a file, choosing the format by its
+// extension. Spreadsheets are read from their first sheet.
+func ReadTable(path string) (*Table, error) {
+    ext := strings.ToLower(filepath.Ext(path))
+    if ext == ".csv" {
+        return ReadCSV(path)
+    } else if ext == ".tsv" || ext == ".tab" || ext == ".txt" {
+        return ReadTSV(path)
+    } else if ext == ".ods" || ext == ".xlsx" {
+        return ReadSheet(path, "", "")
+    }
+    return nil, fmt.Errorf("unknown table format: %s", path)
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "slices"
+    "testing"
+)
+
+func WriteTestFile(t *testing.T, name string, content string) string {
+    path := filepath.Join(t.TempDir(), name)
+    if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestReadDelimitedRowNumbers(t *testing.T) {
+    tests := []struct {
+        name        string
+        file        string
+        content     string
+        rows        [][]string
+        numbers     []int
+    }{
+        {"plain", "plain.tsv", "A\tB\n1\t2\n3\t4\n", [][]string{{"1", "2"}, {"3", "4"}}, []int{2, 3}},
+        {"blank lines", "blank.tsv", "A\tB\n\n1\t2\n\n\n3\t4\n", [][]string{{"1", "2"}, {"3", "4"}}, []int{3, 6}},
+        {"blank before header", "header.csv", "\nA,B\n1,2\n", [][]string{{"1", "2"}}, []int{3}},
+        {"line breaks in cells", "quoted.csv", "A,B\n\"Port of\nParanaguá\",2\n3,4\n", [][]string{{"Port of\nParanaguá", "2"}, {"3", "4"}}, []int{2, 4}},
+        {"short rows", "short.tsv", "A\tB\tC\n1\n2\t3\n", [][]string{{"1", "", ""}, {"2", "3", ""}}, []int{2, 3}},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            table, err := ReadTable(WriteTestFile(t, test.file, test.content))
+            if err != nil {
+                t.Fatal(err)
+            }
+            
+            if !slices.EqualFunc(table.Rows, test.rows, slices.Equal[[]string]) {
+                t.Errorf("rows: got %q, want %q", table.Rows, test.rows)
+            }
+            if !slices.Equal(table.RowNumbers, test.numbers) {
+                t.Errorf("row numbers: got %v, want %v", table.RowNumbers, test.numbers)
+            }
+        })
+    }
+}
+
+func TestDecodeErrorRow(t *testing.T) {
+    type Harbor struct {
+        Id      string  `data:"Port"`
+        Storage float64 `data:"Storage (kt),unit=kt"`
+    }
+    
+    content := "Port,Storage (kt)\n\"Rio\nGrande\",10\n\nParanaguá,ten\n"
+    table, err := ReadTable(WriteTestFile(t, "harbors.csv", content))
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    var harbors []*Harbor
+    err = table.Decode(&harbors)
+    
+    var decodeErr *DecodeError
+    if !errors.As(err, &decodeErr) {
+        t.Fatalf("got %v, want a decode error", err)
+    }
+    if decodeErr.Row != 5 || decodeErr.Column != "Storage (kt)" {
+        t.Errorf("got row %d, column %q, want row 5, column \"Storage (kt)\"", decodeErr.Row, decodeErr.Column)
+    }
+}
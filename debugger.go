@@ -0,0 +1,456 @@
+package sim
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "slices"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+const (
+    BreakpointType_Enter        string = "Enter"
+    BreakpointType_QueueSize    string = "QueueSize"
+    BreakpointType_Condition    string = "Condition"
+)
+
+// Breakpoint stops a debugger when an entity enters Station (a process, a
+// hold, a conveyor or a transporter), when the queue of Station exceeds
+// QueueSize or when Condition holds. Entity restricts Enter breakpoints to
+// the entity with that name.
+type Breakpoint struct {
+    Id          int
+    Type        string
+    Station     string
+    Entity      string
+    QueueSize   int
+    Name        string
+    Condition   func (env *Environment) bool
+    Disabled    bool
+    Hits        int
+}
+
+func (breakpoint *Breakpoint) String() string {
+    description := ""
+    if breakpoint.Type == BreakpointType_Enter {
+        description = "enter " + breakpoint.Station
+        if breakpoint.Entity != "" {
+            description += " (" + breakpoint.Entity + ")"
+        }
+    } else if breakpoint.Type == BreakpointType_QueueSize {
+        description = fmt.Sprintf("queue %s > %d", breakpoint.Station, breakpoint.QueueSize)
+    } else {
+        description = "when " + breakpoint.Name
+    }
+    
+    if breakpoint.Disabled {
+        description += " [disabled]"
+    }
+    return fmt.Sprintf("#%d %s, %d hits", breakpoint.Id, description, breakpoint.Hits)
+}
+
+// Debugger runs an environment step by step. A step runs everything that
+// happens at the current time and advances the clock to the next event, so
+// breakpoints hit during a step stop the run at the end of that step,
+// before time moves again.
+type Debugger struct {
+    Env             *Environment
+    Breakpoints     []*Breakpoint
+    NextId          int
+    Hit             []*Breakpoint // breakpoints hit in the last step
+    Reasons         []string
+    Started         bool
+    Ended           bool
+}
+
+// NewDebugger attaches a debugger to an environment, which must be run
+// through it (not with env.Run).
+func NewDebugger(env *Environment) *Debugger {
+    debugger := &Debugger{Env: env, NextId: 1}
+    env.Debugger = debugger
+    return debugger
+}
+
+func (debugger *Debugger) AddBreakpoint(breakpoint Breakpoint) *Breakpoint {
+    breakpoint.Id = debugger.NextId
+    debugger.NextId++
+    debugger.Breakpoints = append(debugger.Breakpoints, &breakpoint)
+    return &breakpoint
+}
+
+// BreakOnEnter breaks when an entity enters a process, hold, conveyor or
+// transporter. If entity is not empty, only that entity is considered.
+// Like every breakpoint, it stops the run at the end of the step, so the
+// state shown is the state after all events at that time, by which the
+// entity may have already left the queue it entered.
+func (debugger *Debugger) BreakOnEnter(station string, entity string) *Breakpoint {
+    return debugger.AddBreakpoint(Breakpoint{Type: BreakpointType_Enter, Station: station, Entity: entity})
+}
+
+// BreakOnQueue breaks when the queue of a process, hold, conveyor or
+// transporter exceeds size.
+func (debugger *Debugger) BreakOnQueue(station string, size int) *Breakpoint {
+    return debugger.AddBreakpoint(Breakpoint{Type: BreakpointType_QueueSize, Station: station, QueueSize: size})
+}
+
+// BreakWhen breaks at the end of any step in which condition holds.
+func (debugger *Debugger) BreakWhen(name string, condition func (env *Environment) bool) *Breakpoint {
+    return debugger.AddBreakpoint(Breakpoint{Type: BreakpointType_Condition, Name: name, Condition: condition})
+}
+
+func (debugger *Debugger) RemoveBreakpoint(id int) bool {
+    for i, breakpoint := range debugger.Breakpoints {
+        if breakpoint.Id == id {
+            debugger.Breakpoints = slices.Delete(debugger.Breakpoints, i, i+1)
+            return true
+        }
+    }
+    return false
+}
+
+func (debugger *Debugger) GetBreakpoint(id int) *Breakpoint {
+    for _, breakpoint := range debugger.Breakpoints {
+        if breakpoint.Id == id {
+            return breakpoint
+        }
+    }
+    return nil
+}
+
+func (debugger *Debugger) RecordHit(breakpoint *Breakpoint, reason string) {
+    breakpoint.Hits++
+    if !slices.Contains(debugger.Hit, breakpoint) {
+        debugger.Hit = append(debugger.Hit, breakpoint)
+    }
+    debugger.Reasons = append(debugger.Reasons, fmt.Sprintf("#%d %s", breakpoint.Id, reason))
+}
+
+// OnEnter is called by the engine when an entity enters the queue of a
+// process, hold, conveyor or transporter.
+func (debugger *Debugger) OnEnter(entity Entity, station string, queueSize int) {
+    for _, breakpoint := range debugger.Breakpoints {
+        if breakpoint.Disabled || breakpoint.Station != station {
+            continue
+        }
+        
+        if breakpoint.Type == BreakpointType_Enter && (breakpoint.Entity == "" || breakpoint.Entity == entity.GetName()) {
+            debugger.RecordHit(breakpoint, fmt.Sprintf("%s entered %s", entity.GetName(), station))
+        } else if breakpoint.Type == BreakpointType_QueueSize && queueSize > breakpoint.QueueSize {
+            debugger.RecordHit(breakpoint, fmt.Sprintf("queue of %s is %d", station, queueSize))
+        }
+    }
+}
+
+// Step runs one step, all the events at the current time, and returns
+// false if the run ended. Events at the same time can't be stepped through
+// one by one.
+func (debugger *Debugger) Step() bool {
+    if debugger.Ended {
+        return false
+    }
+    
+    if !debugger.Started {
+        debugger.Env.Begin()
+        debugger.Started = true
+    }
+    
+    debugger.Hit = debugger.Hit[:0]
+    debugger.Reasons = debugger.Reasons[:0]
+    debugger.Ended = !debugger.Env.Advance()
+    
+    for _, breakpoint := range debugger.Breakpoints {
+        if !breakpoint.Disabled && breakpoint.Type == BreakpointType_Condition && breakpoint.Condition(debugger.Env) {
+            debugger.RecordHit(breakpoint, breakpoint.Name)
+        }
+    }
+    
+    return !debugger.Ended
+}
+
+// IsBroken tells whether a breakpoint was hit in the last step.
+func (debugger *Debugger) IsBroken() bool {
+    return len(debugger.Hit) > 0
+}
+
+// Continue runs until a breakpoint is hit or the run ends, and returns
+// false if the run ended.
+func (debugger *Debugger) Continue() bool {
+    for debugger.Step() {
+        if debugger.IsBroken() {
+            return true
+        }
+    }
+    return false
+}
+
+// RunUntil runs until the clock reaches date, a breakpoint is hit or the
+// run ends, and returns false if the run ended.
+func (debugger *Debugger) RunUntil(date float64) bool {
+    for (!debugger.Started || debugger.Env.Now < date) && debugger.Step() {
+        if debugger.IsBroken() {
+            return true
+        }
+    }
+    return !debugger.Ended
+}
+
+// QueueState is the queue of a process, hold, transporter or conveyor.
+type QueueState struct {
+    Kind        string
+    Id          string
+    Entities    []string
+}
+
+type OngoingState struct {
+    Process     string
+    Entity      string
+    DateStart   float64
+    DateEnd     float64
+}
+
+type ResourceState struct {
+    Id          string
+    Amount      float64
+    Capacity    float64
+    Queue       int
+}
+
+func GetEntityNames(entities []Entity) []string {
+    names := make([]string, len(entities))
+    for i, entity := range entities {
+        names[i] = entity.GetName()
+    }
+    return names
+}
+
+// GetQueues returns the queues that are not empty.
+func (debugger *Debugger) GetQueues() []QueueState {
+    env := debugger.Env
+    queues := make([]QueueState, 0)
+    
+    for _, process := range env.Processes {
+        if base := process.GetProcessBase(); len(base.Queue) > 0 {
+            queues = append(queues, QueueState{Kind: "Process", Id: base.Id, Entities: GetEntityNames(base.Queue)})
+        }
+    }
+    
+    for _, hold := range env.Holds {
+        if len(hold.Queue) > 0 {
+            queues = append(queues, QueueState{Kind: "Hold", Id: hold.Id, Entities: GetEntityNames(hold.Queue)})
+        }
+    }
+    
+    for _, transporter := range env.Transporters {
+        if len(transporter.Queue) > 0 {
+            names := make([]string, len(transporter.Queue))
+            for i, request := range transporter.Queue {
+                names[i] = request.Entity.GetName()
+            }
+            queues = append(queues, QueueState{Kind: "Transporter", Id: transporter.Id, Entities: names})
+        }
+    }
+    
+    for _, conveyor := range env.Conveyors {
+        if len(conveyor.Queue) > 0 {
+            queues = append(queues, QueueState{Kind: "Conveyor", Id: conveyor.Id, Entities: GetEntityNames(conveyor.Queue)})
+        }
+    }
+    
+    return queues
+}
+
+func (debugger *Debugger) GetOngoing() []OngoingState {
+    ongoing := make([]OngoingState, len(debugger.Env.OngoingProcesses))
+    for i, process := range debugger.Env.OngoingProcesses {
+        ongoing[i] = OngoingState{Process: process.Process.GetId(), Entity: process.Entity.GetName(), DateStart: process.DateStart, DateEnd: process.DateEnd}
+    }
+    return ongoing
+}
+
+func (debugger *Debugger) GetResources() []ResourceState {
+    resources := make([]ResourceState, 0, len(debugger.Env.Resources))
+    for rid, resource := range debugger.Env.Resources {
+        base := resource.GetResourceBase()
+        resources = append(resources, ResourceState{Id: rid, Amount: base.Amount, Capacity: base.Capacity, Queue: len(base.Queue)})
+    }
+    sort.Slice(resources, func(i, j int) bool { return resources[i].Id < resources[j].Id })
+    return resources
+}
+
+func (debugger *Debugger) PrintQueues(w io.Writer) {
+    fmt.Fprintf(w, "%12s%24s%8s  %s\n", "Kind", "Id", "Size", "Entities")
+    for _, queue := range debugger.GetQueues() {
+        fmt.Fprintf(w, "%12s%24.24s%8d  %s\n", queue.Kind, queue.Id, len(queue.Entities), strings.Join(queue.Entities, ", "))
+    }
+}
+
+func (debugger *Debugger) PrintOngoing(w io.Writer) {
+    env := debugger.Env
+    fmt.Fprintf(w, "%24s%24s%32s\n", "Process", "Entity", "Ends")
+    for _, ongoing := range debugger.GetOngoing() {
+        fmt.Fprintf(w, "%24.24s%24.24s%32s\n", ongoing.Process, ongoing.Entity, env.GetHumanTime(ongoing.DateEnd))
+    }
+}
+
+func (debugger *Debugger) PrintResources(w io.Writer) {
+    fmt.Fprintf(w, "%24s%12s%12s%8s\n", "Resource", "Amount", "Capacity", "Queue")
+    for _, resource := range debugger.GetResources() {
+        fmt.Fprintf(w, "%24.24s%12.2f%12.2f%8d\n", resource.Id, resource.Amount, resource.Capacity, resource.Queue)
+    }
+}
+
+func (debugger *Debugger) PrintStatus(w io.Writer) {
+    if !debugger.Started {
+        fmt.Fprintf(w, "[NOT STARTED]\n")
+        return
+    }
+    
+    fmt.Fprintf(w, "[SIMULATION CLOCK] %s\n", debugger.Env.GetHumanTime(debugger.Env.Now))
+    for _, reason := range debugger.Reasons {
+        fmt.Fprintf(w, "[BREAK] %s\n", reason)
+    }
+    if debugger.Ended {
+        fmt.Fprintf(w, "[SIMULATION ENDED]\n")
+    }
+}
+
+const DebuggerHelp = `step [n]                  run n steps (1 by default)
+until <time>              run until a time, like 90, 15min or 2h
+continue                  run until a breakpoint is hit
+break enter <id> [entity] break when an entity enters a process, hold,
+                          conveyor or transporter (quote ids with spaces:
+                          "UNLOAD North")
+break queue <id> <n>      break when a queue is longer than n
+delete <breakpoint>       remove a breakpoint
+breakpoints               list breakpoints
+queues                    show queues that are not empty
+ongoing                   show processes being executed
+resources                 show resources
+status                    show the clock and the last breakpoints hit
+quit                      stop debugging
+`
+
+// Execute runs a debugger command (see DebuggerHelp) and writes its output
+// to w. Returns false on quit.
+func (debugger *Debugger) Execute(command string, w io.Writer) bool {
+    args := SplitCommand(command)
+    if len(args) == 0 {
+        return true
+    }
+    
+    if args[0] == "quit" || args[0] == "q" {
+        return false
+    } else if args[0] == "step" || args[0] == "s" {
+        n := 1
+        if len(args) > 1 {
+            var err error
+            n, err = strconv.Atoi(args[1])
+            if err != nil {
+                fmt.Fprintln(w, err)
+                return true
+            }
+            if n <= 0 {
+                fmt.Fprintf(w, "invalid number of steps: %d\n", n)
+                return true
+            }
+        }
+        for i := 0; i < n && debugger.Step(); i++ {
+            if debugger.IsBroken() {
+                break
+            }
+        }
+        debugger.PrintStatus(w)
+    } else if (args[0] == "until" || args[0] == "u") && len(args) > 1 {
+        date, err := ParseModelDuration(args[1])
+        if err != nil {
+            fmt.Fprintln(w, err)
+            return true
+        }
+        debugger.RunUntil(date)
+        debugger.PrintStatus(w)
+    } else if args[0] == "continue" || args[0] == "c" {
+        debugger.Continue()
+        debugger.PrintStatus(w)
+    } else if args[0] == "break" && len(args) > 2 && args[1] == "enter" {
+        entity := ""
+        if len(args) > 3 {
+            entity = strings.Join(args[3:], " ")
+        }
+        fmt.Fprintln(w, debugger.BreakOnEnter(args[2], entity))
+    } else if args[0] == "break" && len(args) > 3 && args[1] == "queue" {
+        size, err := strconv.Atoi(args[3])
+        if err != nil {
+            fmt.Fprintf(w, "invalid size: %s\n", args[3])
+            return true
+        }
+        fmt.Fprintln(w, debugger.BreakOnQueue(args[2], size))
+    } else if args[0] == "delete" && len(args) > 1 {
+        id, err := strconv.Atoi(args[1])
+        if err != nil {
+            fmt.Fprintln(w, err)
+            return true
+        }
+        if !debugger.RemoveBreakpoint(id) {
+            fmt.Fprintf(w, "breakpoint not found: %s\n", args[1])
+        }
+    } else if args[0] == "breakpoints" || args[0] == "b" {
+        for _, breakpoint := range debugger.Breakpoints {
+            fmt.Fprintln(w, breakpoint)
+        }
+    } else if args[0] == "queues" {
+        debugger.PrintQueues(w)
+    } else if args[0] == "ongoing" {
+        debugger.PrintOngoing(w)
+    } else if args[0] == "resources" {
+        debugger.PrintResources(w)
+    } else if args[0] == "status" {
+        debugger.PrintStatus(w)
+    } else {
+        fmt.Fprint(w, DebuggerHelp)
+    }
+    return true
+}
+
+// SplitCommand splits a command into words. Words with spaces, like most
+// process ids, can be quoted.
+func SplitCommand(command string) []string {
+    args := make([]string, 0)
+    word := strings.Builder{}
+    quoted := false
+    inWord := false
+    
+    for _, c := range command {
+        if c == '"' {
+            quoted = !quoted
+            inWord = true
+        } else if (c == ' ' || c == '\t') && !quoted {
+            if inWord {
+                args = append(args, word.String())
+                word.Reset()
+                inWord = false
+            }
+        } else {
+            word.WriteRune(c)
+            inWord = true
+        }
+    }
+    
+    if inWord {
+        args = append(args, word.String())
+    }
+    return args
+}
+
+// RunREPL reads commands from r until quit or the end of input.
+func (debugger *Debugger) RunREPL(r io.Reader, w io.Writer) {
+    scanner := bufio.NewScanner(r)
+    fmt.Fprint(w, "(sim) ")
+    for scanner.Scan() {
+        if !debugger.Execute(scanner.Text(), w) {
+            return
+        }
+        fmt.Fprint(w, "(sim) ")
+    }
+}
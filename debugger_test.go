@@ -0,0 +1,54 @@
+package sim
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+// Five boxes get to the belt at 0 s, where the first boards and four wait.
+// The first gets to the dock and requests the truck at 4 s.
+func TestDebuggerExecute(t *testing.T) {
+    env := NewEnvironment()
+    env.EndDate = 200
+    BuildYard(env, 5)
+    debugger := NewDebugger(env)
+    
+    steps := []struct {
+        command     string
+        output      string
+        now         float64
+    }{
+        {"break enter Truck", "#1 enter Truck, 0 hits\n", 0},
+        {"break queue Belt 3", "#2 queue Belt > 3, 0 hits\n", 0},
+        {"step 0", "invalid number of steps: 0\n", 0},
+        {"step -3", "invalid number of steps: -3\n", 0},
+        {"step x", "invalid syntax\n", 0},
+        {"delete x", "invalid syntax\n", 0},
+        {"break queue Belt x", "invalid size: x\n", 0},
+        {"continue", "[BREAK] #2 queue of Belt is 4\n", 1},
+        {"continue", "[BREAK] #1 Box 0 entered Truck\n", 4},
+        {"delete 1", "", 4},
+        {"delete 1", "breakpoint not found: 1\n", 4},
+        {"until 60", "[SIMULATION CLOCK] 0d 00:01:01.00\n", 61},
+        {"continue", "[SIMULATION ENDED]\n", 200},
+    }
+    
+    for _, step := range steps {
+        var buf bytes.Buffer
+        if !debugger.Execute(step.command, &buf) {
+            t.Fatalf("%s: quit", step.command)
+        }
+        
+        if !strings.HasSuffix(buf.String(), step.output) {
+            t.Errorf("%s: got %q, want it to end with %q", step.command, buf.String(), step.output)
+        }
+        if env.Now != step.now {
+            t.Errorf("%s: got the clock at %g, want %g", step.command, env.Now, step.now)
+        }
+    }
+    
+    if len(debugger.Breakpoints) != 1 || debugger.Breakpoints[0].Hits != 1 {
+        t.Errorf("got breakpoints %v, want only #2 with 1 hit", debugger.Breakpoints)
+    }
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+    "log"
+    "github.com/nidoro/sim"
+)
+
+func main() {
+    env, err := sim.LoadModel("model.yaml")
+    if err != nil {
+        log.Fatal(err)
+    }
+    
+    env.LogLevel = 1
+    env.Run()
+    env.PrintProcessesStatistics("Unloading")
+    env.PrintProcessesStatistics("Unnamed")
+}
@@ -2,20 +2,21 @@ package main
 
 import (
     "github.com/nidoro/sim"
-    "os"
+    "encoding/gob"
     "fmt"
     "log"
-    "strconv"
-    "encoding/csv"
     "math"
-    "math/rand"
-    "strings"
+    "os"
     "slices"
-    "github.com/RyanCarrier/dijkstra"
+    "strings"
+    "time"
+    _ "time/tzdata"
+    "github.com/nidoro/sim/analysis"
+    "github.com/nidoro/sim/data"
+    "github.com/nidoro/sim/network"
     //"github.com/kr/pretty"
 )
 
-var NumDays [12]int = [12]int{31, 28, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
 var MonthName [12]string = [12]string{
     "Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Ago", "Sep", "Oct", "Nov", "Dec",
 }
@@ -42,41 +43,48 @@ type Commodity struct {
 // WeighingOut      Normal(1.2, 0.1)
 
 type Terminal struct {
-    Id                      string
+    Id                      string `data:"Terminal"`
     MonthExports            map[string]*[12]float64
     AnnualExports           map[string]float64
     Sazonality              map[string]*[12]float64
     NumTrucks               map[string]*[12]int
-    Storage                 float64
-    ProcessingRate          float64
-    
-    // simulated
-    Exports                 map[string]*[12]float64
+    Storage                 float64 `data:"Armazenagem,unit=kt"`
+    ProcessingRate          float64 `data:"Vazão,unit=kt"`
 }
 
 type CommodityProductivityInHarbor struct {
-    DWT             float64
-    OperatingTime   float64
-    IdleTime        float64
-    DockingTime     float64
-    Productivity    float64
+    HarborId        string  `data:"Porto"`
+    DWT             float64 `data:"DWT (kt),unit=kt"`
+    OperatingTime   float64 `data:"Tempo operação (h),unit=h"`
+    IdleTime        float64 `data:"Tempo inoperante (h),unit=h"`
+    DockingTime     float64 `data:"Tempo atracação (h),unit=h"`
+    Productivity    float64 `data:"Produtividade (t/h),unit=t/h"`
+}
+
+// Monthly exports (kt) of a terminal or harbor
+type MonthlyExports struct {
+    Id              string      `data:"#1"`
+    Months          [12]float64 `data:"#2:#13,unit=kt,default=0"`
+}
+
+type RailSegment struct {
+    From            string  `data:"Pátio A"`
+    To              string  `data:"Pátio B"`
+    Length          float64 `data:"Extensão (km)"`
 }
 
 type Harbor struct {
-    Id                      string
+    Id                      string `data:"Porto"`
     MonthExports            map[string]*[12]float64
     AnnualExports           map[string]float64
     Sazonality              map[string]*[12]float64
     NumShips                map[string]*[12]int
-    Storage                 float64
-    Docks                   float64
-    DockingInterval         float64
-    ProcessingRate          float64
+    Storage                 float64 `data:"Armazenagem (kt),unit=kt"`
+    Docks                   float64 `data:"Berços"`
+    DockingInterval         float64 `data:"Intervalo entre atracações (h),unit=h"`
+    ProcessingRate          float64 `data:"Vazão (t/h),unit=kt"`
     Productivity            map[string]*CommodityProductivityInHarbor
     ShipDWTRNG              sim.RNGDiscrete
-    
-    // simulated
-    Exports                 map[string]*[12]float64
 }
 
 type Truck struct {
@@ -94,7 +102,6 @@ type Train struct {
     Direction   string
     Capacity    float64
     Load        float64
-    TravelPlan    []string
 }
 
 type Ship struct {
@@ -104,6 +111,12 @@ type Ship struct {
     DWT         float64
 }
 
+func init() {
+    sim.RegisterEntity("expograo.Truck", &Truck{})
+    sim.RegisterEntity("expograo.Train", &Train{})
+    sim.RegisterEntity("expograo.Ship", &Ship{})
+}
+
 func ForwardToReception(entity sim.Entity) {
     env := entity.GetEnvironment()
     truck := sim.Cast[*Truck](entity)
@@ -116,56 +129,47 @@ func ForwardToClassification(entity sim.Entity) {
     env.ForwardTo(truck, fmt.Sprintf("CLA %s", truck.TerminalId))
 }
 
-func ForwardToNextStation(entity sim.Entity) {
-    env := entity.GetEnvironment()
-    train := sim.Cast[*Train](entity)
-    
-    if len(train.TravelPlan) > 0 {
-        nextRailSection := train.TravelPlan[0]
-        train.TravelPlan = train.TravelPlan[1:]
-        env.ForwardTo(train, fmt.Sprintf(nextRailSection))
-    } else if train.Direction == "import" {
-        env.ForwardTo(train, fmt.Sprintf("LDTR %s", train.TerminalId))
-    } else if train.Direction == "export" {
-        env.ForwardTo(train, fmt.Sprintf("UNTR %s %s", train.HarborId, "Corn"))
+// TravelTo moves the train through the railway. Stations without a known
+// rail path are reached right away.
+func (model *Model) TravelTo(train *Train, from string, to string, then string) {
+    if _, ok := model.Rail.ShortestPath(from, to); ok {
+        model.Rail.Move(train, from, to, then)
+    } else {
+        train.GetEnvironment().ForwardTo(train, then)
     }
 }
 
-func ForwardToSomeHarbor(entity sim.Entity) {
+func (model *Model) ForwardToSomeHarbor(entity sim.Entity) {
     train := sim.Cast[*Train](entity)
     env := train.GetEnvironment()
     train.Load = train.Capacity
-    terminal := g.Terminals[train.TerminalId]
-    terminal.Exports[train.CommodityId][env.GetCurrentMonth()] += train.Load
+    env.IncVariable(GetExportsVariable("Terminal", train.TerminalId, train.CommodityId), train.Load)
     
     train.Direction = "export"
     
     harborOptions := []string{"Paranaguá", "São Francisco", "Rio Grande"}
-    train.HarborId = harborOptions[rand.Intn(len(harborOptions))]
+    train.HarborId = harborOptions[env.Rand.Intn(len(harborOptions))]
     
-    train.HarborId = train.HarborId
-    train.TravelPlan = slices.Clone(g.TravelPlans[train.TerminalId][train.HarborId])
-    ForwardToNextStation(train)
+    model.TravelTo(train, train.TerminalId, train.HarborId, fmt.Sprintf("UNTR %s %s", train.HarborId, "Corn"))
 }
 
-func ForwardToSomeTerminal(entity sim.Entity) {
+func (model *Model) ForwardToSomeTerminal(entity sim.Entity) {
     train := sim.Cast[*Train](entity)
     env := entity.GetEnvironment()
-    harbor := g.Harbors[train.HarborId]
-    harbor.Exports[train.CommodityId][env.GetCurrentMonth()] += train.Load
+    env.IncVariable(GetExportsVariable("Harbor", train.HarborId, train.CommodityId), train.Load)
     
     train.Direction = "import"
     
     terminalOptions := []string{"Londrina", "Marialva", "Maringá", "Cascavel", "Cruz Alta", "J.Castilhos", "Cacequi"}
-    train.TerminalId = terminalOptions[rand.Intn(len(terminalOptions))]
+    train.TerminalId = terminalOptions[env.Rand.Intn(len(terminalOptions))]
     
     train.Load = 0
-    train.TravelPlan = slices.Clone(g.TravelPlans[train.HarborId][train.TerminalId])
-    ForwardToNextStation(train)
+    model.TravelTo(train, train.HarborId, train.TerminalId, fmt.Sprintf("LDTR %s", train.TerminalId))
 }
 
 type TruckSource struct {
     sim.EntitySourceBase
+    Model           *Model
     TerminalId      string
     CommodityId     string
     Month           int
@@ -173,6 +177,7 @@ type TruckSource struct {
 
 type ShipSource struct {
     sim.EntitySourceBase
+    Model           *Model
     HarborId        string
     CommodityId     string
     Month           int
@@ -183,7 +188,7 @@ func (source *TruckSource) Generate() sim.Entity {
     truck := &Truck{
         TerminalId: source.TerminalId,
         CommodityId: source.CommodityId,
-        Load: g.TruckCapacity,
+        Load: source.Model.TruckCapacity,
     }
     
     env.AddEntity("Truck", truck)
@@ -194,7 +199,7 @@ func (source *TruckSource) Generate() sim.Entity {
 
 func (source *ShipSource) Generate() sim.Entity {
     env := source.GetEnvironment()
-    harbor := g.Harbors[source.HarborId]
+    harbor := source.Model.Harbors[source.HarborId]
     
     ship := &Ship{
         HarborId: source.HarborId,
@@ -211,99 +216,81 @@ func (source *ShipSource) Generate() sim.Entity {
     return ship
 }
 
-type Global struct {
+// Model holds the data of a replication of the model. Each environment
+// gets its own, so replications can run in parallel.
+type Model struct {
     Env             *sim.Environment
     Commodities     map[string]*Commodity
     Terminals       map[string]*Terminal
     Harbors         map[string]*Harbor
-    RailSections    map[string]map[string]float64
-    TravelPlans     map[string]map[string][]string
+    Rail            *network.Network
+    Data            *data.Catalog
+    TrainSpeed      float64
     TruckCapacity   float64
+    Year            int
 }
 
-var g Global
-
 func Check(err error) {
     if err != nil {
         log.Fatalf("ERROR: %s", err)
     }
 }
 
-func ReadTerminalExports(commId string, filePath string) {
-    file, err := os.Open(filePath)
-    Check(err)
-    defer file.Close()
-
-    reader := csv.NewReader(file)
-    reader.Comma = '\t'
-    records, err := reader.ReadAll()
+// ReadMonthlyExports reads a table of exports per month, without its totals
+func (model *Model) ReadMonthlyExports(tableName string) []MonthlyExports {
+    table, err := model.Data.Get(tableName)
     Check(err)
     
-    g.Commodities[commId] = &Commodity{}
-    g.Commodities[commId].Id = commId
+    var exports []MonthlyExports
+    Check(table.Exclude("#1", "TOTAL").Decode(&exports))
+    return exports
+}
+
+func (model *Model) ReadTerminalExports(commId string, tableName string) {
+    model.Commodities[commId] = &Commodity{}
+    model.Commodities[commId].Id = commId
     
-    for _, row := range records[1:len(records)-1] {
-        tid := row[0]
-        terminal := g.Terminals[tid]
+    for _, row := range model.ReadMonthlyExports(tableName) {
+        tid := row.Id
+        terminal := model.Terminals[tid]
         terminal.MonthExports[commId] = &[12]float64{}
         terminal.Sazonality[commId] = &[12]float64{}
         terminal.NumTrucks[commId] = &[12]int{}
-        terminal.Exports[commId] = &[12]float64{}
         terminal.AnnualExports[commId] = 0
         
-        for mon, col := range row[1:len(row)-1] {
-            value, err := strconv.ParseFloat(col, 64)
-            terminal.Sazonality[commId][mon] = 0.0
-            terminal.MonthExports[commId][mon] = 0.0
-            if err == nil {
-                terminal.MonthExports[commId][mon] = value*KTon
-                terminal.AnnualExports[commId] += value*KTon
-            }
+        for mon, value := range row.Months {
+            terminal.MonthExports[commId][mon] = value
+            terminal.AnnualExports[commId] += value
         }
     }
     
     for m := 0; m < 12; m++ {
-        for _, terminal := range g.Terminals {
+        for _, terminal := range model.Terminals {
             for cid, _ := range terminal.MonthExports {
                 terminal.Sazonality[cid][m] = terminal.MonthExports[cid][m] / terminal.AnnualExports[cid]
-                terminal.NumTrucks[cid][m] = int(math.Ceil((terminal.AnnualExports[cid] * terminal.Sazonality[cid][m]) / g.TruckCapacity))
+                terminal.NumTrucks[cid][m] = int(math.Ceil((terminal.AnnualExports[cid] * terminal.Sazonality[cid][m]) / model.TruckCapacity))
             }
         }
     }
 }
 
-func ReadHarborExports(cid string, filePath string) {
-    file, err := os.Open(filePath)
-    Check(err)
-    defer file.Close()
-
-    reader := csv.NewReader(file)
-    reader.Comma = '\t'
-    records, err := reader.ReadAll()
-    Check(err)
-    
-    for _, row := range records[1:len(records)-1] {
-        hid := row[0]
-        harbor := g.Harbors[hid]
+func (model *Model) ReadHarborExports(cid string, tableName string) {
+    for _, row := range model.ReadMonthlyExports(tableName) {
+        hid := row.Id
+        harbor := model.Harbors[hid]
         harbor.MonthExports[cid] = &[12]float64{}
         harbor.Sazonality[cid] = &[12]float64{}
         harbor.NumShips[cid] = &[12]int{}
         harbor.AnnualExports[cid] = 0
-        harbor.Exports[cid] = &[12]float64{}
-        
-        for mon, col := range row[1:len(row)-1] {
-            value, err := strconv.ParseFloat(col, 64)
-            harbor.Sazonality[cid][mon] = 0.0
-            harbor.MonthExports[cid][mon] = 0.0
-            if err == nil {
-                harbor.MonthExports[cid][mon] = value*KTon
-                harbor.AnnualExports[cid] += value*KTon
-            }
+        
+        for mon, value := range row.Months {
+            harbor.MonthExports[cid][mon] = value
+            harbor.AnnualExports[cid] += value
         }
     }
     
     for m := 0; m < 12; m++ {
-        for _, harbor := range g.Harbors {
+        for _, harbor := range model.Harbors {
             for cid, _ := range harbor.MonthExports {
                 harbor.Sazonality[cid][m] = harbor.MonthExports[cid][m] / harbor.AnnualExports[cid]
                 harbor.NumShips[cid][m] = int(math.Ceil((harbor.AnnualExports[cid] * harbor.Sazonality[cid][m]) / harbor.Productivity[cid].DWT))
@@ -312,41 +299,22 @@ func ReadHarborExports(cid string, filePath string) {
     }
 }
 
-func ReadHarborCommodityProductivity(cid string, filePath string) {
-    file, err := os.Open(filePath)
-    Check(err)
-    defer file.Close()
-
-    reader := csv.NewReader(file)
-    reader.Comma = '\t'
-    records, err := reader.ReadAll()
-    Check(err)
+func (model *Model) ReadHarborCommodityProductivity(cid string, tableName string) {
+    var productivities []*CommodityProductivityInHarbor
+    Check(model.Data.Decode(tableName, &productivities))
     
-    for _, row := range records[1:len(records)] {
-        hid := row[0]
-        
-        harbor := g.Harbors[hid]
-        prod := &CommodityProductivityInHarbor{}
-        prod.DWT, _ = strconv.ParseFloat(row[1], 64)
-        prod.OperatingTime, _ = strconv.ParseFloat(row[2], 64)
-        prod.IdleTime, _ = strconv.ParseFloat(row[3], 64)
-        prod.DockingTime, _ = strconv.ParseFloat(row[4], 64)
-        prod.Productivity, _ = strconv.ParseFloat(row[5], 64)
-        
-        prod.DWT *= KTon
-        prod.OperatingTime *= Hours
-        prod.IdleTime *= Hours
-        prod.DockingTime *= Hours
-        prod.Productivity /= Hours
+    for _, prod := range productivities {
+        hid := prod.HarborId
         
+        harbor := model.Harbors[hid]
         harbor.Productivity[cid] = prod
         
         resources := math.Ceil((prod.DWT / prod.Productivity) / Days)+2
         
         // Ship processes
         //-----------------------
-        g.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("DOCK %s", hid), Amount: resources})
-        g.Env.AddProcess(
+        model.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("DOCK %s", hid), Amount: resources})
+        model.Env.AddProcess(
             sim.ProcessBase{
                 Id: fmt.Sprintf("DOCK %s %s", cid, hid),
                 Groups: []string{"DOCK", hid},
@@ -359,8 +327,8 @@ func ReadHarborCommodityProductivity(cid string, filePath string) {
         
         // Train processes
         //------------------------
-        g.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("UNTR %s", hid), Amount: resources})
-        g.Env.AddProcess(
+        model.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("UNTR %s", hid), Amount: resources})
+        model.Env.AddProcess(
             sim.ProcessBase{
                 Id: fmt.Sprintf("UNTR %s %s", hid, cid),
                 Groups: []string{"UNTR", hid},
@@ -373,49 +341,44 @@ func ReadHarborCommodityProductivity(cid string, filePath string) {
                     delay := (train.Load / prod.Productivity)
                     return delay
                 },
-                Forward: ForwardToSomeTerminal,
+                Forward: model.ForwardToSomeTerminal,
             },
         )
     }
 }
 
-func ReadData() {
+func (model *Model) ReadData() {
+    model.Data = data.NewCatalog("data")
+    model.Data.Register("terminals", "terminals.tsv")
+    model.Data.Register("harbors", "harbors.tsv")
+    model.Data.Register("rail-segments", "segmentos-RMS.tsv")
+    model.Data.Register("harbor-corn-cap", "harbor-corn-cap.tsv")
+    model.Data.Register("harbor-soy-cap", "harbor-soy-cap.tsv")
+    model.Data.Register("corn", "corn.tsv")
+    model.Data.Register("soy", "soy.tsv")
+    model.Data.Register("harbor-corn-exports", "harbor-corn-exports-2022.tsv")
+    model.Data.Register("harbor-soy-exports", "harbor-soy-exports-2022.tsv")
+    
     // Load terminal data
     //---------------------
-    file, err := os.Open("data/terminals.tsv")
-    Check(err)
-    defer file.Close()
-
-    reader := csv.NewReader(file)
-    reader.Comma = '\t'
-    records, err := reader.ReadAll()
-    Check(err)
+    var terminals []*Terminal
+    Check(model.Data.Decode("terminals", &terminals))
     
-    for _, row := range records[1:len(records)] {
-        tid := row[0]
-        
-        terminal := &Terminal{
-            Id: tid,
-            MonthExports: make(map[string]*[12]float64),
-            Sazonality: make(map[string]*[12]float64),
-            NumTrucks: make(map[string]*[12]int),
-            Exports: make(map[string]*[12]float64),
-            AnnualExports: make(map[string]float64),
-        }
+    for _, terminal := range terminals {
+        tid := terminal.Id
         
-        terminal.Storage, _ = strconv.ParseFloat(row[1], 64)
-        terminal.ProcessingRate, _ = strconv.ParseFloat(row[2], 64)
-        
-        terminal.Storage *= KTon
-        terminal.ProcessingRate *= KTon
+        terminal.MonthExports = make(map[string]*[12]float64)
+        terminal.Sazonality = make(map[string]*[12]float64)
+        terminal.NumTrucks = make(map[string]*[12]int)
+        terminal.AnnualExports = make(map[string]float64)
         
         trucksPerMinuteCap := math.Ceil(terminal.ProcessingRate / 30 / 30 / 24 / 60)
         resources := trucksPerMinuteCap+1
         
         // Truck processes
         //------------------------
-        g.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("ARRI %s", tid), Amount: resources})
-        g.Env.AddProcess(
+        model.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("ARRI %s", tid), Amount: resources})
+        model.Env.AddProcess(
             sim.ProcessBase{
                 Id: fmt.Sprintf("ARRI %s", tid),
                 Groups: []string{"ARRI", tid},
@@ -427,8 +390,8 @@ func ReadData() {
             },
         )
         
-        g.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("RECP %s", tid), Amount: resources})
-        g.Env.AddProcess(
+        model.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("RECP %s", tid), Amount: resources})
+        model.Env.AddProcess(
             sim.ProcessBase{
                 Id: fmt.Sprintf("RECP %s", tid),
                 Groups: []string{"RECP", tid},
@@ -440,8 +403,8 @@ func ReadData() {
             },
         )
         
-        g.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("CLAS %s", tid), Amount: resources})
-        g.Env.AddProcess(
+        model.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("CLAS %s", tid), Amount: resources})
+        model.Env.AddProcess(
             sim.ProcessBase{
                 Id: fmt.Sprintf("CLAS %s", tid),
                 Groups: []string{"CLAS", tid},
@@ -453,8 +416,8 @@ func ReadData() {
             },
         )
         
-        g.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("UNTK %s", tid), Amount: resources})
-        g.Env.AddProcess(
+        model.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("UNTK %s", tid), Amount: resources})
+        model.Env.AddProcess(
             sim.ProcessBase{
                 Id: fmt.Sprintf("UNTK %s", tid),
                 Groups: []string{"UNTK", tid},
@@ -466,8 +429,8 @@ func ReadData() {
             },
         )
         
-        g.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("EXTK %s", tid), Amount: resources})
-        g.Env.AddProcess(
+        model.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("EXTK %s", tid), Amount: resources})
+        model.Env.AddProcess(
             sim.ProcessBase{
                 Id: fmt.Sprintf("EXTK %s", tid),
                 Groups: []string{"EXTK", tid},
@@ -480,8 +443,8 @@ func ReadData() {
         
         // Train processes
         //------------------------
-        g.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("LDTR %s", tid), Amount: 1})
-        g.Env.AddProcess(
+        model.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("LDTR %s", tid), Amount: 1})
+        model.Env.AddProcess(
             sim.ProcessBase{
                 Id: fmt.Sprintf("LDTR %s", tid),
                 Groups: []string{"LDTR", tid},
@@ -489,212 +452,121 @@ func ReadData() {
                     fmt.Sprintf("LDTR %s", tid): 1,
                 },
                 RNG: sim.NewRNGNormal(1.2*Minutes, 0.1*Minutes),
-                Forward: ForwardToSomeHarbor,
+                Forward: model.ForwardToSomeHarbor,
             },
         )
         
-        g.Terminals[tid] = terminal
+        model.Terminals[tid] = terminal
     }
     
     // Load harbor data
     //---------------------
-    file, err = os.Open("data/harbors.tsv")
-    Check(err)
-    defer file.Close()
-
-    reader = csv.NewReader(file)
-    reader.Comma = '\t'
-    records, err = reader.ReadAll()
-    Check(err)
-    
-    for _, row := range records[1:len(records)] {
-        hid := row[0]
-        
-        harbor := &Harbor{
-            Id: hid,
-            MonthExports: make(map[string]*[12]float64),
-            Sazonality: make(map[string]*[12]float64),
-            NumShips: make(map[string]*[12]int),
-            AnnualExports: make(map[string]float64),
-            Exports: make(map[string]*[12]float64),
-            Productivity: make(map[string]*CommodityProductivityInHarbor),
-            ShipDWTRNG: *sim.NewRNGDiscrete([]float64{0.1, 0.55, 0.35}),
-        }
-        
-        harbor.Storage, _ = strconv.ParseFloat(row[1], 64)
-        harbor.Docks, _ = strconv.ParseFloat(row[2], 64)
-        harbor.DockingInterval, _ = strconv.ParseFloat(row[3], 64)
-        harbor.ProcessingRate, _ = strconv.ParseFloat(row[4], 64)
-        
-        harbor.Storage *= KTon
-        harbor.DockingInterval *= Hours
-        harbor.ProcessingRate *= KTon
-        
-        g.Harbors[hid] = harbor
+    var harbors []*Harbor
+    Check(model.Data.Decode("harbors", &harbors))
+    
+    for _, harbor := range harbors {
+        harbor.MonthExports = make(map[string]*[12]float64)
+        harbor.Sazonality = make(map[string]*[12]float64)
+        harbor.NumShips = make(map[string]*[12]int)
+        harbor.AnnualExports = make(map[string]float64)
+        harbor.Productivity = make(map[string]*CommodityProductivityInHarbor)
+        harbor.ShipDWTRNG = *sim.NewRNGDiscrete([]float64{0.1, 0.55, 0.35})
+        
+        model.Harbors[harbor.Id] = harbor
     }
     
     // Load railway segments
     //--------------------------
-    file, err = os.Open("data/segmentos-RMS.tsv")
-    Check(err)
-    defer file.Close()
-
-    reader = csv.NewReader(file)
-    reader.Comma = '\t'
-    records, err = reader.ReadAll()
-    Check(err)
-    
-    for _, row := range records[1:len(records)] {
-        p1 := strings.Split(row[0], ",")[0]
-        p2 := strings.Split(row[1], ",")[0]
-        
-        a, ok := g.RailSections[p1]
-        if !ok {
-            a = make(map[string]float64)
-            g.RailSections[p1] = a
-        }
-        
-        a[p2], _ = strconv.ParseFloat(row[2], 64)
-        
-        b, ok := g.RailSections[p2]
-        if !ok {
-            b = make(map[string]float64)
-            g.RailSections[p2] = b
-        }
-        
-        b[p1], _ = strconv.ParseFloat(row[2], 64)
-    }
-    
-    //pretty.Println(g.RailSections)
-    
-    for id1, _ := range g.RailSections {
-        for id2, _ := range g.RailSections {
-            g.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("RAIL %s %s", id1, id2), Amount: 1})
-            g.Env.AddResource(&sim.ResourceBase{Id: fmt.Sprintf("RAIL %s %s", id2, id1), Amount: 1})
-            
-            g.Env.AddProcess(
-                sim.ProcessBase{
-                    Id: fmt.Sprintf("TRAV %s %s", id1, id2),
-                    Groups: []string{"TRAV"},
-                    Needs: map[string]float64{
-                        fmt.Sprintf("RAIL %s %s", id1, id2): 1,
-                        fmt.Sprintf("RAIL %s %s", id2, id1): 1,
-                    },
-                    RNG: sim.NewRNGTriangular(8*Minutes, 12*Minutes, 10*Minutes),
-                    Forward: ForwardToNextStation,
-                },
-            )
-            
-            g.Env.AddProcess(
-                sim.ProcessBase{
-                    Id: fmt.Sprintf("TRAV %s %s", id2, id1),
-                    Groups: []string{"TRAV"},
-                    Needs: map[string]float64{
-                        fmt.Sprintf("RAIL %s %s", id1, id2): 1,
-                        fmt.Sprintf("RAIL %s %s", id2, id1): 1,
-                    },
-                    RNG: sim.NewRNGTriangular(8*Minutes, 12*Minutes, 10*Minutes),
-                    Forward: ForwardToNextStation,
-                },
-            )
-        }
-    }
-    
-    
-    // Calculate shortest paths
-    //-------------------------------
-    graph := dijkstra.NewGraph()
-    stations := []string{}
-    
-    GetIndex := func(id string) int {
-        for i, _ := range stations {
-            if id == stations[i] {
-                return i
-            }
-        }
-        return -1
-    }
-    
-    for id, _ := range g.RailSections {
-        graph.AddVertex(len(stations))
-        stations = append(stations, id)
-    }
-    
-    for i, id1 := range stations {
-        for id2, _ := range g.RailSections[id1] {
-            j := GetIndex(id2)
-            graph.AddArc(i, j, int64(g.RailSections[id1][id2] * 1000))
-        }
-    }
+    var segments []RailSegment
+    Check(model.Data.Decode("rail-segments", &segments))
     
-    origins := []string{"Londrina", "Marialva", "Maringá"}
-    destinations := []string{"Paranaguá", "Rio Grande", "São Francisco"}
+    model.Rail = network.NewNetwork("RAIL")
     
-    for _, origin := range origins {
-        g.TravelPlans[origin] = map[string][]string{}
+    for _, segment := range segments {
+        p1 := strings.Split(segment.From, ",")[0]
+        p2 := strings.Split(segment.To, ",")[0]
         
-        for _, destination := range destinations {
-            path1, _ := graph.Shortest(GetIndex(origin), GetIndex(destination))
-            path2, _ := graph.Shortest(GetIndex(destination), GetIndex(origin))
-            
-            travelPlan := []string{}
-            
-            for i := 0; i < len(path1.Path)-1; i++ {
-                travelPlan = append(travelPlan, fmt.Sprintf("TRAV %s %s", stations[path1.Path[i]], stations[path1.Path[i+1]]))
-            }
-            
-            g.TravelPlans[origin][destination] = travelPlan
-            
-            travelPlan = []string{}
-            
-            for i := 0; i < len(path2.Path)-1; i++ {
-                travelPlan = append(travelPlan, fmt.Sprintf("TRAV %s %s", stations[path2.Path[i]], stations[path2.Path[i+1]]))
-            }
-            
-            _, ok := g.TravelPlans[destination]
-            if !ok {
-                g.TravelPlans[destination] = map[string][]string{}
-            }
-            
-            g.TravelPlans[destination][origin] = travelPlan
-        }
+        model.Rail.AddEdge(network.Link{From: p1, To: p2, Length: segment.Length, Speed: model.TrainSpeed, Capacity: 1})
     }
     
+    model.Rail.Build(model.Env)
+    
     for i := 0; i < 10; i++ {
         harborOptions := []string{"Paranaguá", "São Francisco", "Rio Grande"}
-        harborId := harborOptions[rand.Intn(len(harborOptions))]
+        harborId := harborOptions[model.Env.Rand.Intn(len(harborOptions))]
         
         terminalOptions := []string{"Londrina", "Marialva", "Maringá", "Cascavel", "Cruz Alta", "J.Castilhos", "Cacequi"}
-        terminalId := terminalOptions[rand.Intn(len(terminalOptions))]
-    
+        terminalId := terminalOptions[model.Env.Rand.Intn(len(terminalOptions))]
+        
         train := &Train{
             TerminalId: terminalId,
             HarborId: harborId,
             Capacity: 50,
             CommodityId: "Corn",
-            TravelPlan: slices.Clone(g.TravelPlans[harborId][terminalId]),
             Direction: "import",
         }
         
-        g.Env.AddEntity("Train", train)
-        ForwardToNextStation(train)
+        model.Env.AddEntity("Train", train)
+        model.TravelTo(train, harborId, terminalId, fmt.Sprintf("LDTR %s", terminalId))
     }
     
-    ReadHarborCommodityProductivity("Corn", "data/harbor-corn-cap.tsv")
-    ReadHarborCommodityProductivity("Soy", "data/harbor-soy-cap.tsv")
+    model.ReadHarborCommodityProductivity("Corn", "harbor-corn-cap")
+    model.ReadHarborCommodityProductivity("Soy", "harbor-soy-cap")
     
-    ReadTerminalExports("Corn", "data/corn.tsv")
-    ReadTerminalExports("Soy", "data/soy.tsv")
+    model.ReadTerminalExports("Corn", "corn")
+    model.ReadTerminalExports("Soy", "soy")
     
-    ReadHarborExports("Corn", "data/harbor-corn-exports-2022.tsv")
-    ReadHarborExports("Soy", "data/harbor-soy-exports-2022.tsv")
+    model.ReadHarborExports("Corn", "harbor-corn-exports")
+    model.ReadHarborExports("Soy", "harbor-soy-exports")
     
-    //pretty.Println(g.Harbors)
+    //pretty.Println(model.Harbors)
+}
+
+// GetExportsVariable returns the variable with the running total of a
+// commodity exported by a terminal or harbor.
+func GetExportsVariable(kind string, id string, cid string) string {
+    return fmt.Sprintf("%s Exports %s %s", kind, id, cid)
 }
 
-func PrintExports() {
+// AddExportsMonitors monitors the exports of every terminal and harbor,
+// so that they can be compared with the historical data by month.
+func (model *Model) AddExportsMonitors() {
+    ids := make([]string, 0)
+    for tid, terminal := range model.Terminals {
+        for cid, _ := range terminal.MonthExports {
+            ids = append(ids, GetExportsVariable("Terminal", tid, cid))
+        }
+    }
+    for hid, harbor := range model.Harbors {
+        for cid, _ := range harbor.MonthExports {
+            ids = append(ids, GetExportsVariable("Harbor", hid, cid))
+        }
+    }
+    
+    slices.Sort(ids)
+    for _, id := range ids {
+        model.Env.MonitorVariable(id, 0)
+    }
+}
+
+// GetMonthlyExports returns the simulated exports of a terminal or harbor
+// by month of the year.
+func (model *Model) GetMonthlyExports(kind string, id string, cid string) [12]float64 {
+    exports := [12]float64{}
+    monitor := model.Env.GetMonitor(sim.GetResultsKey("Monitor", GetExportsVariable(kind, id, cid), "Value"))
+    if monitor == nil {
+        return exports
+    }
+    
+    for _, period := range monitor.Aggregate(model.Env, sim.Period_Month) {
+        exports[int(model.Env.GetDate(period.Start).Month()) - 1] += period.Change
+    }
+    return exports
+}
+
+func (model *Model) PrintExports() {
     // Print terminal exports
-    for cid, _ := range g.Commodities {
+    for cid, _ := range model.Commodities {
         fmt.Printf("[TERMINAL EXPORTS] (%s kt)\n", cid)
         
         fmt.Printf("%24s", "Terminal")
@@ -705,11 +577,12 @@ func PrintExports() {
         
         fmt.Println()
         
-        for tid, terminal := range g.Terminals {
+        for tid, _ := range model.Terminals {
             fmt.Printf("%24s", tid)
             
+            exports := model.GetMonthlyExports("Terminal", tid, cid)
             for m := 0; m < 12; m++ {
-                fmt.Printf("%9.2f", terminal.Exports[cid][m] / KTon)
+                fmt.Printf("%9.2f", exports[m] / KTon)
             }
             
             fmt.Println()
@@ -719,7 +592,7 @@ func PrintExports() {
     }
     
     // Print harbor exports
-    for cid, _ := range g.Commodities {
+    for cid, _ := range model.Commodities {
         fmt.Printf("[HARBOR EXPORTS] (%s kt)\n", cid)
         
         fmt.Printf("%24s", "Harbor")
@@ -730,11 +603,12 @@ func PrintExports() {
         
         fmt.Println()
         
-        for hid, harbor := range g.Harbors {
+        for hid, _ := range model.Harbors {
             fmt.Printf("%24s", hid)
             
+            exports := model.GetMonthlyExports("Harbor", hid, cid)
             for m := 0; m < 12; m++ {
-                fmt.Printf("%9.2f", harbor.Exports[cid][m] / KTon)
+                fmt.Printf("%9.2f", exports[m] / KTon)
             }
             
             fmt.Println()
@@ -744,57 +618,73 @@ func PrintExports() {
     }
 }
 
-func main() {
-    g.Commodities = make(map[string]*Commodity)
-    g.Terminals = make(map[string]*Terminal)
-    g.Harbors = make(map[string]*Harbor)
-    g.RailSections = make(map[string]map[string]float64)
-    g.TravelPlans = make(map[string]map[string][]string)
-    g.TruckCapacity = 30
+// BuildModel reads the data of the model and adds its processes, sources
+// and trains to env.
+func BuildModel(env *sim.Environment) *Model {
+    model := &Model{
+        Env: env,
+        Commodities: make(map[string]*Commodity),
+        Terminals: make(map[string]*Terminal),
+        Harbors: make(map[string]*Harbor),
+        TruckCapacity: 30,
+        Year: 2022,
+        TrainSpeed: 40 / Hours, // km/s
+    }
     
-    g.Env = sim.NewEnvironment()
+    location, err := time.LoadLocation("America/Sao_Paulo")
+    Check(err)
+    env.StartTime = time.Date(model.Year, time.January, 1, 0, 0, 0, 0, location)
     
-    ReadData()
+    model.ReadData()
+    model.AddExportsMonitors()
     
-    day := 0
+    // sources are added in order, so that they get the same RNGs in every
+    // build and snapshots can be restored
     for m := 0; m < 12; m++ {
-        for tid, terminal := range g.Terminals {
-            for cid, _ := range g.Commodities {
+        monthStart := env.GetMonthStart(model.Year, m)
+        monthDays := float64(sim.GetDaysInMonth(model.Year, m))
+        
+        for _, tid := range sim.GetSortedKeys(model.Terminals) {
+            terminal := model.Terminals[tid]
+            for _, cid := range sim.GetSortedKeys(model.Commodities) {
                 if terminal.MonthExports[cid][m] > 0.0 {
-                    interval := float64(NumDays[m])*Days / float64(terminal.NumTrucks[cid][m])
+                    interval := monthDays*Days / float64(terminal.NumTrucks[cid][m])
                     sid := fmt.Sprintf("%s:%s:%d", tid, cid, m+1)
                     
-                    g.Env.AddEntitySource(&TruckSource{
+                    env.AddEntitySource(&TruckSource{
                         EntitySourceBase: sim.EntitySourceBase{
                             Id: sid, 
-                            NextGen: float64(day)*Days,
+                            NextGen: monthStart,
                             RNG: sim.NewRNGExponential(1/interval),
                             BatchSize: 1, 
                             MaxGenerations: terminal.NumTrucks[cid][m],
                         },
+                        Model: model,
                         TerminalId: tid,
                         CommodityId: cid,
                         Month: m,
                     })
                 }
-                
+            
             }
         }
         
-        for hid, harbor := range g.Harbors {
-            for cid, _ := range g.Commodities {
+        for _, hid := range sim.GetSortedKeys(model.Harbors) {
+            harbor := model.Harbors[hid]
+            for _, cid := range sim.GetSortedKeys(model.Commodities) {
                 if harbor.MonthExports[cid][m] > 0.0 {
-                    interval := float64(NumDays[m])*Days / float64(harbor.NumShips[cid][m])
+                    interval := monthDays*Days / float64(harbor.NumShips[cid][m])
                     sid := fmt.Sprintf("%s:%s:%d", hid, cid, m+1)
                     
-                    g.Env.AddEntitySource(&ShipSource{
+                    env.AddEntitySource(&ShipSource{
                         EntitySourceBase: sim.EntitySourceBase{
                             Id: sid, 
-                            NextGen: float64(day)*Days,
+                            NextGen: monthStart,
                             RNG: sim.NewRNGExponential(1/interval),
                             BatchSize: 1,
                             MaxGenerations: harbor.NumShips[cid][m],
                         },
+                        Model: model,
                         HarborId: hid,
                         CommodityId: cid,
                         Month: m,
@@ -802,28 +692,120 @@ func main() {
                 }
             }
         }
-        
-        day += NumDays[m]
     }
     
-    g.Env.LogLevel = 1
-    g.Env.StepThrough = false
-    g.Env.EndDate = 1*Days
-    
-    g.Env.Run()
-    g.Env.PrintProcessesStatistics("Londrina")
-    g.Env.PrintProcessesStatistics("Paranaguá")
-    
-    fmt.Println()
-    PrintExports()
+    return model
 }
 
+// SavedRun is a snapshot of a run of the model. The moves of the trains
+// are kept by the railway, outside the environment, so they are saved with
+// it.
+type SavedRun struct {
+    Env         *sim.Snapshot
+    Moves       map[int]*network.Move
+}
 
+// Save writes the state of the run, between steps, to path.
+func (model *Model) Save(path string) error {
+    snapshot, err := model.Env.GetSnapshot()
+    if err != nil {
+        return err
+    }
+    
+    file, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    
+    if err := gob.NewEncoder(file).Encode(SavedRun{Env: snapshot, Moves: model.Rail.Moves}); err != nil {
+        file.Close()
+        return err
+    }
+    return file.Close()
+}
 
+// Restore sets the state of a freshly built model to a run saved with
+// Save, so that running it continues where the saved run stopped.
+func (model *Model) Restore(path string) error {
+    file, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    
+    saved := SavedRun{}
+    if err := gob.NewDecoder(file).Decode(&saved); err != nil {
+        return err
+    }
+    
+    if err := model.Env.SetSnapshot(saved.Env); err != nil {
+        return err
+    }
+    
+    model.Rail.Moves = saved.Moves
+    if model.Rail.Moves == nil {
+        model.Rail.Moves = make(map[int]*network.Move)
+    }
+    return nil
+}
 
-
-
-
-
-
-
+func main() {
+    env := sim.NewEnvironment()
+    env.LogLevel = 1
+    env.StepThrough = false
+    env.EndDate = 1*Days
+    
+    model := BuildModel(env)
+    
+    // the run is saved at half of the day and continued
+    env.Begin()
+    for env.Now < 12*Hours && env.Advance() {}
+    Check(model.Save("half-day.snapshot"))
+    for env.Advance() {}
+    
+    env.PrintProcessesStatistics("Londrina")
+    env.PrintProcessesStatistics("Paranaguá")
+    
+    fmt.Println()
+    model.PrintExports()
+    
+    file, err := os.Create("exports.tsv")
+    Check(err)
+    Check(env.WriteMonitorsTable(file, sim.Period_Month, "Change"))
+    Check(file.Close())
+    
+    // Restoring
+    //---------------------
+    // a run restored from the snapshot follows the same trajectory as the
+    // one that saved it
+    restored := sim.NewEnvironment()
+    restored.EndDate = 1*Days
+    Check(BuildModel(restored).Restore("half-day.snapshot"))
+    restored.Run()
+    
+    want := env.GetResults()
+    differences := 0
+    for key, value := range restored.GetResults().Values {
+        if value != want.Values[key] {
+            differences++
+        }
+    }
+    fmt.Println()
+    fmt.Printf("[RESTORED RUN] Statistics different from the saved run: %d\n", differences)
+    
+    // Replications
+    //---------------------
+    runner := sim.Runner{
+        Build: func (env *sim.Environment) {
+            BuildModel(env)
+        },
+        Replications: 8,
+        Seed: 1,
+        EndDate: 1*Days,
+    }
+    runner.Run()
+    
+    fmt.Println()
+    summary := analysis.Summarize(runner.Results, 0.95)
+    summary.Print("UNTK Londrina/TimeInQueue.Mean", "UNTK Londrina/Utilization")
+}
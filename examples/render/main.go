@@ -0,0 +1,28 @@
+package main
+
+import (
+    "log"
+    "github.com/nidoro/sim"
+    "github.com/nidoro/sim/render"
+)
+
+// Renders the first day of the declarative example as an animated GIF, one
+// frame every 10 minutes, and its last frame as a PNG.
+func main() {
+    env, err := sim.LoadModel("../declarative/model.yaml")
+    if err != nil {
+        log.Fatal(err)
+    }
+    env.EndDate = sim.Days(1)
+    
+    renderer := render.NewRenderer(env, sim.NewGridLayout(env, 3))
+    if err := renderer.WriteGIFFile("terminals.gif", 0, env.EndDate, sim.Minutes(10), 10); err != nil {
+        log.Fatal(err)
+    }
+    
+    img := renderer.NewImage()
+    renderer.Draw(img)
+    if err := render.WritePNG("terminals.png", img); err != nil {
+        log.Fatal(err)
+    }
+}
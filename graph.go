@@ -0,0 +1,359 @@
+package sim
+
+import (
+    "fmt"
+    "io"
+    "slices"
+    "strings"
+)
+
+const (
+    GraphFormat_DOT     string = "DOT"
+    GraphFormat_Mermaid string = "Mermaid"
+)
+
+// GraphOptions choose what ExportGraph draws. Processes, holds and
+// conveyors are clustered by their group at index Group (see
+// ProcessBase.Groups), like the stage or the terminal, or not clustered if
+// Group is negative. With Statistics, edges show the number of entities
+// forwarded along them, and nodes the utilization of their resources.
+type GraphOptions struct {
+    Format      string // GraphFormat_DOT if empty
+    Group       int
+    Resources   bool // show resources and the processes that need them
+    Statistics  bool
+}
+
+type GraphNode struct {
+    Id          string
+    Label       string
+    Shape       string // "box", "hold", "conveyor", "resource" or "station"
+    Group       string
+}
+
+// GraphEdge goes from a station to the next. Declared edges come from
+// NextProcess and Routes; the others were only observed in the flows of
+// the run, like those of Forward functions.
+type GraphEdge struct {
+    From        string
+    To          string
+    Label       string
+    Declared    bool
+    Resource    bool
+}
+
+type Graph struct {
+    Nodes       []*GraphNode
+    Edges       []*GraphEdge
+}
+
+// RecordFlow counts an entity forwarded from the station it was last
+// forwarded to, if any, to pid.
+func (env *Environment) RecordFlow(entity Entity, pid string) {
+    base := entity.GetEntityBase()
+    if base.Station != "" {
+        if _, ok := env.Flows[base.Station]; !ok {
+            env.Flows[base.Station] = make(map[string]int)
+        }
+        env.Flows[base.Station][pid]++
+    }
+    base.Station = pid
+}
+
+func (graph *Graph) GetNode(id string) *GraphNode {
+    for _, node := range graph.Nodes {
+        if node.Id == id {
+            return node
+        }
+    }
+    return nil
+}
+
+func (graph *Graph) AddNode(node *GraphNode) {
+    if graph.GetNode(node.Id) == nil {
+        graph.Nodes = append(graph.Nodes, node)
+    }
+}
+
+func (graph *Graph) GetEdge(from string, to string) *GraphEdge {
+    for _, edge := range graph.Edges {
+        if edge.From == from && edge.To == to {
+            return edge
+        }
+    }
+    return nil
+}
+
+func (graph *Graph) AddEdge(edge *GraphEdge) {
+    if graph.GetEdge(edge.From, edge.To) == nil {
+        graph.Edges = append(graph.Edges, edge)
+    }
+}
+
+func GetGraphGroup(groups []string, options GraphOptions) string {
+    if options.Group < 0 || options.Group >= len(groups) {
+        return ""
+    }
+    return groups[options.Group]
+}
+
+// GetGraph returns the nodes and edges of the model, as ExportGraph draws
+// them.
+func (env *Environment) GetGraph(options GraphOptions) *Graph {
+    graph := &Graph{}
+    
+    for _, process := range env.Processes {
+        base := process.GetProcessBase()
+        node := &GraphNode{Id: base.Id, Label: base.Id, Shape: "box", Group: GetGraphGroup(base.Groups, options)}
+        if options.Statistics {
+            node.Label += fmt.Sprintf("\nout: %d", base.TotalEntitiesOut)
+            utilization := -1.0
+            for rid, _ := range base.Needs {
+                utilization = max(utilization, env.Resources[rid].GetResourceBase().GetUtilization(env.Now))
+            }
+            if utilization >= 0 {
+                node.Label += fmt.Sprintf(" | util: %.0f%%", utilization*100)
+            }
+        }
+        graph.AddNode(node)
+    }
+    
+    for _, hold := range env.Holds {
+        node := &GraphNode{Id: hold.Id, Label: hold.Id, Shape: "hold", Group: GetGraphGroup(hold.Groups, options)}
+        if options.Statistics {
+            node.Label += fmt.Sprintf("\nout: %d", hold.QueueStats.TotalEntitiesOut)
+        }
+        graph.AddNode(node)
+    }
+    
+    for _, conveyor := range env.Conveyors {
+        node := &GraphNode{Id: conveyor.Id, Label: conveyor.Id, Shape: "conveyor", Group: GetGraphGroup(conveyor.Groups, options)}
+        if options.Statistics {
+            node.Label += fmt.Sprintf("\nout: %d | util: %.0f%%", conveyor.TotalEntitiesOut, conveyor.GetUtilization()*100)
+        }
+        graph.AddNode(node)
+    }
+    
+    for _, process := range env.Processes {
+        base := process.GetProcessBase()
+        if base.NextProcess != "" {
+            graph.AddEdge(&GraphEdge{From: base.Id, To: base.NextProcess, Declared: true})
+        }
+        for _, route := range base.Routes {
+            label := ""
+            if route.Probability > 0 {
+                label = fmt.Sprintf("p=%.2g", route.Probability)
+            }
+            graph.AddEdge(&GraphEdge{From: base.Id, To: route.To, Label: label, Declared: true})
+        }
+    }
+    
+    for _, hold := range env.Holds {
+        if hold.NextProcess != "" {
+            graph.AddEdge(&GraphEdge{From: hold.Id, To: hold.NextProcess, Declared: true})
+        }
+    }
+    
+    for _, conveyor := range env.Conveyors {
+        if conveyor.NextProcess != "" {
+            graph.AddEdge(&GraphEdge{From: conveyor.Id, To: conveyor.NextProcess, Declared: true})
+        }
+    }
+    
+    if options.Statistics {
+        for _, from := range GetSortedKeys(env.Flows) {
+            for _, to := range GetSortedKeys(env.Flows[from]) {
+                graph.AddEdge(&GraphEdge{From: from, To: to})
+                edge := graph.GetEdge(from, to)
+                count := fmt.Sprintf("%d", env.Flows[from][to])
+                if edge.Label != "" {
+                    count = edge.Label + " | " + count
+                }
+                edge.Label = count
+            }
+        }
+    }
+    
+    // destinations that are not processes, holds or conveyors, like
+    // transporters
+    for _, edge := range graph.Edges {
+        graph.AddNode(&GraphNode{Id: edge.From, Label: edge.From, Shape: "station"})
+        graph.AddNode(&GraphNode{Id: edge.To, Label: edge.To, Shape: "station"})
+    }
+    
+    if options.Resources {
+        for _, rid := range GetSortedKeys(env.Resources) {
+            base := env.Resources[rid].GetResourceBase()
+            // resources can have the id of a process
+            node := &GraphNode{Id: "resource:" + rid, Label: rid, Shape: "resource"}
+            if options.Statistics {
+                node.Label += fmt.Sprintf("\nutil: %.0f%%", base.GetUtilization(env.Now)*100)
+            }
+            graph.AddNode(node)
+        }
+        
+        for _, process := range env.Processes {
+            base := process.GetProcessBase()
+            for _, rid := range GetSortedKeys(base.Needs) {
+                graph.Edges = append(graph.Edges, &GraphEdge{From: base.Id, To: "resource:" + rid, Label: fmt.Sprintf("%g", base.Needs[rid]), Declared: true, Resource: true})
+            }
+        }
+    }
+    
+    return graph
+}
+
+// GetGroups returns the groups of the nodes, in order of appearance.
+func (graph *Graph) GetGroups() []string {
+    groups := make([]string, 0)
+    for _, node := range graph.Nodes {
+        if node.Group != "" && !slices.Contains(groups, node.Group) {
+            groups = append(groups, node.Group)
+        }
+    }
+    return groups
+}
+
+// ExportGraph writes a diagram of the processes of the environment and how
+// entities flow between them, in DOT (Graphviz) or Mermaid, to check the
+// structure of models built in loops. Called after a run, it can show the
+// flows and utilizations of the run (see GraphOptions).
+func (env *Environment) ExportGraph(w io.Writer, options GraphOptions) error {
+    graph := env.GetGraph(options)
+    if options.Format == GraphFormat_Mermaid {
+        return graph.WriteMermaid(w)
+    } else if options.Format == GraphFormat_DOT || options.Format == "" {
+        return graph.WriteDOT(w)
+    }
+    return fmt.Errorf("invalid graph format: %s", options.Format)
+}
+
+func GetDOTShape(shape string) string {
+    if shape == "hold" {
+        return "shape=house"
+    } else if shape == "conveyor" {
+        return "shape=cds"
+    } else if shape == "resource" {
+        return "shape=ellipse, style=filled, fillcolor=lightgray"
+    } else if shape == "station" {
+        return "shape=box, style=dashed"
+    }
+    return "shape=box"
+}
+
+func (graph *Graph) WriteDOT(w io.Writer) error {
+    var sb strings.Builder
+    sb.WriteString("digraph sim {\n")
+    sb.WriteString("    rankdir=LR;\n")
+    sb.WriteString("    node [fontname=\"sans-serif\"];\n")
+    
+    writeNode := func (node *GraphNode, indent string) {
+        fmt.Fprintf(&sb, "%s%q [label=%q, %s];\n", indent, node.Id, node.Label, GetDOTShape(node.Shape))
+    }
+    
+    for i, group := range graph.GetGroups() {
+        fmt.Fprintf(&sb, "    subgraph cluster_%d {\n", i)
+        fmt.Fprintf(&sb, "        label=%q;\n", group)
+        for _, node := range graph.Nodes {
+            if node.Group == group {
+                writeNode(node, "        ")
+            }
+        }
+        sb.WriteString("    }\n")
+    }
+    
+    for _, node := range graph.Nodes {
+        if node.Group == "" {
+            writeNode(node, "    ")
+        }
+    }
+    
+    for _, edge := range graph.Edges {
+        attributes := make([]string, 0)
+        if edge.Label != "" {
+            attributes = append(attributes, fmt.Sprintf("label=%q", edge.Label))
+        }
+        if edge.Resource {
+            attributes = append(attributes, "style=dotted", "arrowhead=none")
+        } else if !edge.Declared {
+            attributes = append(attributes, "style=dashed")
+        }
+        
+        fmt.Fprintf(&sb, "    %q -> %q", edge.From, edge.To)
+        if len(attributes) > 0 {
+            fmt.Fprintf(&sb, " [%s]", strings.Join(attributes, ", "))
+        }
+        sb.WriteString(";\n")
+    }
+    
+    sb.WriteString("}\n")
+    _, err := io.WriteString(w, sb.String())
+    return err
+}
+
+// GetMermaidText escapes the quotes of a label and breaks its lines.
+func GetMermaidText(text string) string {
+    text = strings.ReplaceAll(text, "\"", "#quot;")
+    return strings.ReplaceAll(text, "\n", "<br/>")
+}
+
+func GetMermaidShape(shape string, label string) string {
+    label = GetMermaidText(label)
+    if shape == "hold" {
+        return fmt.Sprintf("[/\"%s\"\\]", label)
+    } else if shape == "conveyor" {
+        return fmt.Sprintf(">\"%s\"]", label)
+    } else if shape == "resource" {
+        return fmt.Sprintf("([\"%s\"])", label)
+    }
+    return fmt.Sprintf("[\"%s\"]", label)
+}
+
+func (graph *Graph) WriteMermaid(w io.Writer) error {
+    var sb strings.Builder
+    sb.WriteString("flowchart LR\n")
+    
+    // mermaid ids can't have spaces
+    ids := make(map[string]string)
+    for i, node := range graph.Nodes {
+        ids[node.Id] = fmt.Sprintf("n%d", i)
+    }
+    
+    writeNode := func (node *GraphNode, indent string) {
+        fmt.Fprintf(&sb, "%s%s%s\n", indent, ids[node.Id], GetMermaidShape(node.Shape, node.Label))
+    }
+    
+    for i, group := range graph.GetGroups() {
+        fmt.Fprintf(&sb, "    subgraph g%d [\"%s\"]\n", i, GetMermaidText(group))
+        for _, node := range graph.Nodes {
+            if node.Group == group {
+                writeNode(node, "        ")
+            }
+        }
+        sb.WriteString("    end\n")
+    }
+    
+    for _, node := range graph.Nodes {
+        if node.Group == "" {
+            writeNode(node, "    ")
+        }
+    }
+    
+    for _, edge := range graph.Edges {
+        arrow := "-->"
+        if edge.Resource {
+            arrow = "-.-"
+        } else if !edge.Declared {
+            arrow = "-.->"
+        }
+        
+        if edge.Label != "" {
+            fmt.Fprintf(&sb, "    %s %s|\"%s\"| %s\n", ids[edge.From], arrow, GetMermaidText(edge.Label), ids[edge.To])
+        } else {
+            fmt.Fprintf(&sb, "    %s %s %s\n", ids[edge.From], arrow, ids[edge.To])
+        }
+    }
+    
+    _, err := io.WriteString(w, sb.String())
+    return err
+}
@@ -0,0 +1,213 @@
+package sim
+
+import (
+    "fmt"
+    "log"
+    "slices"
+)
+
+// A Station is anything other than a process that ForwardTo can send
+// entities to, like holds.
+type Station interface {
+    GetId() string
+    Receive(entity Entity)
+}
+
+// HoldBase keeps entities waiting until they are released, either by a
+// named signal (env.Signal) or by Condition becoming true.
+//
+// Conditions are only re-evaluated when one of the keys in Watches changes
+// (see env.NotifyChange). Resource and process ids are notified by the
+// engine whenever their amount or queue changes, and variables set with
+// env.SetVariable are notified under their own name. Holds with a
+// Condition must watch at least one key. One entity is released per
+// evaluation, so that the condition sees what the entities released before
+// it did, like a ship taking the grain the next one was waiting for.
+type HoldBase struct {
+    Id          string
+    Groups      []string
+    Signal      string
+    Condition   func (env *Environment) bool
+    Watches     []string
+    Queue       []Entity
+    Forward     func (entity Entity)
+    NextProcess string
+    Env         *Environment
+    
+    QueueStats  QueueStatistics
+}
+
+func (hold *HoldBase) GetId() string {
+    return hold.Id
+}
+
+func (hold *HoldBase) GetQueueSize() int {
+    return len(hold.Queue)
+}
+
+func (hold *HoldBase) GetStatistics() QueueStatistics {
+    return hold.QueueStats
+}
+
+func (hold *HoldBase) Receive(entity Entity) {
+    env := hold.Env
+    hold.Queue = append(hold.Queue, entity)
+    hold.QueueStats.RecordIn(env.Now, len(hold.Queue))
+    entity.EnterQueue(QueueType_Hold, hold.Id, env.Now)
+    env.Debug(LogComponent_Hold, "HOLD", "hold", hold.Id, "entity", entity)
+    env.NotifyChange(hold.Id)
+    
+    if env.Tracer != nil {
+        env.Trace(TraceRecord{Type: TraceType_Hold, Entity: entity.GetName(), Id: hold.Id, Queue: len(hold.Queue)})
+    }
+    
+    if env.Debugger != nil {
+        env.Debugger.OnEnter(entity, hold.Id, len(hold.Queue))
+    }
+}
+
+// Release removes the first entity in the queue and sends it forward.
+func (hold *HoldBase) Release() Entity {
+    env := hold.Env
+    entity := hold.Queue[0]
+    hold.Queue = hold.Queue[1:]
+    
+    entity.LeaveQueue(QueueType_Hold, hold.Id, env.Now)
+    st := entity.GetEntityBase().GetQueueStats(QueueType_Hold, hold.Id)
+    hold.QueueStats.RecordOut(env.Now, len(hold.Queue), st.DateOut - st.DateIn)
+    
+    env.Debug(LogComponent_Hold, "RELEASED", "hold", hold.Id, "entity", entity)
+    env.NotifyChange(hold.Id)
+    
+    if env.Tracer != nil {
+        env.Trace(TraceRecord{Type: TraceType_Release, Entity: entity.GetName(), Id: hold.Id, Queue: len(hold.Queue)})
+    }
+    
+    if hold.Forward != nil {
+        hold.Forward(entity)
+    } else if hold.NextProcess != "" {
+        env.ForwardTo(entity, hold.NextProcess)
+    } else {
+        env.Dispose(entity)
+    }
+    
+    return entity
+}
+
+func (hold *HoldBase) IsWatching(changed map[string]bool) bool {
+    if changed[hold.Id] {
+        return true
+    }
+    
+    for _, key := range hold.Watches {
+        if changed[key] {
+            return true
+        }
+    }
+    return false
+}
+
+func (env *Environment) AddHold(base HoldBase) {
+    if len(base.Groups) == 0 {
+        base.Groups = []string{"Unnamed"}
+    }
+    if base.Condition != nil && len(base.Watches) == 0 {
+        log.Fatalf("Hold condition without watches: %s", base.Id)
+    }
+    base.Env = env
+    hold := &base
+    env.Holds = append(env.Holds, hold)
+    env.Stations[hold.Id] = hold
+}
+
+func (env *Environment) GetHold(hid string) *HoldBase {
+    for _, hold := range env.Holds {
+        if hold.Id == hid {
+            return hold
+        }
+    }
+    return nil
+}
+
+// Signal releases up to limit entities from the holds waiting on signal,
+// in the order the holds were added. A limit <= 0 releases all of them.
+// Entities sent back to the hold they were released from wait for the next
+// signal. Returns the number of entities released.
+func (env *Environment) Signal(signal string, limit int) int {
+    released := 0
+    
+    for _, hold := range env.Holds {
+        if hold.Signal != signal {
+            continue
+        }
+        
+        n := len(hold.Queue)
+        for i := 0; i < n && len(hold.Queue) > 0 && (limit <= 0 || released < limit); i++ {
+            hold.Release()
+            released++
+        }
+    }
+    
+    env.Debug(LogComponent_Hold, "SIGNAL", "signal", signal, "released", released)
+    return released
+}
+
+// NotifyChange marks key (a resource, process, hold or variable id) as
+// changed, so that holds watching it get their conditions re-evaluated.
+func (env *Environment) NotifyChange(key string) {
+    env.ChangedKeys[key] = true
+}
+
+func (env *Environment) SetVariable(name string, value float64) {
+    env.Variables[name] = value
+    env.NotifyChange(name)
+}
+
+func (env *Environment) IncVariable(name string, delta float64) {
+    env.SetVariable(name, env.Variables[name] + delta)
+}
+
+func (env *Environment) GetVariable(name string) float64 {
+    return env.Variables[name]
+}
+
+// EvaluateHolds releases the first entity of each conditional hold watching
+// any of the keys changed since the last evaluation, if its condition is
+// true. Releasing notifies the hold, so it is evaluated again after the
+// processes of the released entities start. Returns true if any entity was
+// released.
+func (env *Environment) EvaluateHolds() bool {
+    if len(env.ChangedKeys) == 0 {
+        return false
+    }
+    
+    changed := env.ChangedKeys
+    env.ChangedKeys = make(map[string]bool)
+    released := false
+    
+    for _, hold := range env.Holds {
+        if hold.Condition == nil || len(hold.Queue) == 0 || !hold.IsWatching(changed) {
+            continue
+        }
+        
+        if hold.Condition(env) {
+            hold.Release()
+            released = true
+        }
+    }
+    
+    return released
+}
+
+func (env *Environment) PrintHoldsStatistics(groupId string) {
+    fmt.Printf("[HOLD STATISTICS] Group: %s\n", groupId)
+    
+    fmt.Printf("%24s%16s%16s%16s%16s\n", "Hold", "Entities In", "Entities Out", "Avg Q Time (s)", "Queue Size")
+    
+    for _, hold := range env.Holds {
+        if slices.Contains(hold.Groups, groupId) {
+            st := hold.GetStatistics()
+            fmt.Printf("%24.24s%16d%16d%16.2f%16d\n", hold.Id, st.TotalEntitiesIn, st.TotalEntitiesOut, st.AvgTimeInQueue, hold.GetQueueSize())
+        }
+    }
+}
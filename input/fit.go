@@ -0,0 +1,160 @@
+package input
+
+import (
+    "math"
+    "gonum.org/v1/gonum/stat/distuv"
+)
+
+// The fits below take the data sorted.
+
+func FitExponential(x []float64) *Fit {
+    sum := 0.0
+    for _, v := range x {
+        sum += v
+    }
+    
+    d := distuv.Exponential{Rate: float64(len(x)) / sum}
+    return &Fit{Distribution: Distribution_Exponential, Params: []float64{d.Rate}, CDF: d.CDF, LogProb: d.LogProb}
+}
+
+func FitNormal(x []float64) *Fit {
+    mean, stddev := GetMLEMeanStdDev(x)
+    d := distuv.Normal{Mu: mean, Sigma: stddev}
+    return &Fit{Distribution: Distribution_Normal, Params: []float64{mean, stddev}, CDF: d.CDF, LogProb: d.LogProb}
+}
+
+// FitLogNormal fits the mean and standard deviation of the logarithm of
+// the data. Params are the mean and standard deviation of the data itself,
+// as taken by sim.NewRNGLogNormal.
+func FitLogNormal(x []float64) *Fit {
+    logs := make([]float64, len(x))
+    for i, v := range x {
+        logs[i] = math.Log(v)
+    }
+    
+    mu, sigma := GetMLEMeanStdDev(logs)
+    d := distuv.LogNormal{Mu: mu, Sigma: sigma}
+    mean := math.Exp(mu + sigma*sigma/2)
+    stddev := mean * math.Sqrt(math.Exp(sigma*sigma) - 1)
+    return &Fit{Distribution: Distribution_LogNormal, Params: []float64{mean, stddev}, CDF: d.CDF, LogProb: d.LogProb}
+}
+
+// FitTriangular extends the range of the data by a nth of its width on each
+// side, as the minimum and maximum of a sample fall short of those of the
+// distribution, and fits the mode by maximum likelihood, which for a given
+// range is one of the data points. The minimum is not extended below 0 for
+// data that is not negative, like durations, so that sampling the fit
+// doesn't give negative values.
+func FitTriangular(x []float64) *Fit {
+    n := len(x)
+    width := x[n-1] - x[0]
+    a := x[0] - width / float64(n)
+    b := x[n-1] + width / float64(n)
+    if x[0] >= 0 {
+        a = max(0, a)
+    }
+    
+    // log likelihood of mode x[k], up to a constant: the points below it
+    // contribute log(x - a) - log(c - a) and the rest log(b - x) - log(b - c)
+    below := make([]float64, n+1)
+    above := make([]float64, n+1)
+    for i := 0; i < n; i++ {
+        below[i+1] = below[i] + math.Log(x[i] - a)
+        above[n-i-1] = above[n-i] + math.Log(b - x[n-i-1])
+    }
+    
+    c := x[0]
+    best := math.Inf(-1)
+    for k := 0; k < n; k++ {
+        // with a at x[0] = 0, only a mode at a gives the first point a
+        // density
+        ll := below[k] + above[k] - float64(n-k) * math.Log(b - x[k])
+        if k > 0 {
+            ll -= float64(k) * math.Log(x[k] - a)
+        }
+        if ll > best {
+            best = ll
+            c = x[k]
+        }
+    }
+    
+    d := distuv.NewTriangle(a, b, c, nil)
+    return &Fit{Distribution: Distribution_Triangular, Params: []float64{a, b, c}, CDF: d.CDF, LogProb: d.LogProb}
+}
+
+func GetMLEMeanStdDev(x []float64) (float64, float64) {
+    mean := 0.0
+    for _, v := range x {
+        mean += v
+    }
+    mean /= float64(len(x))
+    
+    ss := 0.0
+    for _, v := range x {
+        ss += (v - mean) * (v - mean)
+    }
+    return mean, math.Sqrt(ss / float64(len(x)))
+}
+
+// GetKS returns the Kolmogorov-Smirnov statistic of sorted data against a
+// CDF and its asymptotic p-value. With fitted parameters the p-value is
+// conservative.
+func GetKS(x []float64, cdf func (x float64) float64) (float64, float64) {
+    n := float64(len(x))
+    d := 0.0
+    for i, v := range x {
+        f := cdf(v)
+        d = max(d, float64(i+1)/n - f, f - float64(i)/n)
+    }
+    
+    // Kolmogorov distribution with Stephens' correction for small samples
+    lambda := (math.Sqrt(n) + 0.12 + 0.11/math.Sqrt(n)) * d
+    p := 0.0
+    for k := 1; k <= 100; k++ {
+        term := 2 * math.Pow(-1, float64(k-1)) * math.Exp(-2 * float64(k*k) * lambda * lambda)
+        p += term
+        if math.Abs(term) < 1e-12 {
+            break
+        }
+    }
+    return d, min(1, max(0, p))
+}
+
+// GetChiSquare returns the chi-square statistic of sorted data against a
+// CDF, over bins of equal probability with at least 5 expected points each,
+// its degrees of freedom and its p-value. params is the number of fitted
+// parameters. The p-value is NaN if there are no degrees of freedom left.
+func GetChiSquare(x []float64, cdf func (x float64) float64, params int) (float64, int, float64) {
+    n := len(x)
+    bins := max(2, min(n/5, int(math.Ceil(2 * math.Pow(float64(n), 0.4)))))
+    observed := make([]float64, bins)
+    for _, v := range x {
+        bin := int(cdf(v) * float64(bins))
+        observed[min(bins-1, max(0, bin))]++
+    }
+    
+    expected := float64(n) / float64(bins)
+    chi := 0.0
+    for _, o := range observed {
+        chi += (o - expected) * (o - expected) / expected
+    }
+    
+    dof := bins - 1 - params
+    if dof < 1 {
+        return chi, dof, math.NaN()
+    }
+    return chi, dof, distuv.ChiSquared{K: float64(dof)}.Survival(chi)
+}
+
+// GetAndersonDarling returns the Anderson-Darling statistic of sorted data
+// against a CDF. It weighs the tails more than the KS statistic.
+func GetAndersonDarling(x []float64, cdf func (x float64) float64) float64 {
+    n := len(x)
+    sum := 0.0
+    for i := 0; i < n; i++ {
+        low := min(1 - 1e-12, max(1e-12, cdf(x[i])))
+        high := min(1 - 1e-12, max(1e-12, cdf(x[n-1-i])))
+        sum += float64(2*i + 1) * (math.Log(low) + math.Log(1 - high))
+    }
+    return -float64(n) - sum / float64(n)
+}
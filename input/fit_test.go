@@ -0,0 +1,109 @@
+package input
+
+import (
+    "math"
+    "testing"
+    "golang.org/x/exp/rand"
+    "gonum.org/v1/gonum/stat/distuv"
+)
+
+type Sampler interface {
+    Rand() float64
+}
+
+func GetSamples(sampler Sampler, n int) []float64 {
+    x := make([]float64, n)
+    for i := range x {
+        x[i] = sampler.Rand()
+    }
+    return x
+}
+
+func IsNear(a float64, b float64, tolerance float64) bool {
+    return math.Abs(a - b) <= tolerance * math.Abs(b)
+}
+
+// Fitting samples of each distribution recovers its parameters, within
+// tolerance (relative), and ranks it first by every criterion.
+func TestAnalyze(t *testing.T) {
+    src := rand.NewSource(1)
+    tests := []struct {
+        name            string
+        sampler         Sampler
+        distribution    string
+        params          []float64
+        tolerance       float64
+    }{
+        {"exponential", distuv.Exponential{Rate: 0.5, Src: src}, Distribution_Exponential, []float64{0.5}, 0.05},
+        {"normal", distuv.Normal{Mu: 100, Sigma: 10, Src: src}, Distribution_Normal, []float64{100, 10}, 0.05},
+        // mean exp(1 + 0.5²/2) and standard deviation mean*sqrt(exp(0.5²) - 1)
+        {"lognormal", distuv.LogNormal{Mu: 1, Sigma: 0.5, Src: src}, Distribution_LogNormal, []float64{3.0802, 1.6416}, 0.05},
+        // few points fall near the ends of a triangle, so its range is
+        // narrower than the true one
+        {"triangular", distuv.NewTriangle(2, 10, 4, src), Distribution_Triangular, []float64{2, 10, 4}, 0.1},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            analysis, err := Analyze(GetSamples(test.sampler, 2000))
+            if err != nil {
+                t.Fatal(err)
+            }
+            
+            fit := analysis.GetFit(test.distribution)
+            for i, param := range test.params {
+                if !IsNear(fit.Params[i], param, test.tolerance) {
+                    t.Errorf("params: got %v, want %v", fit.Params, test.params)
+                    break
+                }
+            }
+            if fit.KSPValue < 0.01 {
+                t.Errorf("KS: got p-value %g for the true distribution", fit.KSPValue)
+            }
+            
+            for _, criterion := range []string{Criterion_KS, Criterion_ChiSquare, Criterion_AndersonDarling} {
+                analysis.Rank(criterion)
+                if best := analysis.GetBest(); best.Distribution != test.distribution {
+                    t.Errorf("%s: got %s first, want %s", criterion, best.Distribution, test.distribution)
+                }
+                for i := 1; i < len(analysis.Fits); i++ {
+                    if analysis.Fits[i].GetScore(criterion) < analysis.Fits[i-1].GetScore(criterion) {
+                        t.Errorf("%s: %s ranked after %s", criterion, analysis.Fits[i].Distribution, analysis.Fits[i-1].Distribution)
+                    }
+                }
+            }
+        })
+    }
+}
+
+func TestFitTriangular(t *testing.T) {
+    tests := []struct {
+        name        string
+        x           []float64
+        params      []float64
+    }{
+        // the minimum would be -2 if not kept at 0, and only a mode at 0
+        // gives the first point a density
+        {"starting at 0", []float64{0, 1, 2, 3, 10}, []float64{0, 12, 0}},
+        {"positive", []float64{0.5, 1, 2, 3, 10}, []float64{0, 11.9, 0.5}},
+        {"negative", []float64{-1, 0, 2, 3}, []float64{-2, 4, 3}},
+        {"far from 0", []float64{5, 6, 6, 7, 9}, []float64{4.2, 9.8, 6}},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            fit := FitTriangular(test.x)
+            for i, param := range test.params {
+                if !IsNear(fit.Params[i], param, 1e-9) {
+                    t.Fatalf("params: got %v, want %v", fit.Params, test.params)
+                }
+            }
+            
+            analysis := &Analysis{Data: test.x}
+            analysis.Add(fit)
+            if math.IsInf(fit.LogLikelihood, 0) || math.IsNaN(fit.LogLikelihood) {
+                t.Errorf("log likelihood: got %g", fit.LogLikelihood)
+            }
+        })
+    }
+}
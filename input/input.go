@@ -0,0 +1,255 @@
+// Package input fits probability distributions to observed data, like
+// service times taken from reports, to choose the RNGs of a model.
+//
+// Each distribution of the sim library that applies to the data is fitted
+// by maximum likelihood and tested with the Kolmogorov-Smirnov, chi-square
+// and Anderson-Darling statistics. Fits are ranked by one of them.
+package input
+
+import (
+    "fmt"
+    "io"
+    "math"
+    "slices"
+    "strconv"
+    "strings"
+    "github.com/nidoro/sim"
+    "github.com/nidoro/sim/data"
+    "gonum.org/v1/gonum/stat"
+)
+
+const (
+    Distribution_Exponential    string = "Exponential"
+    Distribution_Normal         string = "Normal"
+    Distribution_LogNormal      string = "LogNormal"
+    Distribution_Triangular     string = "Triangular"
+)
+
+const (
+    Criterion_KS                string = "KS"
+    Criterion_ChiSquare         string = "ChiSquare" // by p-value
+    Criterion_AndersonDarling   string = "AndersonDarling"
+)
+
+const DefaultCriterion = Criterion_KS
+
+// Fit is a distribution fitted to the data. Params are the arguments of
+// its sim.NewRNG function, in the same order and units as the data.
+type Fit struct {
+    Distribution    string
+    Params          []float64
+    LogLikelihood   float64
+    KS              float64
+    KSPValue        float64
+    ChiSquare       float64
+    ChiSquareDOF    int
+    ChiSquarePValue float64 // NaN if there are too few bins
+    AndersonDarling float64
+    CDF             func (x float64) float64
+    LogProb         func (x float64) float64
+}
+
+// NewRNG returns a new RNG of the fitted distribution. Each call returns an
+// independent RNG, so that processes don't share streams.
+func (fit *Fit) NewRNG() sim.RNG {
+    p := fit.Params
+    if fit.Distribution == Distribution_Exponential {
+        return sim.NewRNGExponential(p[0])
+    } else if fit.Distribution == Distribution_Normal {
+        return sim.NewRNGNormal(p[0], p[1])
+    } else if fit.Distribution == Distribution_LogNormal {
+        return sim.NewRNGLogNormal(p[0], p[1])
+    }
+    return sim.NewRNGTriangular(p[0], p[1], p[2])
+}
+
+// GetExpression returns the Go code that creates the RNG of the fit, to
+// paste in a model.
+func (fit *Fit) GetExpression() string {
+    args := ""
+    for i, param := range fit.Params {
+        if i > 0 {
+            args += ", "
+        }
+        args += strconv.FormatFloat(param, 'g', 6, 64)
+    }
+    return fmt.Sprintf("sim.NewRNG%s(%s)", fit.Distribution, args)
+}
+
+// GetScore returns the statistic fits are ranked by; lower is better.
+func (fit *Fit) GetScore(criterion string) float64 {
+    score := fit.KS
+    if criterion == Criterion_ChiSquare {
+        score = -fit.ChiSquarePValue
+    } else if criterion == Criterion_AndersonDarling {
+        score = fit.AndersonDarling
+    }
+    
+    if math.IsNaN(score) {
+        return math.Inf(1)
+    }
+    return score
+}
+
+// Analysis holds the summary of the data and the fits of every applicable
+// distribution, best first.
+type Analysis struct {
+    Data        []float64 // sorted
+    Mean        float64
+    StdDev      float64
+    Criterion   string
+    Fits        []*Fit
+}
+
+// Analyze fits every applicable distribution to data and ranks them by
+// DefaultCriterion. Exponential fits need data that is not negative, and
+// lognormal fits data that is positive.
+func Analyze(values []float64) (*Analysis, error) {
+    if len(values) < 5 {
+        return nil, fmt.Errorf("not enough data: %d values", len(values))
+    }
+    
+    x := slices.Clone(values)
+    for _, v := range x {
+        if math.IsNaN(v) || math.IsInf(v, 0) {
+            return nil, fmt.Errorf("invalid value: %g", v)
+        }
+    }
+    slices.Sort(x)
+    
+    analysis := &Analysis{Data: x}
+    analysis.Mean, analysis.StdDev = stat.MeanStdDev(x, nil)
+    if analysis.StdDev == 0 {
+        return nil, fmt.Errorf("constant data: %g", x[0])
+    }
+    
+    if x[0] >= 0 {
+        analysis.Add(FitExponential(x))
+    }
+    analysis.Add(FitNormal(x))
+    if x[0] > 0 {
+        analysis.Add(FitLogNormal(x))
+    }
+    analysis.Add(FitTriangular(x))
+    
+    analysis.Rank(DefaultCriterion)
+    return analysis, nil
+}
+
+// ReadColumn reads the numbers of a column of a table file (see
+// data.ReadTable), converting them from unit (see data.Units). Blank cells
+// are skipped.
+func ReadColumn(path string, column string, unit string) ([]float64, error) {
+    table, err := data.ReadTable(path)
+    if err != nil {
+        return nil, err
+    }
+    
+    c := table.GetColumnIndex(column)
+    if c < 0 {
+        return nil, &data.DecodeError{Source: table.Source, Column: column, Err: fmt.Errorf("column not found")}
+    }
+    
+    scale := 1.0
+    if unit != "" {
+        var ok bool
+        if scale, ok = data.Units[unit]; !ok {
+            return nil, &data.DecodeError{Source: table.Source, Column: column, Err: fmt.Errorf("unknown unit: %s", unit)}
+        }
+    }
+    
+    values := make([]float64, 0, len(table.Rows))
+    for i, row := range table.Rows {
+        if c >= len(row) || data.IsBlank(row[c]) {
+            continue
+        }
+        
+        v, err := strconv.ParseFloat(strings.TrimSpace(row[c]), 64)
+        if err != nil {
+            return nil, &data.DecodeError{Source: table.Source, Row: table.RowNumbers[i], Column: column, Value: row[c], Err: fmt.Errorf("invalid number")}
+        }
+        values = append(values, v * scale)
+    }
+    return values, nil
+}
+
+// AnalyzeColumn analyzes the numbers of a column of a table file.
+func AnalyzeColumn(path string, column string, unit string) (*Analysis, error) {
+    values, err := ReadColumn(path, column, unit)
+    if err != nil {
+        return nil, err
+    }
+    
+    analysis, err := Analyze(values)
+    if err != nil {
+        return nil, fmt.Errorf("%s: column %q: %w", path, column, err)
+    }
+    return analysis, nil
+}
+
+// Add tests a fit against the data and adds it to the analysis.
+func (analysis *Analysis) Add(fit *Fit) {
+    x := analysis.Data
+    for _, v := range x {
+        fit.LogLikelihood += fit.LogProb(v)
+    }
+    fit.KS, fit.KSPValue = GetKS(x, fit.CDF)
+    fit.ChiSquare, fit.ChiSquareDOF, fit.ChiSquarePValue = GetChiSquare(x, fit.CDF, len(fit.Params))
+    fit.AndersonDarling = GetAndersonDarling(x, fit.CDF)
+    analysis.Fits = append(analysis.Fits, fit)
+}
+
+// Rank sorts the fits by criterion, best first.
+func (analysis *Analysis) Rank(criterion string) {
+    analysis.Criterion = criterion
+    slices.SortStableFunc(analysis.Fits, func (a, b *Fit) int {
+        if a.GetScore(criterion) < b.GetScore(criterion) {
+            return -1
+        } else if a.GetScore(criterion) > b.GetScore(criterion) {
+            return 1
+        }
+        return 0
+    })
+}
+
+func (analysis *Analysis) GetBest() *Fit {
+    return analysis.Fits[0]
+}
+
+func (analysis *Analysis) GetFit(distribution string) *Fit {
+    for _, fit := range analysis.Fits {
+        if fit.Distribution == distribution {
+            return fit
+        }
+    }
+    return nil
+}
+
+// GetRNG returns a new RNG of the best fit.
+func (analysis *Analysis) GetRNG() sim.RNG {
+    return analysis.GetBest().NewRNG()
+}
+
+func (analysis *Analysis) Print() {
+    x := analysis.Data
+    fmt.Printf("[INPUT ANALYSIS] N: %d | Mean: %.4g | Std Dev: %.4g | Min: %.4g | Max: %.4g | Ranked by: %s\n", len(x), analysis.Mean, analysis.StdDev, x[0], x[len(x)-1], analysis.Criterion)
+    fmt.Printf("%16s%14s%14s%14s%14s%14s%14s  %s\n", "Distribution", "Log Lik", "KS", "KS p", "Chi Sq", "Chi Sq p", "A-D", "RNG")
+    
+    for _, fit := range analysis.Fits {
+        fmt.Printf("%16.16s%14.4g%14.4g%14.4g%14.4g%14.4g%14.4g  %s\n", fit.Distribution, fit.LogLikelihood, fit.KS, fit.KSPValue, fit.ChiSquare, fit.ChiSquarePValue, fit.AndersonDarling, fit.GetExpression())
+    }
+}
+
+func (analysis *Analysis) WriteTSV(w io.Writer) error {
+    if _, err := fmt.Fprintf(w, "Rank\tDistribution\tLogLikelihood\tKS\tKSPValue\tChiSquare\tChiSquareDOF\tChiSquarePValue\tAndersonDarling\tRNG\n"); err != nil {
+        return err
+    }
+    
+    for i, fit := range analysis.Fits {
+        _, err := fmt.Fprintf(w, "%d\t%s\t%g\t%g\t%g\t%g\t%d\t%g\t%g\t%s\n", i+1, fit.Distribution, fit.LogLikelihood, fit.KS, fit.KSPValue, fit.ChiSquare, fit.ChiSquareDOF, fit.ChiSquarePValue, fit.AndersonDarling, fit.GetExpression())
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
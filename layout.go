@@ -0,0 +1,198 @@
+package sim
+
+import (
+    "slices"
+)
+
+const (
+    LayoutKind_Process      string = "Process"
+    LayoutKind_Hold         string = "Hold"
+    LayoutKind_Resource     string = "Resource"
+    LayoutKind_Conveyor     string = "Conveyor"
+)
+
+// LayoutNode is a box on the canvas where a process, hold, resource or
+// conveyor is drawn. Coordinates are in pixels from the top-left corner.
+type LayoutNode struct {
+    Id          string
+    Kind        string
+    Label       string // Id if empty
+    X           float64
+    Y           float64
+    Width       float64
+    Height      float64
+}
+
+func (node *LayoutNode) GetLabel() string {
+    if node.Label == "" {
+        return node.Id
+    }
+    return node.Label
+}
+
+func (node *LayoutNode) GetCenter() LayoutPoint {
+    return LayoutPoint{X: node.X + node.Width/2, Y: node.Y + node.Height/2}
+}
+
+type LayoutPoint struct {
+    X   float64
+    Y   float64
+}
+
+// LayoutPath is the route drawn between two stations or locations, through
+// Points.
+type LayoutPath struct {
+    From        string
+    To          string
+    Points      []LayoutPoint
+}
+
+// Layout places the parts of a model on a canvas for renderers. Locations
+// are the places transporters move between; a location with the id of a
+// node is at the center of that node unless set. Paths are the routes
+// entities take between stations when animated.
+type Layout struct {
+    Width       int
+    Height      int
+    Nodes       []*LayoutNode
+    Locations   map[string]LayoutPoint
+    Paths       []LayoutPath
+}
+
+func NewLayout(width int, height int) *Layout {
+    return &Layout{Width: width, Height: height, Nodes: make([]*LayoutNode, 0), Locations: make(map[string]LayoutPoint), Paths: make([]LayoutPath, 0)}
+}
+
+func (layout *Layout) AddNode(node LayoutNode) *LayoutNode {
+    layout.Nodes = append(layout.Nodes, &node)
+    return &node
+}
+
+func (layout *Layout) GetNode(id string) *LayoutNode {
+    for _, node := range layout.Nodes {
+        if node.Id == id {
+            return node
+        }
+    }
+    return nil
+}
+
+func (layout *Layout) SetLocation(location string, x float64, y float64) {
+    layout.Locations[location] = LayoutPoint{X: x, Y: y}
+}
+
+func (layout *Layout) GetLocation(location string) (LayoutPoint, bool) {
+    if point, ok := layout.Locations[location]; ok {
+        return point, true
+    }
+    
+    if node := layout.GetNode(location); node != nil {
+        return node.GetCenter(), true
+    }
+    return LayoutPoint{}, false
+}
+
+func (layout *Layout) AddPath(from string, to string, points ...LayoutPoint) {
+    layout.Paths = append(layout.Paths, LayoutPath{From: from, To: to, Points: points})
+}
+
+// GetRoute returns the points of the path from one station or location to
+// another, from the center of the first to the center of the second. Paths
+// are followed backwards if only the opposite one was added, and stations
+// without a path are joined by a straight line.
+func (layout *Layout) GetRoute(from string, to string) []LayoutPoint {
+    route := make([]LayoutPoint, 0)
+    if start, ok := layout.GetLocation(from); ok {
+        route = append(route, start)
+    }
+    
+    for _, path := range layout.Paths {
+        if path.From == from && path.To == to {
+            route = append(route, path.Points...)
+            break
+        } else if path.From == to && path.To == from {
+            for i := len(path.Points)-1; i >= 0; i-- {
+                route = append(route, path.Points[i])
+            }
+            break
+        }
+    }
+    
+    if end, ok := layout.GetLocation(to); ok {
+        route = append(route, end)
+    }
+    return route
+}
+
+// GetVehiclePosition returns where a vehicle is at date, moving in a
+// straight line between locations.
+func (layout *Layout) GetVehiclePosition(vehicle *Vehicle, date float64) (LayoutPoint, bool) {
+    from, ok := layout.GetLocation(vehicle.Location)
+    if !ok {
+        return from, false
+    }
+    
+    moving := vehicle.Status == VehicleStatus_MovingEmpty || vehicle.Status == VehicleStatus_MovingLoaded
+    if !moving || vehicle.DateArrival <= vehicle.DateDepart {
+        return from, true
+    }
+    
+    to, ok := layout.GetLocation(vehicle.Destination)
+    if !ok {
+        return from, true
+    }
+    
+    f := (date - vehicle.DateDepart) / (vehicle.DateArrival - vehicle.DateDepart)
+    f = max(0, min(1, f))
+    return LayoutPoint{X: from.X + (to.X - from.X) * f, Y: from.Y + (to.Y - from.Y) * f}, true
+}
+
+// NewGridLayout places the processes, holds and conveyors of an environment
+// on a grid, in the order they were added, with its resources in a row
+// below them.
+func NewGridLayout(env *Environment, columns int) *Layout {
+    const cellWidth, cellHeight, margin = 220.0, 110.0, 20.0
+    columns = max(1, columns)
+    
+    nodes := make([]LayoutNode, 0)
+    for _, process := range env.Processes {
+        nodes = append(nodes, LayoutNode{Id: process.GetId(), Kind: LayoutKind_Process})
+    }
+    for _, hold := range env.Holds {
+        nodes = append(nodes, LayoutNode{Id: hold.Id, Kind: LayoutKind_Hold})
+    }
+    for _, conveyor := range env.Conveyors {
+        nodes = append(nodes, LayoutNode{Id: conveyor.Id, Kind: LayoutKind_Conveyor})
+    }
+    
+    rids := make([]string, 0, len(env.Resources))
+    for rid, _ := range env.Resources {
+        rids = append(rids, rid)
+    }
+    slices.Sort(rids)
+    
+    rows := (len(nodes) + columns - 1) / columns
+    resourceRows := (len(rids) + columns - 1) / columns
+    layout := NewLayout(int(margin + float64(columns) * cellWidth), int(margin + float64(rows) * cellHeight + float64(resourceRows) * cellHeight / 2))
+    
+    for i, node := range nodes {
+        node.X = margin + float64(i % columns) * cellWidth
+        node.Y = margin + float64(i / columns) * cellHeight
+        node.Width = cellWidth - margin
+        node.Height = cellHeight - margin
+        layout.AddNode(node)
+    }
+    
+    for i, rid := range rids {
+        layout.AddNode(LayoutNode{
+            Id: rid,
+            Kind: LayoutKind_Resource,
+            X: margin + float64(i % columns) * cellWidth,
+            Y: margin + float64(rows) * cellHeight + float64(i / columns) * cellHeight / 2,
+            Width: cellWidth - margin,
+            Height: cellHeight / 2 - margin,
+        })
+    }
+    
+    return layout
+}
@@ -0,0 +1,145 @@
+package sim
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "log/slog"
+    "os"
+    "slices"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Components that log messages, for env.LogComponents.
+const (
+    LogComponent_Run            string = "run"
+    LogComponent_Clock          string = "clock"
+    LogComponent_Source         string = "source"
+    LogComponent_Process        string = "process"
+    LogComponent_Resource       string = "resource"
+    LogComponent_Hold           string = "hold"
+    LogComponent_Transporter    string = "transporter"
+    LogComponent_Conveyor       string = "conveyor"
+)
+
+// LogValue makes entities log as their name, which is only formatted if
+// the message is actually written.
+func (entityBase *EntityBase) LogValue() slog.Value {
+    return slog.StringValue(entityBase.GetName())
+}
+
+// SetLogLevel sets how much is logged: 0 is nothing, 1 is the start and
+// end of runs (slog.LevelInfo) and 2 is everything that happens
+// (slog.LevelDebug).
+func (env *Environment) SetLogLevel(level int) {
+    env.LogLevel = level
+}
+
+// SetLogger sends log messages to logger instead of the console.
+func (env *Environment) SetLogger(logger *slog.Logger) {
+    env.Logger = logger
+}
+
+func (env *Environment) GetSlogLevel() slog.Level {
+    if env.LogLevel >= 2 {
+        return slog.LevelDebug
+    }
+    return slog.LevelInfo
+}
+
+// IsLogging tells whether messages of a level from a component are
+// written. Messages are only logged by components in env.LogComponents,
+// if it is not empty.
+func (env *Environment) IsLogging(level slog.Level, component string) bool {
+    if env.LogLevel <= 0 || level < env.GetSlogLevel() {
+        return false
+    }
+    
+    if len(env.LogComponents) > 0 && !slices.Contains(env.LogComponents, component) {
+        return false
+    }
+    
+    if env.Logger == nil {
+        env.Logger = slog.New(NewConsoleHandler(env.LogOutput))
+    }
+    return env.Logger.Enabled(context.Background(), level)
+}
+
+// Log writes a message with the simulation time and component. Arguments
+// are key-value pairs, like in slog; entities can be passed as values.
+func (env *Environment) Log(level slog.Level, component string, msg string, args ...any) {
+    if !env.IsLogging(level, component) {
+        return
+    }
+    
+    record := slog.NewRecord(time.Now(), level, msg, 0)
+    record.AddAttrs(slog.Float64("sim", env.Now), slog.String("component", component))
+    record.Add(args...)
+    env.Logger.Handler().Handle(context.Background(), record)
+}
+
+func (env *Environment) Debug(component string, msg string, args ...any) {
+    env.Log(slog.LevelDebug, component, msg, args...)
+}
+
+func (env *Environment) Info(component string, msg string, args ...any) {
+    env.Log(slog.LevelInfo, component, msg, args...)
+}
+
+// ConsoleHandler writes messages the way sim always has, as
+// "[MESSAGE] value | value", leaving out the keys, the simulation time and
+// the component. It writes to stdout if Writer is nil.
+type ConsoleHandler struct {
+    Writer  io.Writer
+    Level   slog.Leveler
+    Attrs   []slog.Attr
+    Mutex   *sync.Mutex
+}
+
+func NewConsoleHandler(w io.Writer) *ConsoleHandler {
+    if w == nil {
+        w = os.Stdout
+    }
+    return &ConsoleHandler{Writer: w, Level: slog.LevelDebug, Mutex: &sync.Mutex{}}
+}
+
+func (handler *ConsoleHandler) Enabled(ctx context.Context, level slog.Level) bool {
+    return level >= handler.Level.Level()
+}
+
+func (handler *ConsoleHandler) Handle(ctx context.Context, record slog.Record) error {
+    values := make([]string, 0, record.NumAttrs())
+    addAttr := func (attr slog.Attr) bool {
+        if attr.Key != "sim" && attr.Key != "component" {
+            values = append(values, attr.Value.Resolve().String())
+        }
+        return true
+    }
+    
+    for _, attr := range handler.Attrs {
+        addAttr(attr)
+    }
+    record.Attrs(addAttr)
+    
+    line := fmt.Sprintf("[%s]", record.Message)
+    if len(values) > 0 {
+        line += " " + strings.Join(values, " | ")
+    }
+    
+    handler.Mutex.Lock()
+    defer handler.Mutex.Unlock()
+    _, err := fmt.Fprintln(handler.Writer, line)
+    return err
+}
+
+func (handler *ConsoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    copied := *handler
+    copied.Attrs = append(slices.Clip(handler.Attrs), attrs...)
+    return &copied
+}
+
+func (handler *ConsoleHandler) WithGroup(name string) slog.Handler {
+    return handler
+}
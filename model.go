@@ -0,0 +1,628 @@
+package sim
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    "gopkg.in/yaml.v3"
+    "github.com/nidoro/sim/data"
+)
+
+// Delay and forward functions that model files can refer to by name. Go
+// code registers them (usually in init) before loading models.
+var (
+    modelFuncsMutex sync.RWMutex
+    delayFuncs      = make(map[string]func (process *ProcessBase, entity Entity) float64)
+    forwardFuncs    = make(map[string]func (entity Entity))
+)
+
+func RegisterDelayFunc(name string, delayFunc func (process *ProcessBase, entity Entity) float64) {
+    modelFuncsMutex.Lock()
+    defer modelFuncsMutex.Unlock()
+    delayFuncs[name] = delayFunc
+}
+
+func RegisterForwardFunc(name string, forwardFunc func (entity Entity)) {
+    modelFuncsMutex.Lock()
+    defer modelFuncsMutex.Unlock()
+    forwardFuncs[name] = forwardFunc
+}
+
+func GetDelayFunc(name string) (func (process *ProcessBase, entity Entity) float64, bool) {
+    modelFuncsMutex.RLock()
+    defer modelFuncsMutex.RUnlock()
+    delayFunc, ok := delayFuncs[name]
+    return delayFunc, ok
+}
+
+func GetForwardFunc(name string) (func (entity Entity), bool) {
+    modelFuncsMutex.RLock()
+    defer modelFuncsMutex.RUnlock()
+    forwardFunc, ok := forwardFuncs[name]
+    return forwardFunc, ok
+}
+
+// ModelEntity is the entity created by sources of model files.
+type ModelEntity struct {
+    EntityBase
+    Attributes  map[string]float64
+}
+
+// ModelSource generates entities of type EntityType and forwards them to To.
+type ModelSource struct {
+    EntitySourceBase
+    EntityType  string
+    To          string
+    Attributes  map[string]float64
+}
+
+func (source *ModelSource) Generate() Entity {
+    env := source.GetEnvironment()
+    entity := &ModelEntity{Attributes: make(map[string]float64)}
+    for name, value := range source.Attributes {
+        entity.Attributes[name] = value
+    }
+    
+    env.AddEntity(source.EntityType, entity)
+    env.ForwardTo(entity, source.To)
+    return entity
+}
+
+// ModelDuration is a number of seconds, written in model files either as a
+// number or as a string with a unit: "30s", "15min", "8h", "2d", "1w", "1y".
+type ModelDuration float64
+
+func ParseModelDuration(s string) (float64, error) {
+    s = strings.TrimSpace(s)
+    units := []struct {
+        Suffix  string
+        Seconds float64
+    }{
+        {"min", Minutes(1)},
+        {"s", 1},
+        {"h", Hours(1)},
+        {"d", Days(1)},
+        {"w", Days(7)},
+        {"y", Years(1)},
+    }
+    
+    for _, unit := range units {
+        if strings.HasSuffix(s, unit.Suffix) {
+            n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, unit.Suffix)), 64)
+            if err != nil {
+                return 0, fmt.Errorf("invalid duration: %q", s)
+            }
+            return n * unit.Seconds, nil
+        }
+    }
+    
+    n, err := strconv.ParseFloat(s, 64)
+    if err != nil {
+        return 0, fmt.Errorf("invalid duration: %q", s)
+    }
+    return n, nil
+}
+
+func (duration *ModelDuration) UnmarshalJSON(data []byte) error {
+    var s string
+    if err := json.Unmarshal(data, &s); err == nil {
+        seconds, err := ParseModelDuration(s)
+        *duration = ModelDuration(seconds)
+        return err
+    }
+    
+    var n float64
+    if err := json.Unmarshal(data, &n); err != nil {
+        return fmt.Errorf("invalid duration: %s", data)
+    }
+    *duration = ModelDuration(n)
+    return nil
+}
+
+// DistributionSpec describes a random variable. Type is one of Constant
+// (Value), Exponential (Mean), Normal (Mean, StdDev), LogNormal (Mean,
+// StdDev), Triangular (Min, Mode, Max) or Discrete (Weights, and Values to
+// draw from). Parameters are in Unit, seconds by default.
+type DistributionSpec struct {
+    Type    string
+    Value   float64
+    Mean    float64
+    StdDev  float64
+    Min     float64
+    Mode    float64
+    Max     float64
+    Weights []float64
+    Values  []float64
+    Unit    string
+}
+
+func (dist *DistributionSpec) NewRNG() (RNG, error) {
+    scale := 1.0
+    if dist.Unit != "" {
+        var err error
+        if scale, err = ParseModelDuration("1" + dist.Unit); err != nil {
+            return nil, fmt.Errorf("invalid unit: %q", dist.Unit)
+        }
+    }
+    
+    if strings.EqualFold(dist.Type, "Constant") {
+        return &RNGConstant{Value: dist.Value * scale}, nil
+    } else if strings.EqualFold(dist.Type, "Exponential") {
+        if dist.Mean <= 0 {
+            return nil, fmt.Errorf("exponential distribution needs a positive mean")
+        }
+        return NewRNGExponential(1 / (dist.Mean * scale)), nil
+    } else if strings.EqualFold(dist.Type, "Normal") {
+        return NewRNGNormal(dist.Mean * scale, dist.StdDev * scale), nil
+    } else if strings.EqualFold(dist.Type, "LogNormal") {
+        return NewRNGLogNormal(dist.Mean * scale, dist.StdDev * scale), nil
+    } else if strings.EqualFold(dist.Type, "Triangular") {
+        if !(dist.Min <= dist.Mode && dist.Mode <= dist.Max && dist.Min < dist.Max) {
+            return nil, fmt.Errorf("triangular distribution needs Min <= Mode <= Max")
+        }
+        return NewRNGTriangular(dist.Min * scale, dist.Max * scale, dist.Mode * scale), nil
+    } else if strings.EqualFold(dist.Type, "Discrete") {
+        if len(dist.Weights) == 0 || (len(dist.Values) > 0 && len(dist.Values) != len(dist.Weights)) {
+            return nil, fmt.Errorf("discrete distribution needs one weight per value")
+        }
+        rng := NewRNGDiscrete(dist.Weights)
+        for _, value := range dist.Values {
+            rng.Values = append(rng.Values, value * scale)
+        }
+        return rng, nil
+    }
+    
+    return nil, fmt.Errorf("unknown distribution: %q", dist.Type)
+}
+
+type ResourceSpec struct {
+    Id          string
+    Amount      float64
+}
+
+// RouteSpec sends entities to To with the given probability.
+type RouteSpec struct {
+    To          string
+    Probability float64
+}
+
+// ProcessSpec takes its duration from Duration or from the registered delay
+// function Delay. Entities are forwarded by the registered function
+// Forward, by Routes, or to Next, in this order of precedence.
+type ProcessSpec struct {
+    Id          string
+    Groups      []string
+    Needs       map[string]float64
+    Duration    *DistributionSpec
+    Delay       string
+    Next        string
+    Routes      []RouteSpec
+    Forward     string
+}
+
+type SourceSpec struct {
+    Id              string
+    EntityType      string
+    Interarrival    DistributionSpec
+    First           ModelDuration
+    BatchSize       int
+    MaxGenerations  int
+    To              string
+    Attributes      map[string]float64
+}
+
+type PeriodSpec struct {
+    Duration    ModelDuration
+    Capacity    float64
+}
+
+type ScheduleSpec struct {
+    Resource    string
+    Periods     []PeriodSpec
+    Repeat      bool
+}
+
+// TableSpec is a table of values, given by Rows or read from a file (see
+// data.ReadTable). File is relative to the model file.
+type TableSpec struct {
+    File        string
+    Rows        []map[string]any
+}
+
+// TemplateSpec adds resources, processes, sources and schedules for each
+// row of Table. Occurrences of ${Column} are replaced by the value of the
+// column; a string that is only "${Column}" takes the type of the value.
+type TemplateSpec struct {
+    Table       string
+    Resources   []map[string]any
+    Processes   []map[string]any
+    Sources     []map[string]any
+    Schedules   []map[string]any
+}
+
+// ModelSpec is a model described by a YAML or JSON file (see LoadModel).
+type ModelSpec struct {
+    Name        string
+    Seed        uint64
+    StartTime   string
+    EndDate     ModelDuration
+    Variables   map[string]float64
+    Tables      map[string]TableSpec
+    Resources   []ResourceSpec
+    Processes   []ProcessSpec
+    Sources     []SourceSpec
+    Schedules   []ScheduleSpec
+    Templates   []TemplateSpec
+    
+    Dir         string `json:"-"`
+}
+
+// LoadModel reads a model file and builds an environment from it.
+func LoadModel(path string) (*Environment, error) {
+    spec, err := ReadModel(path)
+    if err != nil {
+        return nil, err
+    }
+    
+    env := NewEnvironment()
+    if spec.Seed != 0 {
+        env.SetSeed(spec.Seed)
+    }
+    
+    if err := spec.Build(env); err != nil {
+        return nil, err
+    }
+    return env, nil
+}
+
+// ReadModel reads a model file without building it, so that it can be
+// built many times, like in sim.Runner. Files ending in .json are read as
+// JSON and anything else as YAML.
+func ReadModel(path string) (*ModelSpec, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    
+    spec, err := ParseModel(data, strings.EqualFold(filepath.Ext(path), ".json"))
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    
+    spec.Dir = filepath.Dir(path)
+    if err := spec.ExpandTemplates(); err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return spec, nil
+}
+
+// ParseModel decodes a model spec. YAML is decoded into generic values and
+// then through JSON, so both formats accept the same fields.
+func ParseModel(data []byte, isJSON bool) (*ModelSpec, error) {
+    if !isJSON {
+        var doc any
+        if err := yaml.Unmarshal(data, &doc); err != nil {
+            return nil, err
+        }
+        
+        var err error
+        if data, err = json.Marshal(doc); err != nil {
+            return nil, err
+        }
+    }
+    
+    spec := &ModelSpec{}
+    decoder := json.NewDecoder(bytes.NewReader(data))
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(spec); err != nil {
+        return nil, err
+    }
+    return spec, nil
+}
+
+// GetTable returns the rows of a table, reading its file if needed.
+func (spec *ModelSpec) GetTable(name string) ([]map[string]any, error) {
+    table, ok := spec.Tables[name]
+    if !ok {
+        return nil, fmt.Errorf("table not found: %s", name)
+    }
+    
+    if table.File == "" {
+        return table.Rows, nil
+    }
+    
+    path := table.File
+    if !filepath.IsAbs(path) {
+        path = filepath.Join(spec.Dir, path)
+    }
+    rows, err := data.ReadTable(path)
+    if err != nil {
+        return nil, err
+    }
+    return GetRows(rows), nil
+}
+
+// GetRows converts a table to rows for templates. Cells that look like
+// numbers are read as numbers.
+func GetRows(table *data.Table) []map[string]any {
+    rows := make([]map[string]any, 0, len(table.Rows))
+    for _, cells := range table.Rows {
+        row := make(map[string]any)
+        for i, column := range table.Columns {
+            if n, err := strconv.ParseFloat(strings.TrimSpace(cells[i]), 64); err == nil {
+                row[column] = n
+            } else {
+                row[column] = cells[i]
+            }
+        }
+        rows = append(rows, row)
+    }
+    return rows
+}
+
+var templateVariable = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// ExpandTemplate replaces ${Column} in all strings of value, including map
+// keys.
+func ExpandTemplate(value any, row map[string]any) (any, error) {
+    if s, ok := value.(string); ok {
+        if match := templateVariable.FindStringSubmatch(s); match != nil && match[0] == s {
+            v, ok := row[match[1]]
+            if !ok {
+                return nil, fmt.Errorf("column not found: %s", match[1])
+            }
+            return v, nil
+        }
+        
+        var err error
+        expanded := templateVariable.ReplaceAllStringFunc(s, func (m string) string {
+            column := templateVariable.FindStringSubmatch(m)[1]
+            v, ok := row[column]
+            if !ok {
+                err = fmt.Errorf("column not found: %s", column)
+                return m
+            }
+            
+            if n, ok := v.(float64); ok {
+                return strconv.FormatFloat(n, 'f', -1, 64)
+            }
+            return fmt.Sprint(v)
+        })
+        return expanded, err
+    }
+    
+    if m, ok := value.(map[string]any); ok {
+        expanded := make(map[string]any, len(m))
+        for key, v := range m {
+            k, err := ExpandTemplate(key, row)
+            if err != nil {
+                return nil, err
+            }
+            
+            e, err := ExpandTemplate(v, row)
+            if err != nil {
+                return nil, err
+            }
+            expanded[fmt.Sprint(k)] = e
+        }
+        return expanded, nil
+    }
+    
+    if a, ok := value.([]any); ok {
+        expanded := make([]any, len(a))
+        for i, v := range a {
+            e, err := ExpandTemplate(v, row)
+            if err != nil {
+                return nil, err
+            }
+            expanded[i] = e
+        }
+        return expanded, nil
+    }
+    
+    return value, nil
+}
+
+// expandTemplateItems expands each item for the row and decodes it into a
+// new element of dst.
+func expandTemplateItems[T any](items []map[string]any, row map[string]any, dst *[]T) error {
+    for _, item := range items {
+        expanded, err := ExpandTemplate(item, row)
+        if err != nil {
+            return err
+        }
+        
+        data, err := json.Marshal(expanded)
+        if err != nil {
+            return err
+        }
+        
+        var t T
+        decoder := json.NewDecoder(bytes.NewReader(data))
+        decoder.DisallowUnknownFields()
+        if err := decoder.Decode(&t); err != nil {
+            return err
+        }
+        *dst = append(*dst, t)
+    }
+    return nil
+}
+
+// ExpandTemplates adds the elements of the templates to the spec.
+func (spec *ModelSpec) ExpandTemplates() error {
+    for i, template := range spec.Templates {
+        rows, err := spec.GetTable(template.Table)
+        if err != nil {
+            return fmt.Errorf("template %d: %w", i, err)
+        }
+        
+        for r, row := range rows {
+            err := expandTemplateItems(template.Resources, row, &spec.Resources)
+            if err == nil {
+                err = expandTemplateItems(template.Processes, row, &spec.Processes)
+            }
+            if err == nil {
+                err = expandTemplateItems(template.Sources, row, &spec.Sources)
+            }
+            if err == nil {
+                err = expandTemplateItems(template.Schedules, row, &spec.Schedules)
+            }
+            if err != nil {
+                return fmt.Errorf("template %d, row %d: %w", i, r+1, err)
+            }
+        }
+    }
+    
+    spec.Templates = nil
+    return nil
+}
+
+// NewRoutingFunc returns a forward function that picks one of the routes
+// at random, with env.Rand.
+func NewRoutingFunc(env *Environment, routes []RouteSpec) func (entity Entity) {
+    total := 0.0
+    for _, route := range routes {
+        total += route.Probability
+    }
+    
+    return func (entity Entity) {
+        u := env.Rand.Float64() * total
+        for _, route := range routes {
+            if u < route.Probability {
+                env.ForwardTo(entity, route.To)
+                return
+            }
+            u -= route.Probability
+        }
+        env.ForwardTo(entity, routes[len(routes)-1].To)
+    }
+}
+
+// Build adds the elements of the model to the environment. The end date
+// and start time of the spec are used if the environment has none.
+func (spec *ModelSpec) Build(env *Environment) error {
+    if spec.EndDate > 0 && env.EndDate == 0 {
+        env.EndDate = float64(spec.EndDate)
+    }
+    
+    if spec.StartTime != "" && env.StartTime.IsZero() {
+        startTime, err := time.Parse(time.RFC3339, spec.StartTime)
+        if err != nil {
+            if startTime, err = time.Parse(time.DateOnly, spec.StartTime); err != nil {
+                return fmt.Errorf("invalid start time: %q", spec.StartTime)
+            }
+        }
+        env.StartTime = startTime
+    }
+    
+    for name, value := range spec.Variables {
+        env.SetVariable(name, value)
+    }
+    
+    for _, resource := range spec.Resources {
+        if _, ok := env.Resources[resource.Id]; ok {
+            return fmt.Errorf("duplicate resource: %s", resource.Id)
+        }
+        env.AddResource(&ResourceBase{Id: resource.Id, Amount: resource.Amount})
+    }
+    
+    destinations := make(map[string]string)
+    
+    for _, process := range spec.Processes {
+        if env.GetProcess(process.Id) != nil {
+            return fmt.Errorf("duplicate process: %s", process.Id)
+        }
+        
+        base := ProcessBase{Id: process.Id, Groups: process.Groups, Needs: process.Needs, NextProcess: process.Next, Routes: process.Routes}
+        
+        for rid, _ := range process.Needs {
+            if _, ok := env.Resources[rid]; !ok {
+                return fmt.Errorf("process %s: resource not found: %s", process.Id, rid)
+            }
+        }
+        
+        if process.Delay != "" {
+            delayFunc, ok := GetDelayFunc(process.Delay)
+            if !ok {
+                return fmt.Errorf("process %s: delay function not registered: %s", process.Id, process.Delay)
+            }
+            base.DelayFunc = delayFunc
+        } else if process.Duration != nil {
+            rng, err := process.Duration.NewRNG()
+            if err != nil {
+                return fmt.Errorf("process %s: %w", process.Id, err)
+            }
+            base.RNG = rng
+        } else {
+            return fmt.Errorf("process %s: no duration or delay function", process.Id)
+        }
+        
+        if process.Forward != "" {
+            forwardFunc, ok := GetForwardFunc(process.Forward)
+            if !ok {
+                return fmt.Errorf("process %s: forward function not registered: %s", process.Id, process.Forward)
+            }
+            base.Forward = forwardFunc
+        } else if len(process.Routes) > 0 {
+            for _, route := range process.Routes {
+                destinations[route.To] = "process " + process.Id
+            }
+        } else if process.Next != "" {
+            destinations[process.Next] = "process " + process.Id
+        }
+        
+        env.AddProcess(base)
+    }
+    
+    for _, source := range spec.Sources {
+        rng, err := source.Interarrival.NewRNG()
+        if err != nil {
+            return fmt.Errorf("source %s: %w", source.Id, err)
+        }
+        
+        entityType := source.EntityType
+        if entityType == "" {
+            entityType = source.Id
+        }
+        
+        modelSource := &ModelSource{EntityType: entityType, To: source.To, Attributes: source.Attributes}
+        modelSource.EntitySourceBase = EntitySourceBase{Id: source.Id, RNG: rng, BatchSize: source.BatchSize, NextGen: float64(source.First)}
+        env.AddEntitySource(modelSource)
+        
+        if source.MaxGenerations > 0 {
+            modelSource.MaxGenerations = source.MaxGenerations
+        }
+        destinations[source.To] = "source " + source.Id
+    }
+    
+    for to, from := range destinations {
+        if _, ok := env.Stations[to]; !ok && env.GetProcess(to) == nil {
+            return fmt.Errorf("%s: destination not found: %s", from, to)
+        }
+    }
+    
+    for _, schedule := range spec.Schedules {
+        if _, ok := env.Resources[schedule.Resource]; !ok {
+            return fmt.Errorf("schedule: resource not found: %s", schedule.Resource)
+        }
+        if len(schedule.Periods) == 0 {
+            return fmt.Errorf("schedule %s: no periods", schedule.Resource)
+        }
+        
+        resourceSchedule := ResourceSchedule{Resource: schedule.Resource, Repeat: schedule.Repeat}
+        for _, period := range schedule.Periods {
+            resourceSchedule.Durations = append(resourceSchedule.Durations, float64(period.Duration))
+            resourceSchedule.Capacities = append(resourceSchedule.Capacities, period.Capacity)
+        }
+        env.AddResourceSchedule(resourceSchedule)
+    }
+    
+    return nil
+}
@@ -0,0 +1,370 @@
+package sim
+
+import (
+    "fmt"
+    "io"
+    "log"
+    "slices"
+    "time"
+)
+
+const (
+    EventType_MonitorSample string = "MonitorSample"
+)
+
+const (
+    Period_Hour     string = "Hour"
+    Period_Day      string = "Day"
+    Period_Week     string = "Week" // starting on Monday
+    Period_Month    string = "Month"
+    Period_Year     string = "Year"
+)
+
+type MonitorSample struct {
+    Date    float64
+    Value   float64
+}
+
+// Monitor records a time series of Value, like a queue size, the level of
+// a tank or a running total. If Interval is 0 it is sampled after every
+// step of the simulation and a sample is kept when the value changes;
+// otherwise it is sampled every Interval seconds. The value is taken to
+// hold from each sample to the next.
+type Monitor struct {
+    Id          string
+    Value       func (env *Environment) float64
+    Interval    float64 // seconds, 0 to sample on change
+    
+    Samples     []MonitorSample
+}
+
+func (env *Environment) AddMonitor(monitor Monitor) *Monitor {
+    if monitor.Value == nil {
+        log.Fatalf("Monitor without value: %s", monitor.Id)
+    }
+    
+    if env.GetMonitor(monitor.Id) != nil {
+        log.Fatalf("Duplicate monitor: %s", monitor.Id)
+    }
+    
+    monitor.Samples = make([]MonitorSample, 0)
+    env.Monitors = append(env.Monitors, &monitor)
+    if monitor.Interval > 0 {
+        env.AddEventHandler(EventType_MonitorSample, env.HandleMonitorSample)
+    }
+    return &monitor
+}
+
+func (env *Environment) GetMonitor(id string) *Monitor {
+    for _, monitor := range env.Monitors {
+        if monitor.Id == id {
+            return monitor
+        }
+    }
+    return nil
+}
+
+// MonitorQueueSize monitors the queue size of a process, hold or conveyor.
+func (env *Environment) MonitorQueueSize(id string, interval float64) *Monitor {
+    return env.AddMonitor(Monitor{
+        Id: GetResultsKey("Monitor", id, "QueueSize"),
+        Interval: interval,
+        Value: func (env *Environment) float64 {
+            if process := env.GetProcess(id); process != nil {
+                return float64(process.GetQueueSize())
+            } else if hold := env.GetHold(id); hold != nil {
+                return float64(hold.GetQueueSize())
+            } else if conveyor := env.GetConveyor(id); conveyor != nil {
+                return float64(conveyor.GetQueueSize())
+            }
+            log.Fatalf("Station not found: %s", id)
+            return 0
+        },
+    })
+}
+
+// MonitorResourceBusy monitors the amount of a resource in use.
+func (env *Environment) MonitorResourceBusy(rid string, interval float64) *Monitor {
+    return env.AddMonitor(Monitor{
+        Id: GetResultsKey("Monitor", rid, "Busy"),
+        Interval: interval,
+        Value: func (env *Environment) float64 {
+            base := env.Resources[rid].GetResourceBase()
+            return base.Capacity - base.Amount
+        },
+    })
+}
+
+// MonitorVariable monitors a variable set with SetVariable, like a tank
+// level or a running total.
+func (env *Environment) MonitorVariable(name string, interval float64) *Monitor {
+    return env.AddMonitor(Monitor{
+        Id: GetResultsKey("Monitor", name, "Value"),
+        Interval: interval,
+        Value: func (env *Environment) float64 {
+            return env.Variables[name]
+        },
+    })
+}
+
+func (monitor *Monitor) Record(date float64, value float64) {
+    n := len(monitor.Samples)
+    if n > 0 && monitor.Samples[n-1].Date == date {
+        monitor.Samples[n-1].Value = value
+        return
+    }
+    monitor.Samples = append(monitor.Samples, MonitorSample{Date: date, Value: value})
+}
+
+// Sample records the current value if it changed since the last sample.
+func (monitor *Monitor) Sample(env *Environment) {
+    value := monitor.Value(env)
+    n := len(monitor.Samples)
+    if n > 0 && monitor.Samples[n-1].Value == value {
+        return
+    }
+    monitor.Record(env.Now, value)
+}
+
+// BeginMonitors takes the first samples and schedules the monitors that
+// are sampled at intervals. Restored runs keep their scheduled samples.
+func (env *Environment) BeginMonitors() {
+    for _, monitor := range env.Monitors {
+        if monitor.Interval > 0 {
+            if !env.Restored {
+                env.Schedule(Event{Date: env.Now, Type: EventType_MonitorSample, Id: monitor.Id})
+            }
+        } else {
+            monitor.Sample(env)
+        }
+    }
+}
+
+// SampleMonitors samples the monitors that record changes, after a step.
+func (env *Environment) SampleMonitors() {
+    for _, monitor := range env.Monitors {
+        if monitor.Interval <= 0 {
+            monitor.Sample(env)
+        }
+    }
+}
+
+func (env *Environment) HandleMonitorSample(event Event) {
+    monitor := env.GetMonitor(event.Id)
+    if monitor == nil {
+        log.Fatalf("Monitor not found: %s", event.Id)
+    }
+    
+    monitor.Record(env.Now, monitor.Value(env))
+    env.Schedule(Event{Date: env.Now + monitor.Interval, Type: EventType_MonitorSample, Id: monitor.Id})
+}
+
+// GetPeriodStart returns the start of the calendar period (Period_Hour,
+// Period_Day, ...) that contains date.
+func (env *Environment) GetPeriodStart(date float64, period string) float64 {
+    t := env.GetDate(date)
+    location := env.StartTime.Location()
+    
+    if period == Period_Hour {
+        t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, location)
+    } else if period == Period_Day {
+        t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+    } else if period == Period_Week {
+        days := (int(t.Weekday()) + 6) % 7
+        t = time.Date(t.Year(), t.Month(), t.Day() - days, 0, 0, 0, 0, location)
+    } else if period == Period_Month {
+        t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, location)
+    } else if period == Period_Year {
+        t = time.Date(t.Year(), 1, 1, 0, 0, 0, 0, location)
+    } else {
+        log.Fatalf("Invalid period: %s", period)
+    }
+    return env.GetSeconds(t)
+}
+
+// GetPeriodEnd returns the start of the period after the one that starts
+// at start.
+func (env *Environment) GetPeriodEnd(start float64, period string) float64 {
+    t := env.GetDate(start)
+    if period == Period_Hour {
+        t = t.Add(time.Hour)
+    } else if period == Period_Day {
+        t = t.AddDate(0, 0, 1)
+    } else if period == Period_Week {
+        t = t.AddDate(0, 0, 7)
+    } else if period == Period_Month {
+        t = t.AddDate(0, 1, 0)
+    } else if period == Period_Year {
+        t = t.AddDate(1, 0, 0)
+    } else {
+        log.Fatalf("Invalid period: %s", period)
+    }
+    return env.GetSeconds(t)
+}
+
+func (env *Environment) GetPeriodLabel(start float64, period string) string {
+    t := env.GetDate(start)
+    if period == Period_Hour {
+        return t.Format("2006-01-02 15h")
+    } else if period == Period_Month {
+        return t.Format("2006-01")
+    } else if period == Period_Year {
+        return t.Format("2006")
+    }
+    return t.Format("2006-01-02")
+}
+
+// MonitorPeriod aggregates the samples of a monitor over a calendar period.
+// Mean is weighted by time, Last is the value at the end of the period and
+// Change is Last minus the value at its start, which for running totals is
+// the amount added in the period.
+type MonitorPeriod struct {
+    Label       string
+    Start       float64
+    End         float64 // the current time for the last period
+    Samples     int
+    Mean        float64
+    Min         float64
+    Max         float64
+    Last        float64
+    Change      float64
+}
+
+// Aggregate returns the periods from the first sample of the monitor to
+// the current time.
+func (monitor *Monitor) Aggregate(env *Environment, period string) []MonitorPeriod {
+    periods := make([]MonitorPeriod, 0)
+    if len(monitor.Samples) == 0 {
+        return periods
+    }
+    
+    start := env.GetPeriodStart(monitor.Samples[0].Date, period)
+    value := monitor.Samples[0].Value
+    s := 0
+    for start < env.Now {
+        end := env.GetPeriodEnd(start, period)
+        p := MonitorPeriod{Label: env.GetPeriodLabel(start, period), Start: start, End: min(end, env.Now), Min: value, Max: value}
+        first := value
+        date := max(start, monitor.Samples[0].Date)
+        area := 0.0
+        
+        for ; s < len(monitor.Samples) && monitor.Samples[s].Date < end; s++ {
+            sample := monitor.Samples[s]
+            area += value * (sample.Date - date)
+            date = sample.Date
+            value = sample.Value
+            p.Samples++
+            p.Min = min(p.Min, value)
+            p.Max = max(p.Max, value)
+        }
+        
+        area += value * (p.End - date)
+        if p.End > max(start, monitor.Samples[0].Date) {
+            p.Mean = area / (p.End - max(start, monitor.Samples[0].Date))
+        } else {
+            p.Mean = value
+        }
+        p.Last = value
+        p.Change = value - first
+        periods = append(periods, p)
+        start = end
+    }
+    return periods
+}
+
+// WriteTSV writes the samples of the monitor.
+func (monitor *Monitor) WriteTSV(w io.Writer) error {
+    if _, err := fmt.Fprintf(w, "Date\tValue\n"); err != nil {
+        return err
+    }
+    
+    for _, sample := range monitor.Samples {
+        if _, err := fmt.Fprintf(w, "%g\t%g\n", sample.Date, sample.Value); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// WriteMonitorsTSV writes every monitor aggregated by period, one row per
+// monitor and period.
+func (env *Environment) WriteMonitorsTSV(w io.Writer, period string) error {
+    if _, err := fmt.Fprintf(w, "Monitor\tPeriod\tStart\tEnd\tSamples\tMean\tMin\tMax\tLast\tChange\n"); err != nil {
+        return err
+    }
+    
+    for _, monitor := range env.Monitors {
+        for _, p := range monitor.Aggregate(env, period) {
+            _, err := fmt.Fprintf(w, "%s\t%s\t%g\t%g\t%d\t%g\t%g\t%g\t%g\t%g\n", monitor.Id, p.Label, p.Start, p.End, p.Samples, p.Mean, p.Min, p.Max, p.Last, p.Change)
+            if err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// GetMonitorPeriodValue returns a field of MonitorPeriod by name: "Mean",
+// "Min", "Max", "Last" or "Change".
+func GetMonitorPeriodValue(p MonitorPeriod, statistic string) float64 {
+    if statistic == "Mean" {
+        return p.Mean
+    } else if statistic == "Min" {
+        return p.Min
+    } else if statistic == "Max" {
+        return p.Max
+    } else if statistic == "Last" {
+        return p.Last
+    } else if statistic == "Change" {
+        return p.Change
+    }
+    log.Fatalf("Invalid monitor statistic: %s", statistic)
+    return 0
+}
+
+// WriteMonitorsTable writes one statistic of every monitor by period, with
+// a row per period and a column per monitor, to compare with historical
+// data kept in the same shape.
+func (env *Environment) WriteMonitorsTable(w io.Writer, period string, statistic string) error {
+    labels := make([]string, 0)
+    values := make(map[string][]string)
+    
+    if _, err := fmt.Fprintf(w, "Period"); err != nil {
+        return err
+    }
+    
+    for m, monitor := range env.Monitors {
+        if _, err := fmt.Fprintf(w, "\t%s", monitor.Id); err != nil {
+            return err
+        }
+        
+        for _, p := range monitor.Aggregate(env, period) {
+            if _, ok := values[p.Label]; !ok {
+                labels = append(labels, p.Label)
+                values[p.Label] = make([]string, len(env.Monitors))
+            }
+            values[p.Label][m] = fmt.Sprintf("%g", GetMonitorPeriodValue(p, statistic))
+        }
+    }
+    
+    if _, err := fmt.Fprintf(w, "\n"); err != nil {
+        return err
+    }
+    
+    // labels sort like dates
+    slices.Sort(labels)
+    for _, label := range labels {
+        if _, err := fmt.Fprintf(w, "%s", label); err != nil {
+            return err
+        }
+        for _, value := range values[label] {
+            if _, err := fmt.Fprintf(w, "\t%s", value); err != nil {
+                return err
+            }
+        }
+        if _, err := fmt.Fprintf(w, "\n"); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,307 @@
+// Package network moves entities along the links of a graph of nodes.
+//
+// Each link is modeled as a sim resource (its occupancy) and a sim process
+// (the traversal), so entities moving through the network queue for busy
+// links and show up in the process statistics like any other activity.
+package network
+
+import (
+    "container/heap"
+    "fmt"
+    "log"
+    "math"
+    "github.com/nidoro/sim"
+)
+
+type Node struct {
+    Id      string
+    X       float64
+    Y       float64
+}
+
+// Link is a directed connection between two nodes. Track is the id of the
+// resource that models its occupancy; links sharing a Track (like the two
+// directions of a single track railway) exclude each other. Capacity is
+// how many entities can be on the track at the same time.
+type Link struct {
+    From        string
+    To          string
+    Length      float64
+    Speed       float64
+    Capacity    float64
+    Track       string
+}
+
+type Path struct {
+    Nodes       []string
+    Length      float64
+}
+
+// Mover can be implemented by entities that have a top speed of their
+// own. Their travel time over a link uses the lowest of both speeds.
+type Mover interface {
+    GetSpeed() float64
+}
+
+type Move struct {
+    Path        *Path
+    Step        int
+    Then        string
+    DateStart   float64
+}
+
+type Network struct {
+    Id          string
+    Nodes       map[string]*Node
+    Links       map[string]map[string]*Link
+    Outgoing    map[string][]*Link
+    NodeIds     []string
+    Moves       map[int]*Move
+    Paths       map[string]map[string]*Path
+    Env         *sim.Environment
+}
+
+func NewNetwork(id string) *Network {
+    return &Network{
+        Id: id,
+        Nodes: make(map[string]*Node),
+        Links: make(map[string]map[string]*Link),
+        Outgoing: make(map[string][]*Link),
+        NodeIds: make([]string, 0),
+        Moves: make(map[int]*Move),
+        Paths: make(map[string]map[string]*Path),
+    }
+}
+
+func (net *Network) AddNode(node Node) *Node {
+    if n, ok := net.Nodes[node.Id]; ok {
+        return n
+    }
+    
+    n := &node
+    net.Nodes[n.Id] = n
+    net.Links[n.Id] = make(map[string]*Link)
+    net.NodeIds = append(net.NodeIds, n.Id)
+    return n
+}
+
+// AddLink adds a directed link, creating its nodes if needed.
+func (net *Network) AddLink(link Link) *Link {
+    if net.Env != nil {
+        log.Fatalf("Network already built: %s", net.Id)
+    }
+    
+    if link.Speed <= 0 || link.Length < 0 {
+        log.Fatalf("Invalid link: %s | %s -> %s | length %g, speed %g", net.Id, link.From, link.To, link.Length, link.Speed)
+    }
+    
+    net.AddNode(Node{Id: link.From})
+    net.AddNode(Node{Id: link.To})
+    
+    if link.Track == "" {
+        link.Track = fmt.Sprintf("%s %s %s", net.Id, link.From, link.To)
+    }
+    
+    link.Capacity = max(1, link.Capacity)
+    
+    l := &link
+    if old, ok := net.Links[link.From][link.To]; ok {
+        *old = link
+        l = old
+    } else {
+        net.Links[link.From][link.To] = l
+        net.Outgoing[link.From] = append(net.Outgoing[link.From], l)
+    }
+    net.Paths = make(map[string]map[string]*Path)
+    return l
+}
+
+// AddEdge adds links in both directions sharing the same track.
+func (net *Network) AddEdge(link Link) {
+    if link.Track == "" {
+        link.Track = fmt.Sprintf("%s %s %s", net.Id, link.From, link.To)
+    }
+    
+    net.AddLink(link)
+    link.From, link.To = link.To, link.From
+    net.AddLink(link)
+}
+
+func (net *Network) GetLink(from string, to string) *Link {
+    return net.Links[from][to]
+}
+
+func (net *Network) GetProcessId(link *Link) string {
+    return fmt.Sprintf("MOVE %s %s %s", net.Id, link.From, link.To)
+}
+
+// Build adds the resources and processes that model the links to env.
+func (net *Network) Build(env *sim.Environment) {
+    net.Env = env
+    tracks := make(map[string]float64)
+    
+    for _, from := range net.NodeIds {
+        for _, link := range net.Outgoing[from] {
+            link := link
+            if _, ok := tracks[link.Track]; !ok {
+                tracks[link.Track] = link.Capacity
+                env.AddResource(&sim.ResourceBase{Id: link.Track, Amount: link.Capacity})
+            }
+            
+            env.AddProcess(sim.ProcessBase{
+                Id: net.GetProcessId(link),
+                Groups: []string{"MOVE", net.Id},
+                Needs: map[string]float64{
+                    link.Track: 1,
+                },
+                DelayFunc: func (process *sim.ProcessBase, entity sim.Entity) float64 {
+                    return net.GetTravelTime(link, entity)
+                },
+                Forward: net.Forward,
+                Transfer: true,
+            })
+        }
+    }
+}
+
+func (net *Network) GetTravelTime(link *Link, entity sim.Entity) float64 {
+    speed := link.Speed
+    if mover, ok := entity.(Mover); ok && mover.GetSpeed() > 0 {
+        speed = min(speed, mover.GetSpeed())
+    }
+    return link.Length / speed
+}
+
+type queueItem struct {
+    node    string
+    dist    float64
+    index   int
+}
+
+type priorityQueue []*queueItem
+
+func (pq priorityQueue) Len() int           { return len(pq) }
+func (pq priorityQueue) Less(i, j int) bool { return pq[i].dist < pq[j].dist }
+func (pq priorityQueue) Swap(i, j int)      { pq[i], pq[j] = pq[j], pq[i]; pq[i].index = i; pq[j].index = j }
+func (pq *priorityQueue) Push(x any)        { item := x.(*queueItem); item.index = len(*pq); *pq = append(*pq, item) }
+func (pq *priorityQueue) Pop() any {
+    old := *pq
+    item := old[len(old)-1]
+    *pq = old[:len(old)-1]
+    return item
+}
+
+// ShortestPath returns the shortest path by length from one node to another.
+// Paths are cached until a link is added.
+func (net *Network) ShortestPath(from string, to string) (*Path, bool) {
+    if cached, ok := net.Paths[from][to]; ok {
+        return cached, cached != nil
+    }
+    
+    if _, ok := net.Paths[from]; !ok {
+        net.Paths[from] = make(map[string]*Path)
+    }
+    
+    dist := map[string]float64{from: 0}
+    prev := make(map[string]string)
+    done := make(map[string]bool)
+    pq := &priorityQueue{}
+    heap.Push(pq, &queueItem{node: from})
+    
+    for pq.Len() > 0 {
+        item := heap.Pop(pq).(*queueItem)
+        if done[item.node] {
+            continue
+        }
+        done[item.node] = true
+        
+        if item.node == to {
+            break
+        }
+        
+        for _, link := range net.Outgoing[item.node] {
+            next := link.To
+            if done[next] {
+                continue
+            }
+            
+            d := item.dist + link.Length
+            if current, ok := dist[next]; !ok || d < current {
+                dist[next] = d
+                prev[next] = item.node
+                heap.Push(pq, &queueItem{node: next, dist: d})
+            }
+        }
+    }
+    
+    if !done[to] {
+        net.Paths[from][to] = nil
+        return nil, false
+    }
+    
+    nodes := []string{to}
+    for node := to; node != from; {
+        node = prev[node]
+        nodes = append([]string{node}, nodes...)
+    }
+    
+    path := &Path{Nodes: nodes, Length: dist[to]}
+    net.Paths[from][to] = path
+    return path, true
+}
+
+// Distance returns the length of the shortest path between two nodes, or
+// +Inf if there is none. It can be used as a sim.TransporterBase Distance.
+func (net *Network) Distance(from string, to string) float64 {
+    path, ok := net.ShortestPath(from, to)
+    if !ok {
+        return math.Inf(1)
+    }
+    return path.Length
+}
+
+// Move sends the entity along the shortest path between two nodes, one link
+// at a time, and forwards it to then when it arrives, or disposes it if then
+// is empty.
+func (net *Network) Move(entity sim.Entity, from string, to string, then string) {
+    path, ok := net.ShortestPath(from, to)
+    if !ok {
+        log.Fatalf("Path not found: %s | %s -> %s", net.Id, from, to)
+    }
+    
+    net.Moves[entity.GetId()] = &Move{Path: path, Then: then, DateStart: net.Env.Now}
+    net.Forward(entity)
+}
+
+// Forward sends the entity to its next link, or to the destination process
+// of its move if it has arrived. Entities arriving with nowhere to go are
+// disposed.
+func (net *Network) Forward(entity sim.Entity) {
+    env := net.Env
+    move := net.Moves[entity.GetId()]
+    
+    if move.Step < len(move.Path.Nodes)-1 {
+        link := net.Links[move.Path.Nodes[move.Step]][move.Path.Nodes[move.Step+1]]
+        move.Step++
+        env.ForwardTo(entity, net.GetProcessId(link))
+        return
+    }
+    
+    delete(net.Moves, entity.GetId())
+    
+    if move.Then != "" {
+        env.ForwardTo(entity, move.Then)
+    } else {
+        env.Dispose(entity)
+    }
+}
+
+// GetPosition returns the link the entity is currently on (or queued for),
+// or nil if it is not moving in the network.
+func (net *Network) GetPosition(entity sim.Entity) *Link {
+    move, ok := net.Moves[entity.GetId()]
+    if !ok || move.Step == 0 {
+        return nil
+    }
+    return net.Links[move.Path.Nodes[move.Step-1]][move.Path.Nodes[move.Step]]
+}
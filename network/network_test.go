@@ -0,0 +1,45 @@
+package network
+
+import (
+    "testing"
+    "github.com/nidoro/sim"
+)
+
+type Source struct {
+    sim.EntitySourceBase
+    Net         *Network
+    Then        string
+}
+
+func (source *Source) Generate() sim.Entity {
+    env := source.GetEnvironment()
+    entity := &sim.EntityBase{}
+    env.AddEntity("Train", entity)
+    source.Net.Move(entity, "A", "C", source.Then)
+    return entity
+}
+
+// A train leaves A every 100 s and takes 10 s on each link to C.
+func BuildLine(env *sim.Environment, then string) *Network {
+    net := NewNetwork("Line")
+    net.AddLink(Link{From: "A", To: "B", Length: 10, Speed: 1})
+    net.AddLink(Link{From: "B", To: "C", Length: 10, Speed: 1})
+    net.Build(env)
+    env.AddEntitySource(&Source{EntitySourceBase: sim.EntitySourceBase{Id: "Trains", RNG: &sim.RNGConstant{Value: 100}}, Net: net, Then: then})
+    return net
+}
+
+func TestMoveWithoutThen(t *testing.T) {
+    env := sim.NewEnvironment()
+    env.EndDate = 1000
+    net := BuildLine(env, "")
+    env.Run()
+    
+    st := env.GetEntityTypeStatistics("Train")
+    if st.Disposed != 10 || st.SystemTime.Mean != 20 {
+        t.Errorf("got %d trains disposed with a mean time of %g, want 10 and 20", st.Disposed, st.SystemTime.Mean)
+    }
+    if len(env.Entities) != 0 || len(net.Moves) != 0 {
+        t.Errorf("got %d entities and %d moves, want none", len(env.Entities), len(net.Moves))
+    }
+}
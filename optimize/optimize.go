@@ -0,0 +1,415 @@
+// Package optimize searches for the values of integer parameters of a model,
+// like resource amounts, that give the best result over replications.
+//
+// Every candidate is simulated with the same seeds (common random numbers),
+// so candidates are compared under the same conditions.
+package optimize
+
+import (
+    "fmt"
+    "math"
+    "slices"
+    "strings"
+    "golang.org/x/exp/rand"
+    "github.com/nidoro/sim"
+    "github.com/nidoro/sim/analysis"
+    "github.com/nidoro/sim/scenario"
+)
+
+type Method int
+
+const (
+    Method_SimulatedAnnealing Method = iota
+    Method_Genetic
+)
+
+// Variable is an integer decision variable that takes the values
+// Min, Min+Step, ..., up to Max.
+type Variable struct {
+    Name    string
+    Min     int
+    Max     int
+    Step    int
+}
+
+func (variable *Variable) GetNumValues() int {
+    return (variable.Max - variable.Min) / max(1, variable.Step) + 1
+}
+
+func (variable *Variable) GetValue(i int) int {
+    return variable.Min + i*max(1, variable.Step)
+}
+
+// Clamp limits a value to the range of the variable, between Min and the
+// last of its values, which is below Max if Max - Min is not a multiple of
+// Step.
+func (variable *Variable) Clamp(value int) int {
+    return min(variable.GetValue(variable.GetNumValues()-1), max(variable.Min, value))
+}
+
+type Candidate struct {
+    Values      []int
+    Params      scenario.Parameters
+    Feasible    bool
+    Samples     []float64
+    Objective   analysis.Interval
+}
+
+func (candidate *Candidate) GetKey() string {
+    return fmt.Sprint(candidate.Values)
+}
+
+// Optimizer evaluates candidates by running Replications replications of
+// the model built by Build with the Base parameters and the candidate
+// values. The objective of a replication is Objective(results), if set, or
+// else the result with key Key. Candidates that break any of the
+// Constraints are not simulated.
+type Optimizer struct {
+    Build           func (env *sim.Environment, params scenario.Parameters)
+    Base            scenario.Parameters
+    Variables       []Variable
+    Constraints     []func (params scenario.Parameters) bool
+    Key             string
+    Objective       func (results *sim.Results) float64
+    Minimize        bool
+    Replications    int
+    Workers         int
+    Seed            uint64
+    EndDate         float64
+    WarmUp          float64
+    Confidence      float64
+    
+    Method          Method
+    MaxEvaluations  int
+    Start           []int // a random feasible point if nil or infeasible
+    
+    // Simulated annealing
+    Temperature     float64
+    Cooling         float64
+    
+    // Genetic algorithm
+    PopulationSize  int
+    MutationRate    float64
+    
+    Rand            *rand.Rand
+    Candidates      map[string]*Candidate
+    Best            *Candidate
+}
+
+func (opt *Optimizer) GetParams(values []int) scenario.Parameters {
+    overrides := make(scenario.Parameters)
+    for i, variable := range opt.Variables {
+        overrides[variable.Name] = float64(values[i])
+    }
+    return opt.Base.Merge(overrides)
+}
+
+func (opt *Optimizer) IsFeasible(params scenario.Parameters) bool {
+    for _, constraint := range opt.Constraints {
+        if !constraint(params) {
+            return false
+        }
+    }
+    return true
+}
+
+// IsBetter tells whether candidate a has a better mean objective than b.
+func (opt *Optimizer) IsBetter(a *Candidate, b *Candidate) bool {
+    if b == nil || !b.Feasible {
+        return a.Feasible
+    }
+    if !a.Feasible {
+        return false
+    }
+    if opt.Minimize {
+        return a.Objective.Mean < b.Objective.Mean
+    }
+    return a.Objective.Mean > b.Objective.Mean
+}
+
+// Evaluate simulates a candidate, or returns it from previous evaluations.
+func (opt *Optimizer) Evaluate(values []int) *Candidate {
+    candidate := &Candidate{Values: slices.Clone(values)}
+    if previous, ok := opt.Candidates[candidate.GetKey()]; ok {
+        return previous
+    }
+    
+    candidate.Params = opt.GetParams(values)
+    candidate.Feasible = opt.IsFeasible(candidate.Params)
+    opt.Candidates[candidate.GetKey()] = candidate
+    
+    if !candidate.Feasible {
+        return candidate
+    }
+    
+    runner := &sim.Runner{
+        Build: func (env *sim.Environment) {
+            opt.Build(env, candidate.Params)
+        },
+        Replications: opt.Replications,
+        Workers: opt.Workers,
+        Seed: opt.Seed,
+        EndDate: opt.EndDate,
+        WarmUp: opt.WarmUp,
+    }
+    runner.Run()
+    
+    for _, results := range runner.Results {
+        if opt.Objective != nil {
+            candidate.Samples = append(candidate.Samples, opt.Objective(results))
+        } else {
+            candidate.Samples = append(candidate.Samples, results.Values[opt.Key])
+        }
+    }
+    
+    confidence := opt.Confidence
+    if confidence <= 0 {
+        confidence = analysis.DefaultConfidence
+    }
+    candidate.Objective = analysis.NewInterval(candidate.Samples, confidence)
+    
+    if opt.IsBetter(candidate, opt.Best) {
+        opt.Best = candidate
+    }
+    
+    return candidate
+}
+
+func (opt *Optimizer) GetNumEvaluations() int {
+    n := 0
+    for _, candidate := range opt.Candidates {
+        if candidate.Feasible {
+            n++
+        }
+    }
+    return n
+}
+
+func (opt *Optimizer) IsDone() bool {
+    return opt.GetNumEvaluations() >= opt.MaxEvaluations
+}
+
+func (opt *Optimizer) GetRandomValues() []int {
+    values := make([]int, len(opt.Variables))
+    for i, variable := range opt.Variables {
+        values[i] = variable.GetValue(opt.Rand.Intn(variable.GetNumValues()))
+    }
+    return values
+}
+
+// GetRandomFeasible returns random values that satisfy the constraints, or
+// nil if none is found after many attempts.
+func (opt *Optimizer) GetRandomFeasible() []int {
+    for i := 0; i < 1000; i++ {
+        values := opt.GetRandomValues()
+        if opt.IsFeasible(opt.GetParams(values)) {
+            return values
+        }
+    }
+    return nil
+}
+
+// GetNeighbor moves one random variable one or more steps up or down.
+func (opt *Optimizer) GetNeighbor(values []int) []int {
+    neighbor := slices.Clone(values)
+    i := opt.Rand.Intn(len(opt.Variables))
+    variable := &opt.Variables[i]
+    steps := 1 + opt.Rand.Intn(max(1, variable.GetNumValues()/4))
+    
+    if opt.Rand.Intn(2) == 0 {
+        steps = -steps
+    }
+    
+    neighbor[i] = variable.Clamp(values[i] + steps*max(1, variable.Step))
+    return neighbor
+}
+
+// Run searches the decision space until MaxEvaluations feasible candidates
+// have been simulated, and returns the best one.
+func (opt *Optimizer) Run() *Candidate {
+    opt.Candidates = make(map[string]*Candidate)
+    opt.Best = nil
+    
+    if opt.Rand == nil {
+        opt.Rand = rand.New(rand.NewSource(opt.Seed))
+    }
+    
+    if opt.MaxEvaluations <= 0 {
+        opt.MaxEvaluations = 50
+    }
+    
+    if opt.Method == Method_Genetic {
+        opt.RunGenetic()
+    } else {
+        opt.RunSimulatedAnnealing()
+    }
+    
+    return opt.Best
+}
+
+// GetStart returns Start, if it satisfies the constraints, or else random
+// feasible values, or nil if none is found.
+func (opt *Optimizer) GetStart() []int {
+    if opt.Start != nil && opt.IsFeasible(opt.GetParams(opt.Start)) {
+        return opt.Start
+    }
+    return opt.GetRandomFeasible()
+}
+
+func (opt *Optimizer) RunSimulatedAnnealing() {
+    current := opt.GetStart()
+    if current == nil {
+        return
+    }
+    
+    currentCandidate := opt.Evaluate(current)
+    temperature := opt.Temperature
+    if temperature <= 0 {
+        temperature = max(1, 0.1*math.Abs(currentCandidate.Objective.Mean))
+    }
+    cooling := opt.Cooling
+    if cooling <= 0 || cooling >= 1 {
+        cooling = 0.95
+    }
+    
+    for i := 0; i < 100*opt.MaxEvaluations && !opt.IsDone(); i++ {
+        candidate := opt.Evaluate(opt.GetNeighbor(current))
+        if !candidate.Feasible {
+            continue
+        }
+        
+        delta := candidate.Objective.Mean - currentCandidate.Objective.Mean
+        if !opt.Minimize {
+            delta = -delta
+        }
+        
+        if delta <= 0 || opt.Rand.Float64() < math.Exp(-delta/temperature) {
+            current = candidate.Values
+            currentCandidate = candidate
+        }
+        
+        temperature *= cooling
+    }
+}
+
+func (opt *Optimizer) RunGenetic() {
+    size := max(4, opt.PopulationSize)
+    mutationRate := opt.MutationRate
+    if mutationRate <= 0 {
+        mutationRate = 1 / float64(len(opt.Variables))
+    }
+    
+    // only feasible candidates take part in tournaments
+    population := make([]*Candidate, 0, size)
+    if start := opt.GetStart(); start != nil {
+        population = append(population, opt.Evaluate(start))
+    }
+    
+    for len(population) < size {
+        values := opt.GetRandomFeasible()
+        if values == nil {
+            break
+        }
+        population = append(population, opt.Evaluate(values))
+    }
+    
+    if len(population) == 0 {
+        return
+    }
+    
+    tournament := func () *Candidate {
+        a := population[opt.Rand.Intn(len(population))]
+        b := population[opt.Rand.Intn(len(population))]
+        if opt.IsBetter(b, a) {
+            return b
+        }
+        return a
+    }
+    
+    for generation := 0; generation < 100*opt.MaxEvaluations && !opt.IsDone(); generation++ {
+        next := make([]*Candidate, 0, size)
+        if opt.Best != nil {
+            next = append(next, opt.Best)
+        }
+        
+        // infeasible children are not evaluations, so they are bounded
+        // separately
+        for attempts := 0; len(next) < size && attempts < 100*size && !opt.IsDone(); attempts++ {
+            a := tournament()
+            b := tournament()
+            child := make([]int, len(opt.Variables))
+            
+            for i, variable := range opt.Variables {
+                if opt.Rand.Intn(2) == 0 {
+                    child[i] = a.Values[i]
+                } else {
+                    child[i] = b.Values[i]
+                }
+                
+                if opt.Rand.Float64() < mutationRate {
+                    child[i] = variable.GetValue(opt.Rand.Intn(variable.GetNumValues()))
+                }
+            }
+            
+            candidate := opt.Evaluate(child)
+            if candidate.Feasible {
+                next = append(next, candidate)
+            }
+        }
+        
+        if len(next) > 0 {
+            population = next
+        }
+    }
+}
+
+// GetBest returns the n best feasible candidates evaluated, best first.
+func (opt *Optimizer) GetBest(n int) []*Candidate {
+    candidates := make([]*Candidate, 0, len(opt.Candidates))
+    for _, candidate := range opt.Candidates {
+        if candidate.Feasible {
+            candidates = append(candidates, candidate)
+        }
+    }
+    
+    slices.SortFunc(candidates, func (a *Candidate, b *Candidate) int {
+        if opt.IsBetter(a, b) {
+            return -1
+        }
+        if opt.IsBetter(b, a) {
+            return 1
+        }
+        return strings.Compare(a.GetKey(), b.GetKey())
+    })
+    
+    return candidates[:min(n, len(candidates))]
+}
+
+func (opt *Optimizer) PrintBest(n int) {
+    goal := "max"
+    if opt.Minimize {
+        goal = "min"
+    }
+    
+    objective := opt.Key
+    if opt.Objective != nil {
+        objective = "Objective"
+    }
+    
+    fmt.Printf("[OPTIMIZATION] %s (%s) | Evaluations: %d\n", objective, goal, opt.GetNumEvaluations())
+    
+    fmt.Printf("%6s", "Rank")
+    for _, variable := range opt.Variables {
+        fmt.Printf("%16.16s", variable.Name)
+    }
+    fmt.Printf("%14s%14s%14s%14s\n", "Mean", "Half Width", "Low", "High")
+    
+    for rank, candidate := range opt.GetBest(n) {
+        fmt.Printf("%6d", rank+1)
+        for _, value := range candidate.Values {
+            fmt.Printf("%16d", value)
+        }
+        interval := candidate.Objective
+        fmt.Printf("%14.4g%14.4g%14.4g%14.4g\n", interval.Mean, interval.HalfWidth, interval.GetLow(), interval.GetHigh())
+    }
+}
@@ -0,0 +1,152 @@
+package optimize
+
+import (
+    "testing"
+    "github.com/nidoro/sim"
+    "golang.org/x/exp/rand"
+    "github.com/nidoro/sim/scenario"
+)
+
+type Source struct {
+    sim.EntitySourceBase
+}
+
+func (source *Source) Generate() sim.Entity {
+    entity := &sim.EntityBase{}
+    source.GetEnvironment().AddEntity("Truck", entity)
+    return entity
+}
+
+// BuildPeak is a model whose result is a known function of X and Y, with
+// its maximum at (3, 5).
+func BuildPeak(env *sim.Environment, params scenario.Parameters) {
+    env.AddEntitySource(&Source{sim.EntitySourceBase{Id: "Trucks", RNG: &sim.RNGConstant{Value: sim.Hours(1)}}})
+    x := params.Get("X", 0)
+    y := params.Get("Y", 0)
+    env.Count("Score", 100 - (x-3)*(x-3) - (y-5)*(y-5))
+}
+
+func NewPeakOptimizer(method Method, start []int) *Optimizer {
+    return &Optimizer{
+        Build: BuildPeak,
+        Variables: []Variable{{Name: "X", Min: 0, Max: 10}, {Name: "Y", Min: 0, Max: 10}},
+        Constraints: []func (params scenario.Parameters) bool{
+            func (params scenario.Parameters) bool {
+                return params["X"] + params["Y"] <= 9
+            },
+        },
+        Key: sim.GetResultsKey("Counter", "Score", "Value"),
+        Replications: 2,
+        Workers: 1,
+        Seed: 1,
+        EndDate: sim.Hours(2),
+        Method: method,
+        MaxEvaluations: 40,
+        Start: start,
+    }
+}
+
+func TestOptimizer(t *testing.T) {
+    tests := []struct {
+        name    string
+        method  Method
+        start   []int
+    }{
+        {"annealing", Method_SimulatedAnnealing, nil},
+        {"annealing from a feasible start", Method_SimulatedAnnealing, []int{1, 1}},
+        {"annealing from an infeasible start", Method_SimulatedAnnealing, []int{10, 10}},
+        {"genetic", Method_Genetic, nil},
+        {"genetic from an infeasible start", Method_Genetic, []int{10, 10}},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            opt := NewPeakOptimizer(test.method, test.start)
+            best := opt.Run()
+            
+            if best == nil || !best.Feasible {
+                t.Fatalf("got %+v, want a feasible candidate", best)
+            }
+            for _, candidate := range opt.GetBest(len(opt.Candidates)) {
+                if !candidate.Feasible || candidate.Values[0] + candidate.Values[1] > 9 {
+                    t.Errorf("infeasible candidate among the best: %v", candidate.Values)
+                }
+            }
+            if best.Objective.Mean < 96 {
+                t.Errorf("best: got %v with %g, want close to [3 5] with 100", best.Values, best.Objective.Mean)
+            }
+        })
+    }
+}
+
+// With constraints that no candidate satisfies, there is nothing to
+// evaluate.
+func TestOptimizerInfeasible(t *testing.T) {
+    for _, method := range []Method{Method_SimulatedAnnealing, Method_Genetic} {
+        opt := NewPeakOptimizer(method, []int{1, 1})
+        opt.Constraints = append(opt.Constraints, func (params scenario.Parameters) bool {
+            return false
+        })
+        
+        if best := opt.Run(); best != nil {
+            t.Errorf("method %d: got %v, want no candidate", method, best.Values)
+        }
+    }
+}
+
+func TestClamp(t *testing.T) {
+    tests := []struct {
+        name        string
+        variable    Variable
+        value       int
+        clamped     int
+    }{
+        {"inside", Variable{Min: 2, Max: 10, Step: 3}, 5, 5},
+        {"below", Variable{Min: 2, Max: 10, Step: 3}, -4, 2},
+        {"above, off the grid", Variable{Min: 2, Max: 10, Step: 3}, 11, 8},
+        {"above, on the grid", Variable{Min: 2, Max: 11, Step: 3}, 14, 11},
+        {"no step", Variable{Min: 0, Max: 10}, 12, 10},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            if clamped := test.variable.Clamp(test.value); clamped != test.clamped {
+                t.Errorf("got %d, want %d", clamped, test.clamped)
+            }
+        })
+    }
+}
+
+// Neighbors stay on the grid of values of every variable.
+func TestNeighborOnGrid(t *testing.T) {
+    opt := NewPeakOptimizer(Method_SimulatedAnnealing, nil)
+    opt.Variables = []Variable{{Name: "X", Min: 0, Max: 10, Step: 3}, {Name: "Y", Min: 1, Max: 10, Step: 4}}
+    opt.Rand = rand.New(rand.NewSource(1))
+    
+    values := []int{9, 9}
+    for i := 0; i < 1000; i++ {
+        values = opt.GetNeighbor(values)
+        for v, variable := range opt.Variables {
+            if (values[v] - variable.Min) % variable.Step != 0 || values[v] < variable.Min || values[v] > variable.Max {
+                t.Fatalf("%s: got %d, off the grid", variable.Name, values[v])
+            }
+        }
+    }
+}
+
+// The score is counted when the model is built, so it is cleared by a
+// warm-up.
+func TestOptimizerWarmUp(t *testing.T) {
+    opt := NewPeakOptimizer(Method_SimulatedAnnealing, nil)
+    opt.Candidates = make(map[string]*Candidate)
+    
+    if candidate := opt.Evaluate([]int{3, 5}); candidate.Objective.Mean != 100 {
+        t.Errorf("without warm-up: got %g, want 100", candidate.Objective.Mean)
+    }
+    
+    opt.WarmUp = sim.Hours(1)
+    opt.Candidates = make(map[string]*Candidate)
+    if candidate := opt.Evaluate([]int{3, 5}); candidate.Objective.Mean != 0 {
+        t.Errorf("with warm-up: got %g, want 0", candidate.Objective.Mean)
+    }
+}
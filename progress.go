@@ -0,0 +1,203 @@
+package sim
+
+import (
+    "fmt"
+    "io"
+    "math"
+    "os"
+    "strings"
+    "sync"
+    "time"
+)
+
+const ProgressBarMaxSize = 40
+
+// Progress is the state of a run, or of all the replications of a runner.
+// Events counts entities created, processes ended and events fired.
+type Progress struct {
+    Date                float64 // seconds of simulated time
+    EndDate             float64
+    Percent             float64
+    WallTime            time.Duration
+    Events              int
+    EventsPerSecond     float64
+    ETA                 time.Duration
+    Replications        int // finished
+    TotalReplications   int
+    Done                bool
+}
+
+// ProgressReporter is notified of the progress of a run every
+// env.ProgressInterval of wall time, and once more when it ends.
+type ProgressReporter interface {
+    Report(progress Progress)
+}
+
+// ProgressFunc reports progress by calling a function.
+type ProgressFunc func (progress Progress)
+
+func (f ProgressFunc) Report(progress Progress) {
+    f(progress)
+}
+
+// SilentProgress reports nothing.
+type SilentProgress struct {}
+
+func (silent SilentProgress) Report(progress Progress) {}
+
+// TerminalProgress draws a progress bar on a terminal, redrawing it in
+// place with carriage returns.
+type TerminalProgress struct {
+    Writer      io.Writer
+    BarSize     int
+    Percent     int
+    Drawn       bool
+}
+
+func NewTerminalProgress(w io.Writer) *TerminalProgress {
+    if w == nil {
+        w = os.Stdout
+    }
+    return &TerminalProgress{Writer: w}
+}
+
+func GetProgressBarSize(progress float64) int {
+    return int(math.Ceil(progress * float64(ProgressBarMaxSize)))
+}
+
+func (terminal *TerminalProgress) Report(progress Progress) {
+    barSize := GetProgressBarSize(progress.Percent / 100)
+    percent := int(math.Ceil(progress.Percent))
+    
+    if terminal.Drawn && !progress.Done && barSize == terminal.BarSize && percent == terminal.Percent {
+        return
+    }
+    terminal.BarSize = barSize
+    terminal.Percent = percent
+    terminal.Drawn = true
+    
+    line := fmt.Sprintf("\r[%s%s] %3.0f%%", strings.Repeat("■", barSize), strings.Repeat(" ", ProgressBarMaxSize - barSize), progress.Percent)
+    if progress.TotalReplications > 1 {
+        line += fmt.Sprintf(" | %d/%d replications", progress.Replications, progress.TotalReplications)
+    }
+    line += fmt.Sprintf(" | %.0f events/s", progress.EventsPerSecond)
+    if !progress.Done {
+        line += fmt.Sprintf(" | ETA %s   ", progress.ETA.Round(time.Second))
+    } else {
+        line += fmt.Sprintf(" | %s        \n", progress.WallTime.Round(time.Millisecond))
+    }
+    
+    fmt.Fprint(terminal.Writer, line)
+}
+
+// GetProgress returns the progress of the current run.
+func (env *Environment) GetProgress() Progress {
+    progress := Progress{
+        Date: env.Now,
+        EndDate: env.EndDate,
+        WallTime: time.Since(env.RunStart),
+        Events: env.EventCount,
+        TotalReplications: 1,
+        Done: env.Now >= env.EndDate,
+    }
+    
+    fraction := 1.0
+    if env.EndDate > 0 {
+        fraction = min(env.Now / env.EndDate, 1)
+    }
+    progress.Percent = fraction * 100
+    progress.SetRates(fraction)
+    
+    if progress.Done {
+        progress.Replications = 1
+    }
+    return progress
+}
+
+// SetRates sets the events per second and the ETA from the wall time and
+// the fraction of the work done.
+func (progress *Progress) SetRates(fraction float64) {
+    seconds := progress.WallTime.Seconds()
+    if seconds > 0 {
+        progress.EventsPerSecond = float64(progress.Events) / seconds
+    }
+    
+    if fraction > 0 && fraction < 1 {
+        progress.ETA = time.Duration(float64(progress.WallTime) * (1 - fraction) / fraction)
+    }
+}
+
+// ReportProgress reports progress to env.Progress if ProgressInterval has
+// passed since the last report, or if the run ended.
+func (env *Environment) ReportProgress() {
+    if env.Progress == nil {
+        return
+    }
+    
+    if env.Now < env.EndDate && time.Since(env.LastProgress) < env.ProgressInterval {
+        return
+    }
+    
+    env.LastProgress = time.Now()
+    env.Progress.Report(env.GetProgress())
+}
+
+// RunnerProgress adds up the progress of the replications of a runner,
+// which may be running in parallel.
+type RunnerProgress struct {
+    Reporter        ProgressReporter
+    Interval        time.Duration
+    Start           time.Time
+    LastReport      time.Time
+    Replications    []Progress
+    Mutex           sync.Mutex
+}
+
+func NewRunnerProgress(reporter ProgressReporter, replications int, interval time.Duration) *RunnerProgress {
+    return &RunnerProgress{
+        Reporter: reporter,
+        Interval: interval,
+        Start: time.Now(),
+        Replications: make([]Progress, replications),
+    }
+}
+
+// Update records the progress of a replication and reports the progress
+// of all of them.
+func (runnerProgress *RunnerProgress) Update(replication int, progress Progress) {
+    runnerProgress.Mutex.Lock()
+    defer runnerProgress.Mutex.Unlock()
+    
+    runnerProgress.Replications[replication] = progress
+    
+    total := runnerProgress.GetProgress()
+    if !total.Done && time.Since(runnerProgress.LastReport) < runnerProgress.Interval {
+        return
+    }
+    
+    runnerProgress.LastReport = time.Now()
+    runnerProgress.Reporter.Report(total)
+}
+
+func (runnerProgress *RunnerProgress) GetProgress() Progress {
+    total := Progress{
+        WallTime: time.Since(runnerProgress.Start),
+        TotalReplications: len(runnerProgress.Replications),
+    }
+    
+    fraction := 0.0
+    for _, progress := range runnerProgress.Replications {
+        total.Date += progress.Date
+        total.EndDate += progress.EndDate
+        total.Events += progress.Events
+        fraction += progress.Percent / 100 / float64(total.TotalReplications)
+        if progress.Done {
+            total.Replications++
+        }
+    }
+    
+    total.Done = total.Replications == total.TotalReplications
+    total.Percent = fraction * 100
+    total.SetRates(fraction)
+    return total
+}
@@ -0,0 +1,127 @@
+package render
+
+import (
+    "bufio"
+    "fmt"
+    "image"
+    "image/color"
+    "image/color/palette"
+    "image/draw"
+    "image/gif"
+    "image/png"
+    "io"
+    "os"
+    "path/filepath"
+)
+
+// RenderFrames renders the environment every step seconds from from to to,
+// calling frame with each image. The image is reused between frames.
+func (renderer *Renderer) RenderFrames(from float64, to float64, step float64, frame func (n int, date float64, img *image.RGBA) error) error {
+    if step <= 0 {
+        return fmt.Errorf("invalid frame step: %g", step)
+    }
+    
+    img := renderer.NewImage()
+    for n := 0; ; n++ {
+        date := from + float64(n) * step
+        if date > to {
+            break
+        }
+        
+        renderer.RenderAt(date, img)
+        if err := frame(n, date, img); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// WritePNGs renders frames (see RenderFrames) to dir as frame-00000.png,
+// frame-00001.png and so on, which tools like ffmpeg can turn into video.
+func (renderer *Renderer) WritePNGs(dir string, from float64, to float64, step float64) error {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return err
+    }
+    
+    return renderer.RenderFrames(from, to, step, func (n int, date float64, img *image.RGBA) error {
+        return WritePNG(filepath.Join(dir, fmt.Sprintf("frame-%05d.png", n)), img)
+    })
+}
+
+func WritePNG(path string, img image.Image) error {
+    file, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    
+    writer := bufio.NewWriter(file)
+    if err := png.Encode(writer, img); err != nil {
+        file.Close()
+        return err
+    }
+    
+    if err := writer.Flush(); err != nil {
+        file.Close()
+        return err
+    }
+    return file.Close()
+}
+
+// GetPalette returns the colors of the style followed by the web-safe
+// palette, for GIFs.
+func (style *Style) GetPalette() color.Palette {
+    colors := color.Palette{
+        style.Background, style.Node, style.Border, style.HoldBorder, style.Text,
+        style.Busy, style.Idle, style.VehicleEmpty, style.VehicleLoaded,
+    }
+    for _, c := range style.EntityColors {
+        colors = append(colors, c)
+    }
+    
+    for _, c := range palette.WebSafe {
+        if len(colors) == 256 {
+            break
+        }
+        colors = append(colors, c)
+    }
+    return colors
+}
+
+// WriteGIF renders frames (see RenderFrames) as an animated GIF, showing
+// each frame for delay hundredths of a second.
+func (renderer *Renderer) WriteGIF(w io.Writer, from float64, to float64, step float64, delay int) error {
+    animation := &gif.GIF{}
+    colors := renderer.Style.GetPalette()
+    
+    err := renderer.RenderFrames(from, to, step, func (n int, date float64, img *image.RGBA) error {
+        paletted := image.NewPaletted(img.Bounds(), colors)
+        draw.Draw(paletted, img.Bounds(), img, image.Point{}, draw.Src)
+        animation.Image = append(animation.Image, paletted)
+        animation.Delay = append(animation.Delay, delay)
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+    
+    return gif.EncodeAll(w, animation)
+}
+
+func (renderer *Renderer) WriteGIFFile(path string, from float64, to float64, step float64, delay int) error {
+    file, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    
+    writer := bufio.NewWriter(file)
+    if err := renderer.WriteGIF(writer, from, to, step, delay); err != nil {
+        file.Close()
+        return err
+    }
+    
+    if err := writer.Flush(); err != nil {
+        file.Close()
+        return err
+    }
+    return file.Close()
+}
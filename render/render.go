@@ -0,0 +1,284 @@
+// Package render draws the state of a simulation on images, without a
+// window or GPU, and exports animations as PNG sequences or GIFs.
+package render
+
+import (
+    "fmt"
+    "hash/fnv"
+    "image"
+    "image/color"
+    "image/draw"
+    "math"
+    
+    "github.com/nidoro/sim"
+    "golang.org/x/image/font"
+    "golang.org/x/image/font/basicfont"
+    "golang.org/x/image/math/fixed"
+)
+
+// Style sets the colors and sizes used to draw a layout. Entities are
+// colored by type, from EntityColors.
+type Style struct {
+    Background      color.RGBA
+    Node            color.RGBA
+    Border          color.RGBA
+    HoldBorder      color.RGBA
+    Text            color.RGBA
+    Busy            color.RGBA
+    Idle            color.RGBA
+    VehicleEmpty    color.RGBA
+    VehicleLoaded   color.RGBA
+    EntityColors    []color.RGBA
+    EntitySize      int
+}
+
+var DefaultStyle = Style{
+    Background: color.RGBA{0x20, 0x22, 0x28, 0xff},
+    Node: color.RGBA{0x30, 0x34, 0x3c, 0xff},
+    Border: color.RGBA{0x80, 0x88, 0x98, 0xff},
+    HoldBorder: color.RGBA{0xd0, 0xa0, 0x40, 0xff},
+    Text: color.RGBA{0xe8, 0xe8, 0xe8, 0xff},
+    Busy: color.RGBA{0xd0, 0x50, 0x50, 0xff},
+    Idle: color.RGBA{0x50, 0xb0, 0x60, 0xff},
+    VehicleEmpty: color.RGBA{0xa0, 0xa0, 0xa0, 0xff},
+    VehicleLoaded: color.RGBA{0x40, 0x90, 0xe0, 0xff},
+    EntityColors: []color.RGBA{
+        {0x40, 0x90, 0xe0, 0xff},
+        {0xe0, 0x90, 0x40, 0xff},
+        {0xa0, 0x60, 0xd0, 0xff},
+        {0x40, 0xc0, 0xc0, 0xff},
+        {0xe0, 0xd0, 0x40, 0xff},
+        {0xe0, 0x60, 0xa0, 0xff},
+    },
+    EntitySize: 6,
+}
+
+// Renderer draws an environment on a layout. Date is the time drawn, which
+// is used to place moving vehicles; it is set by the frame functions.
+type Renderer struct {
+    Env         *sim.Environment
+    Layout      *sim.Layout
+    Style       Style
+    Face        font.Face
+    Date        float64
+    Started     bool // env.Begin was called
+}
+
+func NewRenderer(env *sim.Environment, layout *sim.Layout) *Renderer {
+    return &Renderer{Env: env, Layout: layout, Style: DefaultStyle, Face: basicfont.Face7x13}
+}
+
+func (renderer *Renderer) GetEntityColor(entity sim.Entity) color.RGBA {
+    hash := fnv.New32a()
+    hash.Write([]byte(entity.GetType()))
+    colors := renderer.Style.EntityColors
+    return colors[int(hash.Sum32() % uint32(len(colors)))]
+}
+
+func FillRect(img *image.RGBA, x0 int, y0 int, x1 int, y1 int, c color.RGBA) {
+    draw.Draw(img, image.Rect(x0, y0, x1, y1), &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+func StrokeRect(img *image.RGBA, x0 int, y0 int, x1 int, y1 int, c color.RGBA) {
+    FillRect(img, x0, y0, x1, y0+1, c)
+    FillRect(img, x0, y1-1, x1, y1, c)
+    FillRect(img, x0, y0, x0+1, y1, c)
+    FillRect(img, x1-1, y0, x1, y1, c)
+}
+
+// DrawText draws text with its top-left corner at x, y.
+func (renderer *Renderer) DrawText(img *image.RGBA, x int, y int, text string) {
+    drawer := font.Drawer{
+        Dst: img,
+        Src: &image.Uniform{renderer.Style.Text},
+        Face: renderer.Face,
+        Dot: fixed.P(x, y + renderer.Face.Metrics().Ascent.Ceil()),
+    }
+    drawer.DrawString(text)
+}
+
+func (renderer *Renderer) GetLineHeight() int {
+    return renderer.Face.Metrics().Height.Ceil()
+}
+
+// DrawEntities draws entities as icons in rows inside a box, with the
+// number of entities that didn't fit at the end.
+func (renderer *Renderer) DrawEntities(img *image.RGBA, entities []sim.Entity, x0 int, y0 int, x1 int, y1 int) {
+    size := renderer.Style.EntitySize
+    step := size + 2
+    perRow := max(1, (x1 - x0) / step)
+    rows := max(1, (y1 - y0) / step)
+    fit := perRow * rows
+    if len(entities) > fit {
+        fit = max(0, fit - 3)
+    }
+    
+    for i, entity := range entities {
+        if i >= fit {
+            renderer.DrawText(img, x0 + (i % perRow) * step, y0 + (i / perRow) * step - 4, fmt.Sprintf("+%d", len(entities) - fit))
+            break
+        }
+        x := x0 + (i % perRow) * step
+        y := y0 + (i / perRow) * step
+        FillRect(img, x, y, x + size, y + size, renderer.GetEntityColor(entity))
+    }
+}
+
+// DrawStation draws a process or hold: its label, the entities in process
+// on the first line and its queue below.
+func (renderer *Renderer) DrawStation(img *image.RGBA, node *sim.LayoutNode, active []sim.Entity, queue []sim.Entity, border color.RGBA) {
+    x0, y0 := int(node.X), int(node.Y)
+    x1, y1 := int(node.X + node.Width), int(node.Y + node.Height)
+    FillRect(img, x0, y0, x1, y1, renderer.Style.Node)
+    StrokeRect(img, x0, y0, x1, y1, border)
+    
+    line := renderer.GetLineHeight()
+    renderer.DrawText(img, x0 + 4, y0 + 2, node.GetLabel())
+    renderer.DrawText(img, x0 + 4, y0 + 2 + line, fmt.Sprintf("active %d  queue %d", len(active), len(queue)))
+    
+    top := y0 + 4 + 2*line
+    step := renderer.Style.EntitySize + 2
+    renderer.DrawEntities(img, active, x0 + 4, top, x1 - 4, top + step)
+    renderer.DrawEntities(img, queue, x0 + 4, top + step + 4, x1 - 4, y1 - 4)
+}
+
+// DrawResource draws a resource as a bar with a cell per unit of capacity,
+// busy units first.
+func (renderer *Renderer) DrawResource(img *image.RGBA, node *sim.LayoutNode, resource *sim.ResourceBase) {
+    x0, y0 := int(node.X), int(node.Y)
+    x1, y1 := int(node.X + node.Width), int(node.Y + node.Height)
+    FillRect(img, x0, y0, x1, y1, renderer.Style.Node)
+    StrokeRect(img, x0, y0, x1, y1, renderer.Style.Border)
+    
+    line := renderer.GetLineHeight()
+    renderer.DrawText(img, x0 + 4, y0 + 2, fmt.Sprintf("%s  %g/%g", node.GetLabel(), resource.Amount, resource.Capacity))
+    
+    capacity := int(math.Ceil(resource.Capacity))
+    if capacity <= 0 {
+        return
+    }
+    
+    busy := int(math.Ceil(resource.Capacity - resource.Amount))
+    top, bottom := y0 + line + 4, y1 - 4
+    if bottom <= top {
+        return
+    }
+    
+    width := float64(x1 - x0 - 8) / float64(capacity)
+    for u := 0; u < capacity; u++ {
+        c := renderer.Style.Idle
+        if u < busy {
+            c = renderer.Style.Busy
+        }
+        cx0 := x0 + 4 + int(float64(u) * width)
+        cx1 := x0 + 4 + int(float64(u+1) * width) - 1
+        FillRect(img, cx0, top, max(cx0+1, cx1), bottom, c)
+    }
+}
+
+// DrawConveyor draws the items of a conveyor along its box, from the
+// entrance on the left to the exit on the right, and its queue below the
+// label.
+func (renderer *Renderer) DrawConveyor(img *image.RGBA, node *sim.LayoutNode, conveyor *sim.ConveyorBase) {
+    x0, y0 := int(node.X), int(node.Y)
+    x1, y1 := int(node.X + node.Width), int(node.Y + node.Height)
+    FillRect(img, x0, y0, x1, y1, renderer.Style.Node)
+    StrokeRect(img, x0, y0, x1, y1, renderer.Style.Border)
+    
+    line := renderer.GetLineHeight()
+    label := fmt.Sprintf("%s  queue %d", node.GetLabel(), len(conveyor.Queue))
+    if conveyor.Blocked {
+        label += "  blocked"
+    }
+    renderer.DrawText(img, x0 + 4, y0 + 2, label)
+    
+    top := y0 + line + 6
+    bottom := min(y1 - 4, top + renderer.Style.EntitySize + 4)
+    beltWidth := float64(x1 - x0 - 8)
+    FillRect(img, x0 + 4, top, x1 - 4, bottom, renderer.Style.Background)
+    
+    for _, item := range conveyor.Items {
+        front := x0 + 4 + int(item.Position / conveyor.Length * beltWidth)
+        back := x0 + 4 + int((item.Position - item.Size) / conveyor.Length * beltWidth)
+        FillRect(img, max(x0 + 4, back + 1), top + 2, max(back + 2, front), bottom - 2, renderer.GetEntityColor(item.Entity))
+    }
+    
+    renderer.DrawEntities(img, conveyor.Queue, x0 + 4, bottom + 4, x1 - 4, y1 - 4)
+}
+
+func (renderer *Renderer) DrawTransporters(img *image.RGBA) {
+    size := renderer.Style.EntitySize + 4
+    for _, transporter := range renderer.Env.Transporters {
+        for _, vehicle := range transporter.Vehicles {
+            point, ok := renderer.Layout.GetVehiclePosition(vehicle, renderer.Date)
+            if !ok {
+                continue
+            }
+            
+            c := renderer.Style.VehicleEmpty
+            if vehicle.Status == sim.VehicleStatus_MovingLoaded {
+                c = renderer.Style.VehicleLoaded
+            }
+            
+            // vehicles at the same place are spread by index
+            x := int(point.X) - size/2 + (vehicle.Index % 4) * 2
+            y := int(point.Y) - size/2 + (vehicle.Index % 4) * 2
+            FillRect(img, x, y, x + size, y + size, c)
+            StrokeRect(img, x, y, x + size, y + size, renderer.Style.Background)
+        }
+    }
+}
+
+// Draw draws the current state of the environment, as of renderer.Date.
+func (renderer *Renderer) Draw(img *image.RGBA) {
+    env := renderer.Env
+    FillRect(img, 0, 0, img.Bounds().Dx(), img.Bounds().Dy(), renderer.Style.Background)
+    
+    active := make(map[string][]sim.Entity)
+    for _, ongoing := range env.OngoingProcesses {
+        active[ongoing.Process.GetId()] = append(active[ongoing.Process.GetId()], ongoing.Entity)
+    }
+    
+    for _, node := range renderer.Layout.Nodes {
+        if node.Kind == sim.LayoutKind_Process {
+            if process := env.GetProcess(node.Id); process != nil {
+                renderer.DrawStation(img, node, active[node.Id], process.GetProcessBase().Queue, renderer.Style.Border)
+            }
+        } else if node.Kind == sim.LayoutKind_Hold {
+            if hold := env.GetHold(node.Id); hold != nil {
+                renderer.DrawStation(img, node, nil, hold.Queue, renderer.Style.HoldBorder)
+            }
+        } else if node.Kind == sim.LayoutKind_Resource {
+            if resource, ok := env.Resources[node.Id]; ok {
+                renderer.DrawResource(img, node, resource.GetResourceBase())
+            }
+        } else if node.Kind == sim.LayoutKind_Conveyor {
+            if conveyor := env.GetConveyor(node.Id); conveyor != nil {
+                renderer.DrawConveyor(img, node, conveyor)
+            }
+        }
+    }
+    
+    renderer.DrawTransporters(img)
+    renderer.DrawText(img, 4, 2, env.GetHumanTime(renderer.Date))
+}
+
+func (renderer *Renderer) NewImage() *image.RGBA {
+    return image.NewRGBA(image.Rect(0, 0, renderer.Layout.Width, renderer.Layout.Height))
+}
+
+// RenderAt runs the environment up to date, which must not be before the
+// last date rendered, and draws it.
+func (renderer *Renderer) RenderAt(date float64, img *image.RGBA) {
+    env := renderer.Env
+    if !renderer.Started {
+        env.Begin()
+        renderer.Started = true
+    }
+    
+    // state changes at env.Now are only applied by the next step
+    for env.Now <= date && env.Advance() {}
+    
+    renderer.Date = date
+    renderer.Draw(img)
+}
@@ -0,0 +1,316 @@
+package sim
+
+import (
+    "fmt"
+    "io"
+    "math"
+    "runtime"
+    "slices"
+    "sync"
+    "time"
+)
+
+// Results holds the statistics of a replication, keyed by
+// "<Kind>/<Id>/<Statistic>", like "Process/ARRI Londrina/AvgTimeInQueue".
+type Results struct {
+    Replication int
+    Seed        uint64
+    EndDate     float64
+    Values      map[string]float64
+}
+
+func GetResultsKey(kind string, id string, statistic string) string {
+    return fmt.Sprintf("%s/%s/%s", kind, id, statistic)
+}
+
+func (results *Results) Set(kind string, id string, statistic string, value float64) {
+    results.Values[GetResultsKey(kind, id, statistic)] = value
+}
+
+func (results *Results) Get(kind string, id string, statistic string) float64 {
+    return results.Values[GetResultsKey(kind, id, statistic)]
+}
+
+// SetTally sets the mean, standard deviation, minimum, maximum and number of
+// observations of a tally.
+func (results *Results) SetTally(kind string, id string, statistic string, tally *Tally) {
+    results.Set(kind, id, statistic + ".Mean", tally.GetMean())
+    results.Set(kind, id, statistic + ".StdDev", tally.GetStdDev())
+    results.Set(kind, id, statistic + ".Min", tally.Min)
+    results.Set(kind, id, statistic + ".Max", tally.Max)
+    results.Set(kind, id, statistic + ".Count", float64(tally.Count))
+}
+
+// SetTimePersistent sets the time-weighted mean and standard deviation,
+// minimum and maximum of a time-persistent statistic.
+func (results *Results) SetTimePersistent(kind string, id string, statistic string, st *TimePersistent, now float64) {
+    results.Set(kind, id, statistic + ".Mean", st.GetMean(now))
+    results.Set(kind, id, statistic + ".StdDev", st.GetStdDev(now))
+    results.Set(kind, id, statistic + ".Min", st.Min)
+    results.Set(kind, id, statistic + ".Max", st.Max)
+}
+
+func (results *Results) SetQueueStatistics(kind string, id string, st *QueueStatistics, now float64) {
+    results.SetTally(kind, id, "TimeInQueue", &st.TimeInQueue)
+    results.SetTimePersistent(kind, id, "QueueLength", &st.QueueLength, now)
+}
+
+func (results *Results) GetKeys() []string {
+    keys := make([]string, 0, len(results.Values))
+    for key, _ := range results.Values {
+        keys = append(keys, key)
+    }
+    slices.Sort(keys)
+    return keys
+}
+
+// GetResults collects the statistics of the environment at the current time.
+func (env *Environment) GetResults() *Results {
+    results := &Results{
+        Replication: env.Replication,
+        Seed: env.Seed,
+        EndDate: env.Now,
+        Values: make(map[string]float64),
+    }
+    
+    for _, process := range env.Processes {
+        base := process.GetProcessBase()
+        st := process.GetStatistics()
+        results.Set("Process", base.Id, "EntitiesIn", float64(st.TotalEntitiesIn))
+        results.Set("Process", base.Id, "EntitiesOut", float64(base.TotalEntitiesOut))
+        results.Set("Process", base.Id, "AvgTimeInQueue", st.AvgTimeInQueue)
+        results.Set("Process", base.Id, "AvgDuration", base.AvgDuration)
+        results.Set("Process", base.Id, "QueueSize", float64(process.GetQueueSize()))
+        results.SetQueueStatistics("Process", base.Id, &base.QueueStats, env.Now)
+        results.SetTally("Process", base.Id, "Duration", &base.Durations)
+    }
+    
+    for rid, resource := range env.Resources {
+        base := resource.GetResourceBase()
+        results.Set("Resource", rid, "Utilization", base.GetUtilization(env.Now))
+        results.SetTimePersistent("Resource", rid, "Busy", &base.Busy, env.Now)
+    }
+    
+    for _, hold := range env.Holds {
+        st := hold.GetStatistics()
+        results.Set("Hold", hold.Id, "EntitiesIn", float64(st.TotalEntitiesIn))
+        results.Set("Hold", hold.Id, "EntitiesOut", float64(st.TotalEntitiesOut))
+        results.Set("Hold", hold.Id, "AvgTimeInQueue", st.AvgTimeInQueue)
+        results.Set("Hold", hold.Id, "QueueSize", float64(hold.GetQueueSize()))
+        results.SetQueueStatistics("Hold", hold.Id, &hold.QueueStats, env.Now)
+    }
+    
+    for _, transporter := range env.Transporters {
+        utilization := 0.0
+        emptyDistance := 0.0
+        loadedDistance := 0.0
+        trips := 0
+        
+        for _, vehicle := range transporter.Vehicles {
+            utilization += vehicle.GetUtilization(env.Now)
+            emptyDistance += vehicle.EmptyDistance
+            loadedDistance += vehicle.LoadedDistance
+            trips += vehicle.Trips
+        }
+        
+        results.Set("Transporter", transporter.Id, "Utilization", utilization / float64(len(transporter.Vehicles)))
+        results.Set("Transporter", transporter.Id, "EmptyDistance", emptyDistance)
+        results.Set("Transporter", transporter.Id, "LoadedDistance", loadedDistance)
+        results.Set("Transporter", transporter.Id, "Trips", float64(trips))
+        results.Set("Transporter", transporter.Id, "AvgTimeInQueue", transporter.QueueStats.AvgTimeInQueue)
+        results.SetQueueStatistics("Transporter", transporter.Id, &transporter.QueueStats, env.Now)
+    }
+    
+    for _, conveyor := range env.Conveyors {
+        results.Set("Conveyor", conveyor.Id, "EntitiesOut", float64(conveyor.TotalEntitiesOut))
+        results.Set("Conveyor", conveyor.Id, "LoadOut", conveyor.TotalLoadOut)
+        results.Set("Conveyor", conveyor.Id, "AvgTimeInQueue", conveyor.QueueStats.AvgTimeInQueue)
+        results.Set("Conveyor", conveyor.Id, "AvgTransitTime", conveyor.AvgTransitTime)
+        results.Set("Conveyor", conveyor.Id, "Utilization", conveyor.GetUtilization())
+        results.Set("Conveyor", conveyor.Id, "BlockedTime", conveyor.GetBlockedTime())
+        results.SetQueueStatistics("Conveyor", conveyor.Id, &conveyor.QueueStats, env.Now)
+    }
+    
+    for name, value := range env.Variables {
+        results.Set("Variable", name, "Value", value)
+    }
+    
+    for id, counter := range env.Counters {
+        results.Set("Counter", id, "Value", counter.Value)
+        results.Set("Counter", id, "Count", float64(counter.Count))
+    }
+    
+    for id, tally := range env.Tallies {
+        results.SetTally("Tally", id, "Value", tally)
+    }
+    
+    results.SetCategories(env)
+    results.SetCosts(env)
+    
+    return results
+}
+
+// GetBatchedStatistics returns the tallies and time-persistent statistics
+// of the environment, keyed like results, with time-persistent statistics
+// integrated up to the current time.
+func (env *Environment) GetBatchedStatistics() map[string]Batched {
+    statistics := make(map[string]Batched)
+    
+    addQueue := func (kind string, id string, st *QueueStatistics) {
+        st.QueueLength.Integrate(env.Now)
+        statistics[GetResultsKey(kind, id, "TimeInQueue")] = &st.TimeInQueue
+        statistics[GetResultsKey(kind, id, "QueueLength")] = &st.QueueLength
+    }
+    
+    for _, process := range env.Processes {
+        base := process.GetProcessBase()
+        addQueue("Process", base.Id, &base.QueueStats)
+        statistics[GetResultsKey("Process", base.Id, "Duration")] = &base.Durations
+    }
+    
+    for rid, resource := range env.Resources {
+        base := resource.GetResourceBase()
+        base.Busy.Integrate(env.Now)
+        statistics[GetResultsKey("Resource", rid, "Busy")] = &base.Busy
+    }
+    
+    for _, hold := range env.Holds {
+        addQueue("Hold", hold.Id, &hold.QueueStats)
+    }
+    
+    for _, transporter := range env.Transporters {
+        addQueue("Transporter", transporter.Id, &transporter.QueueStats)
+    }
+    
+    for _, conveyor := range env.Conveyors {
+        addQueue("Conveyor", conveyor.Id, &conveyor.QueueStats)
+    }
+    
+    for id, tally := range env.Tallies {
+        statistics[GetResultsKey("Tally", id, "Value")] = tally
+    }
+    
+    return statistics
+}
+
+// MergeResults averages the statistics of several replications. Statistics
+// missing from a replication are averaged over the ones that have them.
+func MergeResults(all []*Results) *Results {
+    merged := &Results{Replication: -1, Values: make(map[string]float64)}
+    counts := make(map[string]int)
+    
+    for _, results := range all {
+        merged.EndDate += results.EndDate / float64(len(all))
+        for key, value := range results.Values {
+            merged.Values[key] += value
+            counts[key]++
+        }
+    }
+    
+    for key, count := range counts {
+        merged.Values[key] /= float64(count)
+    }
+    
+    return merged
+}
+
+func (results *Results) Print() {
+    fmt.Printf("[RESULTS] Replication: %d\n", results.Replication)
+    fmt.Printf("%64s%16s\n", "Statistic", "Value")
+    
+    for _, key := range results.GetKeys() {
+        value := results.Values[key]
+        if math.Abs(value) >= 1e6 {
+            fmt.Printf("%64.64s%16.4g\n", key, value)
+        } else {
+            fmt.Printf("%64.64s%16.2f\n", key, value)
+        }
+    }
+}
+
+// WriteTSV writes the results as a table with one statistic per row.
+func (results *Results) WriteTSV(w io.Writer) error {
+    if _, err := fmt.Fprintf(w, "Statistic\tValue\n"); err != nil {
+        return err
+    }
+    
+    for _, key := range results.GetKeys() {
+        if _, err := fmt.Fprintf(w, "%s\t%g\n", key, results.Values[key]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Runner runs independent replications of a model in parallel. Build is
+// called with a fresh, seeded environment for each replication and must
+// add everything the model needs to it; it must not share mutable state
+// between calls. Replication r is seeded from GetStreamSeed(Seed, r), so
+// results do not depend on the number of workers.
+type Runner struct {
+    Build           func (env *Environment)
+    Replications    int
+    Workers         int
+    Seed            uint64
+    EndDate         float64
+    WarmUp          float64
+    Progress        ProgressReporter // progress of all replications, if set
+    
+    Results         []*Results
+    RunnerProgress  *RunnerProgress
+}
+
+func (runner *Runner) RunReplication(replication int) *Results {
+    env := NewEnvironment()
+    env.Replication = replication
+    env.SetSeed(GetStreamSeed(runner.Seed, replication))
+    env.EndDate = runner.EndDate
+    env.WarmUp = runner.WarmUp
+    runner.Build(env)
+    env.LogLevel = 0
+    env.StepThrough = false
+    env.Progress = nil
+    
+    if runner.RunnerProgress != nil {
+        env.Progress = ProgressFunc(func (progress Progress) {
+            runner.RunnerProgress.Update(replication, progress)
+        })
+    }
+    env.Run()
+    return env.GetResults()
+}
+
+// Run runs all replications and returns their merged results.
+func (runner *Runner) Run() *Results {
+    workers := runner.Workers
+    if workers <= 0 {
+        workers = runtime.NumCPU()
+    }
+    
+    runner.Results = make([]*Results, runner.Replications)
+    runner.RunnerProgress = nil
+    if runner.Progress != nil {
+        runner.RunnerProgress = NewRunnerProgress(runner.Progress, runner.Replications, time.Second / 15)
+    }
+    
+    jobs := make(chan int)
+    var wg sync.WaitGroup
+    
+    for w := 0; w < min(workers, runner.Replications); w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for replication := range jobs {
+                runner.Results[replication] = runner.RunReplication(replication)
+            }
+        }()
+    }
+    
+    for replication := 0; replication < runner.Replications; replication++ {
+        jobs <- replication
+    }
+    close(jobs)
+    wg.Wait()
+    
+    return MergeResults(runner.Results)
+}
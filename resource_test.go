@@ -0,0 +1,61 @@
+package sim
+
+import (
+    "slices"
+    "testing"
+)
+
+// Three boxes are loaded and three unloaded at 0 s, by a single crane that
+// takes 10 s for each. The crane queue drains as the boxes seize it, in
+// whichever order the processes take them.
+func TestResourceQueue(t *testing.T) {
+    tests := []struct {
+        name        string
+        endDate     float64
+        seized      int
+    }{
+        {"all done", 100, 6},
+        {"midway", 25, 3},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            env := NewEnvironment()
+            env.EndDate = test.endDate
+            loads := NewTestSource("Load", 3)
+            loads.Id = "Loads"
+            unloads := NewTestSource("Unload", 3)
+            unloads.Id = "Unloads"
+            env.AddEntitySource(loads)
+            env.AddEntitySource(unloads)
+            env.AddResource(&ResourceBase{Id: "Crane", Amount: 1})
+            env.AddProcess(ProcessBase{Id: "Load", Needs: map[string]float64{"Crane": 1}, RNG: &RNGConstant{Value: 10}})
+            env.AddProcess(ProcessBase{Id: "Unload", Needs: map[string]float64{"Crane": 1}, RNG: &RNGConstant{Value: 10}})
+            env.Run()
+            
+            crane := env.Resources["Crane"].GetResourceBase()
+            if crane.TotalEntitiesIn != 6 || crane.TotalEntitiesOut != test.seized || len(crane.Queue) != 6 - test.seized {
+                t.Fatalf("got %d in, %d out and %d in queue, want 6, %d and %d", crane.TotalEntitiesIn, crane.TotalEntitiesOut, len(crane.Queue), test.seized, 6 - test.seized)
+            }
+            
+            // only boxes still waiting for the crane are in its queue
+            for _, process := range env.Processes {
+                for _, entity := range process.GetProcessBase().Queue {
+                    if !slices.Contains(crane.Queue, entity) {
+                        t.Errorf("%s is waiting, but not in the crane queue", entity.GetName())
+                    }
+                }
+            }
+            for _, ongoing := range env.OngoingProcesses {
+                if slices.Contains(crane.Queue, ongoing.Entity) {
+                    t.Errorf("%s seized the crane, but is still in its queue", ongoing.Entity.GetName())
+                }
+            }
+            
+            // the boxes waited 0, 10, 20, 30, 40 and 50 s
+            if test.seized == 6 && crane.AvgTimeInQueue != 25 {
+                t.Errorf("time in queue: got %g, want 25", crane.AvgTimeInQueue)
+            }
+        })
+    }
+}
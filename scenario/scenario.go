@@ -0,0 +1,394 @@
+// Package scenario runs a model under different sets of parameters and
+// compares the results.
+//
+// All scenarios of an experiment use the same seeds for the same
+// replication (common random numbers), so differences between them are due
+// to the parameters rather than to noise. This holds as long as the model
+// adds its RNGs in the same order in every scenario.
+package scenario
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "runtime"
+    "slices"
+    "sync"
+    "github.com/nidoro/sim"
+    "github.com/nidoro/sim/analysis"
+)
+
+type Parameters map[string]float64
+
+func (params Parameters) Get(name string, def float64) float64 {
+    if value, ok := params[name]; ok {
+        return value
+    }
+    return def
+}
+
+func (params Parameters) GetInt(name string, def int) int {
+    return int(math.Round(params.Get(name, float64(def))))
+}
+
+// Merge returns a copy of params with overrides applied.
+func (params Parameters) Merge(overrides Parameters) Parameters {
+    merged := make(Parameters, len(params) + len(overrides))
+    for name, value := range params {
+        merged[name] = value
+    }
+    for name, value := range overrides {
+        merged[name] = value
+    }
+    return merged
+}
+
+type Scenario struct {
+    Name        string
+    Overrides   Parameters
+}
+
+// Experiment builds each scenario by calling Build with the base parameters
+// merged with the scenario overrides.
+type Experiment struct {
+    Build           func (env *sim.Environment, params Parameters)
+    Base            Parameters
+    Scenarios       []Scenario
+    Replications    int
+    Workers         int
+    Seed            uint64
+    EndDate         float64
+    WarmUp          float64
+    Confidence      float64
+    
+    Results         map[string][]*sim.Results
+}
+
+func (exp *Experiment) GetScenario(name string) *Scenario {
+    for i := range exp.Scenarios {
+        if exp.Scenarios[i].Name == name {
+            return &exp.Scenarios[i]
+        }
+    }
+    return nil
+}
+
+func (exp *Experiment) GetConfidence() float64 {
+    if exp.Confidence <= 0 {
+        return analysis.DefaultConfidence
+    }
+    return exp.Confidence
+}
+
+func (exp *Experiment) GetRunner(scenario *Scenario) *sim.Runner {
+    params := exp.Base.Merge(scenario.Overrides)
+    return &sim.Runner{
+        Build: func (env *sim.Environment) {
+            exp.Build(env, params)
+        },
+        Replications: exp.Replications,
+        Workers: exp.Workers,
+        Seed: exp.Seed,
+        EndDate: exp.EndDate,
+        WarmUp: exp.WarmUp,
+    }
+}
+
+// Run runs Replications replications of every scenario.
+func (exp *Experiment) Run() {
+    exp.Results = make(map[string][]*sim.Results)
+    
+    for i := range exp.Scenarios {
+        scenario := &exp.Scenarios[i]
+        runner := exp.GetRunner(scenario)
+        runner.Run()
+        exp.Results[scenario.Name] = runner.Results
+    }
+}
+
+// GetSamples returns the value of a statistic (a results key) in each
+// replication of a scenario, or an error if a replication doesn't have it.
+func (exp *Experiment) GetSamples(name string, key string) ([]float64, error) {
+    samples := make([]float64, 0, len(exp.Results[name]))
+    for _, results := range exp.Results[name] {
+        value, err := GetResult(results, key)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", name, err)
+        }
+        samples = append(samples, value)
+    }
+    return samples, nil
+}
+
+// GetResult returns the value of a results key, or an error if it is
+// missing, as with a mistyped key.
+func GetResult(results *sim.Results, key string) (float64, error) {
+    value, ok := results.Values[key]
+    if !ok {
+        return 0, fmt.Errorf("result not found in replication %d: %s", results.Replication, key)
+    }
+    return value, nil
+}
+
+func (exp *Experiment) Summarize(name string) *analysis.Summary {
+    return analysis.Summarize(exp.Results[name], exp.GetConfidence())
+}
+
+// Comparison is a paired-t confidence interval of the difference A - B of
+// a statistic between two scenarios.
+type Comparison struct {
+    A           string
+    B           string
+    Key         string
+    Difference  analysis.Interval
+}
+
+// IsSignificant tells whether the interval of the difference excludes 0.
+func (comparison Comparison) IsSignificant() bool {
+    return !comparison.Difference.Contains(0)
+}
+
+// Compare computes the paired-t interval of the difference of a statistic
+// between two scenarios, pairing replications that share random numbers.
+func (exp *Experiment) Compare(a string, b string, key string) (Comparison, error) {
+    xa, err := exp.GetSamples(a, key)
+    if err != nil {
+        return Comparison{}, err
+    }
+    xb, err := exp.GetSamples(b, key)
+    if err != nil {
+        return Comparison{}, err
+    }
+    n := min(len(xa), len(xb))
+    diffs := make([]float64, n)
+    
+    for r := 0; r < n; r++ {
+        diffs[r] = xa[r] - xb[r]
+    }
+    
+    return Comparison{A: a, B: b, Key: key, Difference: analysis.NewInterval(diffs, exp.GetConfidence())}, nil
+}
+
+// CompareAll compares every pair of scenarios.
+func (exp *Experiment) CompareAll(key string) ([]Comparison, error) {
+    comparisons := make([]Comparison, 0)
+    for i := 0; i < len(exp.Scenarios); i++ {
+        for j := i+1; j < len(exp.Scenarios); j++ {
+            comparison, err := exp.Compare(exp.Scenarios[i].Name, exp.Scenarios[j].Name, key)
+            if err != nil {
+                return nil, err
+            }
+            comparisons = append(comparisons, comparison)
+        }
+    }
+    return comparisons, nil
+}
+
+func (exp *Experiment) PrintComparisons(key string) error {
+    comparisons, err := exp.CompareAll(key)
+    if err != nil {
+        return err
+    }
+    
+    fmt.Printf("[SCENARIO COMPARISON] %s | Confidence: %.0f%%\n", key, exp.GetConfidence()*100)
+    fmt.Printf("%24s%24s%14s%14s%14s%14s\n", "A", "B", "Mean A-B", "Half Width", "Low", "High")
+    
+    for _, c := range comparisons {
+        mark := ""
+        if c.IsSignificant() {
+            mark = " *"
+        }
+        fmt.Printf("%24.24s%24.24s%14.4g%14.4g%14.4g%14.4g%s\n", c.A, c.B, c.Difference.Mean, c.Difference.HalfWidth, c.Difference.GetLow(), c.Difference.GetHigh(), mark)
+    }
+    return nil
+}
+
+// Selection is the outcome of a ranking-and-selection procedure.
+type Selection struct {
+    Key             string
+    Minimize        bool
+    Best            string
+    Means           map[string]float64
+    Replications    map[string]int
+    Eliminated      []string
+}
+
+func (selection *Selection) Print() {
+    goal := "max"
+    if selection.Minimize {
+        goal = "min"
+    }
+    fmt.Printf("[SELECTION] %s (%s) | Best: %s\n", selection.Key, goal, selection.Best)
+    fmt.Printf("%24s%14s%14s%14s\n", "Scenario", "Mean", "Replications", "Eliminated")
+    
+    names := make([]string, 0, len(selection.Means))
+    for name, _ := range selection.Means {
+        names = append(names, name)
+    }
+    slices.Sort(names)
+    
+    for _, name := range names {
+        fmt.Printf("%24.24s%14.4g%14d%14v\n", name, selection.Means[name], selection.Replications[name], slices.Contains(selection.Eliminated, name))
+    }
+}
+
+// SelectBest picks the scenario with the best mean of a statistic using
+// the fully sequential procedure of Kim and Nelson (2001), with common
+// random numbers. With probability at least 1 - alpha, the selected
+// scenario is the best or within delta of it. Every scenario starts with
+// n0 replications (at least 2), and survivors get one more at a time, up to
+// maxReplications, after which the survivor with the best mean is chosen.
+// Replications run on up to Workers goroutines, like Run. Keys missing
+// from the results are errors.
+func (exp *Experiment) SelectBest(key string, minimize bool, alpha float64, delta float64, n0 int, maxReplications int) (*Selection, error) {
+    if len(exp.Scenarios) == 0 {
+        return nil, errors.New("no scenarios to select from")
+    }
+    if !(alpha > 0 && alpha < 1) {
+        return nil, fmt.Errorf("invalid alpha: %g", alpha)
+    }
+    if !(delta > 0) {
+        return nil, fmt.Errorf("invalid indifference zone: %g", delta)
+    }
+    if n0 < 2 {
+        return nil, fmt.Errorf("invalid initial replications: %d", n0)
+    }
+    
+    k := len(exp.Scenarios)
+    selection := &Selection{Key: key, Minimize: minimize, Means: make(map[string]float64), Replications: make(map[string]int)}
+    
+    sign := 1.0
+    if minimize {
+        sign = -1
+    }
+    
+    runners := make([]*sim.Runner, k)
+    samples := make([][]float64, k)
+    for i := range exp.Scenarios {
+        runners[i] = exp.GetRunner(&exp.Scenarios[i])
+    }
+    
+    workers := exp.Workers
+    if workers <= 0 {
+        workers = runtime.NumCPU()
+    }
+    
+    // runs replication r of the given scenarios in parallel
+    errs := make([]error, k)
+    runReplication := func (r int, scenarios []int) error {
+        jobs := make(chan int)
+        var wg sync.WaitGroup
+        
+        for w := 0; w < min(workers, len(scenarios)); w++ {
+            wg.Add(1)
+            go func() {
+                defer wg.Done()
+                for i := range jobs {
+                    value, err := GetResult(runners[i].RunReplication(r), key)
+                    if err != nil {
+                        errs[i] = fmt.Errorf("%s: %w", exp.Scenarios[i].Name, err)
+                    }
+                    samples[i] = append(samples[i], sign * value)
+                }
+            }()
+        }
+        
+        for _, i := range scenarios {
+            jobs <- i
+        }
+        close(jobs)
+        wg.Wait()
+        
+        for _, i := range scenarios {
+            if errs[i] != nil {
+                return errs[i]
+            }
+        }
+        return nil
+    }
+    
+    alive := make([]int, k)
+    for i := range alive {
+        alive[i] = i
+    }
+    
+    for r := 0; r < n0; r++ {
+        if err := runReplication(r, alive); err != nil {
+            return nil, err
+        }
+    }
+    
+    eta := 0.0
+    if k > 1 {
+        eta = 0.5 * (math.Pow(2*alpha/float64(k-1), -2/float64(n0-1)) - 1)
+    }
+    h2 := 2 * eta * float64(n0-1)
+    
+    // variances of the pairwise differences over the first n0 replications
+    s2 := make([][]float64, k)
+    for i := 0; i < k; i++ {
+        s2[i] = make([]float64, k)
+        for l := 0; l < k; l++ {
+            diffs := make([]float64, n0)
+            for r := 0; r < n0; r++ {
+                diffs[r] = samples[i][r] - samples[l][r]
+            }
+            s2[i][l] = math.Pow(analysis.NewInterval(diffs, 0.5).StdDev, 2)
+        }
+    }
+    
+    mean := func (i int) float64 {
+        sum := 0.0
+        for _, x := range samples[i] {
+            sum += x
+        }
+        return sum / float64(len(samples[i]))
+    }
+    
+    for r := n0; ; r++ {
+        survivors := make([]int, 0, len(alive))
+        for _, i := range alive {
+            eliminated := false
+            for _, l := range alive {
+                if l == i {
+                    continue
+                }
+                w := max(0, delta / (2*float64(r)) * (h2 * s2[i][l] / (delta*delta) - float64(r)))
+                if mean(i) < mean(l) - w {
+                    eliminated = true
+                    break
+                }
+            }
+            
+            if eliminated {
+                selection.Eliminated = append(selection.Eliminated, exp.Scenarios[i].Name)
+            } else {
+                survivors = append(survivors, i)
+            }
+        }
+        alive = survivors
+        
+        if len(alive) <= 1 || r >= maxReplications {
+            break
+        }
+        
+        if err := runReplication(r, alive); err != nil {
+            return nil, err
+        }
+    }
+    
+    best := alive[0]
+    for _, i := range alive {
+        if mean(i) > mean(best) {
+            best = i
+        }
+    }
+    
+    selection.Best = exp.Scenarios[best].Name
+    for i, scenario := range exp.Scenarios {
+        selection.Means[scenario.Name] = sign * mean(i)
+        selection.Replications[scenario.Name] = len(samples[i])
+    }
+    
+    return selection, nil
+}
@@ -0,0 +1,169 @@
+package scenario
+
+import (
+    "slices"
+    "testing"
+    "github.com/nidoro/sim"
+)
+
+type Source struct {
+    sim.EntitySourceBase
+}
+
+func (source *Source) Generate() sim.Entity {
+    env := source.GetEnvironment()
+    entity := &sim.EntityBase{}
+    env.AddEntity("Truck", entity)
+    env.ForwardTo(entity, "Scale")
+    return entity
+}
+
+// BuildScale is a scale that weighs trucks arriving every Interval seconds
+// on average and counts them.
+func BuildScale(env *sim.Environment, params Parameters) {
+    env.AddEntitySource(&Source{sim.EntitySourceBase{Id: "Trucks", RNG: sim.NewRNGExponential(1/params.Get("Interval", 600))}})
+    env.AddResource(&sim.ResourceBase{Id: "Scale", Amount: 1})
+    env.AddCounter("Trucks")
+    env.AddProcess(sim.ProcessBase{Id: "Scale", Needs: map[string]float64{"Scale": 1}, RNG: sim.NewRNGExponential(1/60.0),
+        Forward: func (entity sim.Entity) {
+            env.Count("Trucks", 1)
+            env.Dispose(entity)
+        },
+    })
+}
+
+func NewScaleExperiment(workers int) *Experiment {
+    return &Experiment{
+        Build: BuildScale,
+        Scenarios: []Scenario{
+            {"Slow", Parameters{"Interval": 1200}},
+            {"Fast", Parameters{"Interval": 300}},
+            {"Medium", Parameters{"Interval": 600}},
+        },
+        Workers: workers,
+        Seed: 1,
+        EndDate: sim.Days(1),
+    }
+}
+
+func TestSelectBest(t *testing.T) {
+    key := sim.GetResultsKey("Counter", "Trucks", "Value")
+    
+    tests := []struct {
+        name        string
+        minimize    bool
+        workers     int
+        best        string
+    }{
+        {"max", false, 0, "Fast"},
+        {"min", true, 0, "Slow"},
+        {"one worker", false, 1, "Fast"},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            exp := NewScaleExperiment(test.workers)
+            selection, err := exp.SelectBest(key, test.minimize, 0.05, 10, 5, 50)
+            if err != nil {
+                t.Fatal(err)
+            }
+            
+            if selection.Best != test.best {
+                t.Errorf("best: got %s, want %s", selection.Best, test.best)
+            }
+            
+            // the means are about 288, 144 and 72 trucks, far apart for an
+            // indifference zone of 10, so the others are eliminated before
+            // the maximum number of replications
+            if len(selection.Eliminated) != 2 || slices.Contains(selection.Eliminated, test.best) {
+                t.Errorf("eliminated: got %v", selection.Eliminated)
+            }
+            for name, n := range selection.Replications {
+                if n < 5 || n >= 50 {
+                    t.Errorf("replications of %s: got %d", name, n)
+                }
+            }
+        })
+    }
+}
+
+// Selections don't depend on the number of workers, since each replication
+// of a scenario has its own seed.
+func TestSelectBestWorkers(t *testing.T) {
+    key := sim.GetResultsKey("Counter", "Trucks", "Value")
+    
+    a, err := NewScaleExperiment(1).SelectBest(key, false, 0.05, 10, 5, 50)
+    if err != nil {
+        t.Fatal(err)
+    }
+    b, err := NewScaleExperiment(3).SelectBest(key, false, 0.05, 10, 5, 50)
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    for name, mean := range a.Means {
+        if b.Means[name] != mean || b.Replications[name] != a.Replications[name] {
+            t.Errorf("%s: got %g in %d replications and %g in %d", name, mean, a.Replications[name], b.Means[name], b.Replications[name])
+        }
+    }
+}
+
+func TestSelectBestInvalid(t *testing.T) {
+    key := sim.GetResultsKey("Counter", "Trucks", "Value")
+    
+    tests := []struct {
+        name        string
+        alpha       float64
+        delta       float64
+        n0          int
+    }{
+        {"zero delta", 0.05, 0, 5},
+        {"negative delta", 0.05, -1, 5},
+        {"one initial replication", 0.05, 10, 1},
+        {"zero alpha", 0, 10, 5},
+        {"alpha of one", 1, 10, 5},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            selection, err := NewScaleExperiment(1).SelectBest(key, false, test.alpha, test.delta, test.n0, 50)
+            if err == nil {
+                t.Errorf("got %+v, want an error", selection)
+            }
+        })
+    }
+    
+    exp := NewScaleExperiment(1)
+    exp.Scenarios = nil
+    if _, err := exp.SelectBest(key, false, 0.05, 10, 5, 50); err == nil {
+        t.Errorf("no scenarios: want an error")
+    }
+    
+    missing := sim.GetResultsKey("Counter", "Truck", "Value")
+    if selection, err := NewScaleExperiment(0).SelectBest(missing, false, 0.05, 10, 5, 50); err == nil {
+        t.Errorf("missing key: got %+v, want an error", selection)
+    }
+}
+
+func TestCompare(t *testing.T) {
+    exp := NewScaleExperiment(0)
+    exp.Replications = 5
+    exp.Run()
+    
+    comparisons, err := exp.CompareAll(sim.GetResultsKey("Counter", "Trucks", "Value"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(comparisons) != 3 {
+        t.Fatalf("got %d comparisons, want 3", len(comparisons))
+    }
+    for _, comparison := range comparisons {
+        if !comparison.IsSignificant() {
+            t.Errorf("%s - %s: got %+v, want a significant difference", comparison.A, comparison.B, comparison.Difference)
+        }
+    }
+    
+    if _, err := exp.CompareAll(sim.GetResultsKey("Counter", "Truck", "Value")); err == nil {
+        t.Errorf("missing key: want an error")
+    }
+}
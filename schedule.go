@@ -0,0 +1,70 @@
+package sim
+
+import (
+    "log"
+)
+
+const (
+    EventType_ResourceSchedule string = "ResourceSchedule"
+)
+
+// ResourceSchedule changes the capacity of a resource over time: it is
+// Capacities[0] for Durations[0] seconds, then Capacities[1] for
+// Durations[1] seconds, and so on, starting over if Repeat is set. Units
+// taken away while busy are only removed when they are released.
+type ResourceSchedule struct {
+    Resource    string
+    Durations   []float64
+    Capacities  []float64
+    Repeat      bool
+    
+    // Simulation
+    Period      int
+}
+
+func (env *Environment) AddResourceSchedule(schedule ResourceSchedule) {
+    if _, ok := env.Resources[schedule.Resource]; !ok {
+        log.Fatalf("Resource not found: %s", schedule.Resource)
+    }
+    
+    if len(schedule.Durations) == 0 || len(schedule.Durations) != len(schedule.Capacities) {
+        log.Fatalf("Invalid resource schedule: %s", schedule.Resource)
+    }
+    
+    schedule.Period = 0
+    env.ResourceSchedules[schedule.Resource] = &schedule
+    env.AddEventHandler(EventType_ResourceSchedule, env.HandleResourceSchedule)
+    env.Schedule(Event{Date: env.Now, Type: EventType_ResourceSchedule, Id: schedule.Resource})
+}
+
+// SetResourceCapacity changes the total amount of a resource, keeping the
+// units that are busy.
+func (env *Environment) SetResourceCapacity(rid string, capacity float64) {
+    resource, ok := env.Resources[rid]
+    if !ok {
+        log.Fatalf("Resource not found: %s", rid)
+    }
+    
+    base := resource.GetResourceBase()
+    delta := capacity - base.Capacity
+    base.Capacity = capacity
+    env.SetResourceAmount(rid, resource.GetAmount() + delta)
+    env.Debug(LogComponent_Resource, "RESOURCE CAPACITY", "resource", rid, "capacity", capacity)
+}
+
+func (env *Environment) HandleResourceSchedule(event Event) {
+    schedule := env.ResourceSchedules[event.Id]
+    env.SetResourceCapacity(schedule.Resource, schedule.Capacities[schedule.Period])
+    
+    date := env.Now + schedule.Durations[schedule.Period]
+    schedule.Period++
+    
+    if schedule.Period == len(schedule.Durations) {
+        if !schedule.Repeat {
+            return
+        }
+        schedule.Period = 0
+    }
+    
+    env.Schedule(Event{Date: date, Type: EventType_ResourceSchedule, Id: schedule.Resource})
+}
@@ -2,7 +2,9 @@ package sim
 
 import (
     "fmt"
+    "io"
     "log"
+    "log/slog"
     "slices"
     "time"
     "math"
@@ -33,15 +35,6 @@ func AC_Magenta(str string) string {return AC_CodeMagenta + str + AC_Reset}
 func AC_Cyan(str string) string {return AC_CodeCyan + str + AC_Reset}
 func AC_Bold(str string) string {return AC_CodeBold + str + AC_ResetBold}
 
-type MonthInfo struct {
-    NumDays int
-    BeginingSec float64
-}
-
-var Months [12]MonthInfo
-const ProgressBarMaxSize = 40
-// var NumDays [12]int = [12]int{31, 28, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
-
 func WaitForEnter() {
     fmt.Printf(AC_Bold("[STEP THROUGH] Press ENTER to continue\n"))
     bufio.NewReader(os.Stdin).ReadBytes('\n')
@@ -51,21 +44,32 @@ type RNG interface {
     Next() float64
 }
 
+// SeedableRNG is implemented by RNGs that can be reset to a deterministic
+// state, so that environments with a seed (see env.SetSeed) reproduce the
+// same trajectory.
+type SeedableRNG interface {
+    RNG
+    Seed(seed uint64)
+}
+
 type RNGExponential struct {
     Rate    float64
     RNG     rand.Rand
+    Src     rand.Source
 }
 
 type RNGNormal struct {
     Mean    float64
     StdDev  float64
     RNG     rand.Rand
+    Src     rand.Source
 }
 
 type RNGLogNormal struct {
     Mean    float64
     StdDev  float64
     RNG     distuv.LogNormal
+    Src     rand.Source
 }
 
 type RNGTriangular struct {
@@ -73,33 +77,51 @@ type RNGTriangular struct {
     B       float64
     C       float64
     RNG     distuv.Triangle
+    Src     rand.Source
 }
 
+// RNGDiscrete returns the index of the weight drawn, or the value at that
+// index if Values is set.
 type RNGDiscrete struct {
     Weights []float64
+    Values  []float64
     RNG     distuv.Categorical
+    Src     rand.Source
+}
+
+type RNGConstant struct {
+    Value   float64
+}
+
+func NewSource() rand.Source {
+    return rand.NewSource(uint64(time.Now().UnixNano()))
 }
 
 func NewRNGExponential(rate float64) *RNGExponential {
-    return &RNGExponential{Rate: rate, RNG: *rand.New(rand.NewSource(uint64(time.Now().UnixMilli())))}
+    src := NewSource()
+    return &RNGExponential{Rate: rate, RNG: *rand.New(src), Src: src}
 }
 
 func NewRNGNormal(mean float64, stddev float64) *RNGNormal {
-    return &RNGNormal{Mean: mean, StdDev: stddev, RNG: *rand.New(rand.NewSource(uint64(time.Now().UnixMilli())))}
+    src := NewSource()
+    return &RNGNormal{Mean: mean, StdDev: stddev, RNG: *rand.New(src), Src: src}
 }
 
 func NewRNGLogNormal(mean float64, stddev float64) *RNGLogNormal {
     mu := math.Log(math.Pow(mean, 2) / math.Sqrt(math.Pow(mean, 2) + math.Pow(stddev, 2)))
     sigma := math.Sqrt(math.Log(1 + math.Pow(stddev, 2)/math.Pow(mean, 2)))
-    return &RNGLogNormal{Mean: mean, StdDev: stddev, RNG: distuv.LogNormal{Mu: mu, Sigma: sigma, Src: rand.NewSource(uint64(time.Now().UnixMilli()))}}
+    src := NewSource()
+    return &RNGLogNormal{Mean: mean, StdDev: stddev, RNG: distuv.LogNormal{Mu: mu, Sigma: sigma, Src: src}, Src: src}
 }
 
 func NewRNGTriangular(a float64, b float64, c float64) *RNGTriangular {
-    return &RNGTriangular{A: a, B: b, C: c, RNG: distuv.NewTriangle(a, b, c, rand.NewSource(uint64(time.Now().UnixMilli())))}
+    src := NewSource()
+    return &RNGTriangular{A: a, B: b, C: c, RNG: distuv.NewTriangle(a, b, c, src), Src: src}
 }
 
 func NewRNGDiscrete(w []float64) *RNGDiscrete {
-    return &RNGDiscrete{Weights: w, RNG: distuv.NewCategorical(w, rand.NewSource(uint64(time.Now().UnixMilli())))}
+    src := NewSource()
+    return &RNGDiscrete{Weights: w, RNG: distuv.NewCategorical(w, src), Src: src}
 }
 
 func (rng *RNGExponential) Next() float64 {
@@ -119,9 +141,45 @@ func (rng *RNGTriangular) Next() float64 {
 }
 
 func (rng *RNGDiscrete) Next() float64 {
+    if len(rng.Values) > 0 {
+        return rng.Values[int(rng.RNG.Rand())]
+    }
     return rng.RNG.Rand()
 }
 
+func (rng *RNGConstant) Next() float64 {
+    return rng.Value
+}
+
+func (rng *RNGExponential) Seed(seed uint64) {
+    rng.RNG.Seed(seed)
+}
+
+func (rng *RNGNormal) Seed(seed uint64) {
+    rng.RNG.Seed(seed)
+}
+
+func (rng *RNGLogNormal) Seed(seed uint64) {
+    rng.Src.Seed(seed)
+}
+
+func (rng *RNGTriangular) Seed(seed uint64) {
+    rng.Src.Seed(seed)
+}
+
+func (rng *RNGDiscrete) Seed(seed uint64) {
+    rng.Src.Seed(seed)
+}
+
+// GetStreamSeed derives the seed of an independent random number stream
+// from a base seed (splitmix64).
+func GetStreamSeed(seed uint64, stream int) uint64 {
+    z := seed + uint64(stream+1) * 0x9e3779b97f4a7c15
+    z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+    z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+    return z ^ (z >> 31)
+}
+
 func Minutes(n float64) float64 {return 60*n}
 func Hours(n float64) float64 {return Minutes(60)*n}
 func Days(n float64) float64 {return Hours(24)*n}
@@ -132,6 +190,9 @@ type QueueType int
 const (
     QueueType_Resource QueueType = iota
     QueueType_Process
+    QueueType_Hold
+    QueueType_Transporter
+    QueueType_Conveyor
 )
 
 type QueueStatistics struct {
@@ -139,6 +200,8 @@ type QueueStatistics struct {
     TotalEntitiesOut int
     TotalTimeInQueue float64
     AvgTimeInQueue float64
+    TimeInQueue Tally
+    QueueLength TimePersistent
 }
 
 type QueueStats struct {
@@ -158,6 +221,13 @@ type ProcessStats struct {
 type EntityBase struct {
     Id      int
     Type    string
+    DateCreated  float64
+    WaitTime     float64
+    ProcessTime  float64
+    TransferTime float64
+    Disposed     bool
+    Costs        Costs
+    Station      string // last process or station forwarded to
     QueueStats   []*QueueStats
     ProcessStats []*ProcessStats
     Resources    map[string]float64
@@ -259,11 +329,24 @@ func (entityBase *EntityBase) LeaveQueue(tp QueueType, id string, date float64)
         st := entityBase.QueueStats[i]
         if st.Type == tp && st.Id == id {
             st.DateOut = date
+            if tp != QueueType_Resource && entityBase.Environment != nil {
+                entityBase.Environment.AddEntityTime(entityBase, Allocation_Waiting, st.DateOut - st.DateIn)
+            }
             return
         }
     }
 }
 
+func (entityBase *EntityBase) GetQueueStats(tp QueueType, id string) *QueueStats {
+    for i := len(entityBase.QueueStats)-1; i >= 0; i-- {
+        st := entityBase.QueueStats[i]
+        if st.Type == tp && st.Id == id {
+            return st
+        }
+    }
+    return nil
+}
+
 func (entityBase *EntityBase) SeizeResource(rid string, amount float64, date float64) {
     entityBase.Resources[rid] = amount
     entityBase.LeaveQueue(QueueType_Resource, rid, date)
@@ -276,9 +359,15 @@ func (entityBase *EntityBase) ReleaseResources() {
 type ResourceBase struct {
     Id          string
     Amount      float64
+    Capacity    float64 // Amount when added, if not set
     Queue       []Entity
+    BusyCost    float64 // per hour and unit
+    IdleCost    float64 // per hour and unit
+    UseCost     float64 // per seize
     
     // Statistics
+    Busy        TimePersistent
+    Uses        int
     TotalEntitiesIn int
     TotalEntitiesOut int
     TotalTimeInQueue float64
@@ -286,20 +375,44 @@ type ResourceBase struct {
 }
 
 type Resource interface {
+    GetResourceBase() *ResourceBase
     Enqueue(entity Entity)
-    Dequeue()
+    Dequeue(entity Entity)
     GetAmount() float64
     SetAmount(amount float64)
 }
 
+func (res *ResourceBase) GetResourceBase() *ResourceBase {
+    return res
+}
+
+func (res *ResourceBase) GetUtilization(now float64) float64 {
+    if res.Capacity <= 0 {
+        return 0
+    }
+    return res.Busy.GetMean(now) / res.Capacity
+}
+
 func (res *ResourceBase) Enqueue(entity Entity) {
     res.Queue = append(res.Queue, entity)
     res.TotalEntitiesIn++
 }
 
-func (res *ResourceBase) Dequeue() {
-    res.Queue = res.Queue[1:]
+// Dequeue removes an entity from the queue when it seizes the resource,
+// which is not always the first in the queue, since the processes that
+// need a resource take their entities in their own order.
+func (res *ResourceBase) Dequeue(entity Entity) {
+    i := slices.Index(res.Queue, entity)
+    if i < 0 {
+        return
+    }
+    res.Queue = slices.Delete(res.Queue, i, i+1)
     res.TotalEntitiesOut++
+    
+    if st := entity.GetEntityBase().GetQueueStats(QueueType_Resource, res.Id); st != nil {
+        res.TotalTimeInQueue += st.DateOut - st.DateIn
+        res.AvgTimeInQueue = res.TotalTimeInQueue / float64(res.TotalEntitiesOut)
+    }
 }
 
 func (res *ResourceBase) GetAmount() float64 {
@@ -319,11 +432,16 @@ type ProcessBase struct {
     DelayFunc   func (process *ProcessBase, entity Entity) float64
     Forward     func (entity Entity)
     NextProcess string
+    Routes      []RouteSpec // picked by probability if there is no Forward
+    Transfer    bool // time in the process is transfer time, like travel
+    NonValueAdded bool // time in the process is non-value-added
     
     QueueStats  QueueStatistics
     AvgDuration float64
     AccumDuration float64
     TotalEntitiesOut int
+    Durations   Tally
+    TypeStats   map[string]*ProcessTypeStatistics // by entity type
 }
 
 type Process interface {
@@ -371,6 +489,7 @@ func (process *ProcessBase) GetDuration(entity Entity) float64 {
 func (process *ProcessBase) Enqueue(entity Entity) {
     process.Queue = append(process.Queue, entity)
     process.QueueStats.TotalEntitiesIn++
+    process.QueueStats.QueueLength.Update(entity.GetEnvironment().Now, float64(len(process.Queue)))
 }
 
 func (process *ProcessBase) Dequeue() {
@@ -379,6 +498,8 @@ func (process *ProcessBase) Dequeue() {
     process.Queue = process.Queue[1:]
     process.QueueStats.TotalEntitiesOut++
     process.QueueStats.AvgTimeInQueue = process.QueueStats.TotalTimeInQueue / float64(process.QueueStats.TotalEntitiesIn)
+    process.QueueStats.TimeInQueue.Record(entity.GetTimeInQueue())
+    process.QueueStats.QueueLength.Update(entity.GetEnvironment().Now, float64(len(process.Queue)))
 }
 
 func (process *ProcessBase) GetQueueSize() int {
@@ -401,6 +522,18 @@ func (a ByDateEnd) Len() int           { return len(a) }
 func (a ByDateEnd) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByDateEnd) Less(i, j int) bool { return a[i].DateEnd < a[j].DateEnd }
 
+// Event is a scheduled occurrence handled by the handler registered for
+// its Type (see env.Schedule). Events only carry data so that subsystems
+// like transporters can be driven by the same clock as processes.
+type Event struct {
+    Date    float64
+    Type    string
+    Id      string
+    Entity  Entity
+}
+
+type EventHandler func (event Event)
+
 type EntitySourceBase struct {
     Id              string
     RNG             RNG
@@ -469,9 +602,6 @@ func (source *EntitySourceBase) Update() {
     source.Generations++
 }
 
-type PrintfFunc func (format string, a ...any) (n int, err error)
-func DisabledPrintf(format string, a ...any) (n int, err error) {return 0, nil}
-
 type Environment struct {
     EntitySources   []EntitySource // array because needs sorting
     Resources       map[string]Resource // map of strings because persistent
@@ -479,40 +609,50 @@ type Environment struct {
     Processes       []Process // array because needs sorting
     WatchedProcesses map[string]Process // array because needs sorting
     OngoingProcesses []OngoingProcess // array because needs sorting
+    Events          []Event // array because needs sorting
+    EventHandlers   map[string]EventHandler
+    Holds           []*HoldBase // array because signals release in order
+    Transporters    []*TransporterBase
+    Conveyors       []*ConveyorBase
+    Stations        map[string]Station // non-process destinations of ForwardTo
+    Variables       map[string]float64
+    ResourceSchedules map[string]*ResourceSchedule
+    Monitors        []*Monitor
+    Counters        map[string]*Counter
+    Tallies         map[string]*Tally
+    EntityTypes     map[string]*EntityTypeStatistics
+    HoldingCosts    map[string]float64 // per hour, by entity type
+    Flows           map[string]map[string]int // entities forwarded, by station
+    ChangedKeys     map[string]bool
     NextEntityId    int
     Now             float64 // seconds
+    StartTime       time.Time // calendar time at Now = 0
     EndDate         float64 // seconds
+    WarmUp          float64 // seconds, statistics are reset at this date
+    StatisticsStart float64 // end of the warm-up, once reached
     Replications int // seconds
+    Replication     int
+    Seed            uint64
+    Seeded          bool
+    NextStream      int
+    Rand            *rand.Rand
+    RandSource      rand.Source
+    RNGs            []RNG // added with AddRNG, saved in snapshots
+    Restored        bool // from a snapshot, so Begin keeps the clock
     
     RunStart        time.Time
-    LastBarRefresh  time.Time
-    ProgressBarSize int
-    ProgressPercent int
+    Progress        ProgressReporter // terminal bar if nil and LogLevel is 1
+    ProgressInterval time.Duration
+    LastProgress    time.Time
+    EventCount      int
     
     StepThrough      bool
     LogLevel        int
-    Printf          [3]PrintfFunc
-}
-
-func (env* Environment) GetCurrentMonth() int {
-    for m := 0; m < 12; m++ {
-        if env.Now >= Months[m].BeginingSec {
-            return m
-        }
-    }
-    return 0
-}
-
-func (env *Environment) SetLogLevel(level int) {
-    for i := 0; i < len(env.Printf); i++ {
-        env.Printf[i] = DisabledPrintf
-    }
-    
-    for i := 1; i <= level; i++ {
-        env.Printf[i] = fmt.Printf
-    }
-    
-    env.LogLevel = level
+    LogComponents   []string // components that log, all if empty
+    LogOutput       io.Writer // stdout if nil
+    Logger          *slog.Logger
+    Tracer          *Tracer
+    Debugger        *Debugger
 }
 
 func GetHumanTime(s float64) string {
@@ -533,7 +673,16 @@ func (env *Environment) Enqueue(entity Entity, process Process) {
     process.Enqueue(entity)
     entity.EnterQueue(QueueType_Process, process.GetId(), env.Now)
     
+    if env.Tracer != nil {
+        env.Trace(TraceRecord{Type: TraceType_Enqueue, Entity: entity.GetName(), Process: process.GetId(), Queue: process.GetQueueSize()})
+    }
+    
+    if env.Debugger != nil {
+        env.Debugger.OnEnter(entity, process.GetId(), process.GetQueueSize())
+    }
+    
     env.WatchedProcesses[process.GetId()] = process
+    env.NotifyChange(process.GetId())
 }
 
 func (env *Environment) GetProcess(pid string) Process {
@@ -551,21 +700,95 @@ func (env *Environment) GetProcessBase(pid string) *ProcessBase {
 }
 
 func (env *Environment) ForwardTo(entity Entity, pid string) {
+    env.RecordFlow(entity, pid)
+    
     process := env.GetProcess(pid)
-    if process == nil {
+    if process != nil {
+        env.Enqueue(entity, process)
+        return
+    }
+    
+    station, ok := env.Stations[pid]
+    if !ok {
         log.Fatalf("Process not found: %s", pid)
     }
-    env.Enqueue(entity, env.GetProcess(pid))
+    station.Receive(entity)
+}
+
+func (env *Environment) AddEventHandler(eventType string, handler EventHandler) {
+    env.EventHandlers[eventType] = handler
+}
+
+// Schedule adds an event to the event list. Events with the same date are
+// handled in the order they were scheduled.
+func (env *Environment) Schedule(event Event) {
+    if _, ok := env.EventHandlers[event.Type]; !ok {
+        log.Fatalf("Event handler not found: %s", event.Type)
+    }
+    
+    i := sort.Search(len(env.Events), func(i int) bool { return env.Events[i].Date > event.Date })
+    env.Events = slices.Insert(env.Events, i, event)
+}
+
+// SetSeed makes the environment reproducible: every RNG added from now on
+// (with processes, entity sources or env.AddRNG) gets its own stream, seeded
+// from seed in the order they are added. env.Rand is the first stream, to be
+// used for random decisions in the model. Call it before building the model.
+func (env *Environment) SetSeed(seed uint64) {
+    env.Seed = seed
+    env.Seeded = true
+    env.NextStream = 0
+    env.Rand.Seed(GetStreamSeed(seed, env.NextStream))
+    env.NextStream++
+}
+
+// AddRNG keeps the RNG so that its state is saved in snapshots, and gives
+// it its own stream if the environment has a seed.
+func (env *Environment) AddRNG(rng RNG) {
+    if rng == nil {
+        return
+    }
+    
+    env.RNGs = append(env.RNGs, rng)
+    if !env.Seeded {
+        return
+    }
+    
+    if seedable, ok := rng.(SeedableRNG); ok {
+        seedable.Seed(GetStreamSeed(env.Seed, env.NextStream))
+        env.NextStream++
+    }
 }
 
 func (env *Environment) AddResource(resource *ResourceBase) {
+    if resource.Capacity == 0 {
+        resource.Capacity = resource.Amount
+    }
     env.Resources[resource.Id] = resource
 }
 
+// SetResourceAmount changes the amount available of a resource, keeping
+// track of how much of its capacity is busy.
+func (env *Environment) SetResourceAmount(rid string, amount float64) {
+    resource := env.Resources[rid]
+    resource.SetAmount(amount)
+    base := resource.GetResourceBase()
+    base.Busy.Update(env.Now, base.Capacity - amount)
+    env.NotifyChange(rid)
+    
+    if env.Tracer != nil {
+        env.TraceResource(rid)
+    }
+}
+
 func (env *Environment) AddProcess(base ProcessBase) {
     if len(base.Groups) == 0 {
         base.Groups = []string{"Unnamed"}
     }
+    if base.Forward == nil && len(base.Routes) > 0 {
+        base.Forward = NewRoutingFunc(env, base.Routes)
+    }
+    env.AddRNG(base.RNG)
     env.Processes = append(env.Processes, &base)
 }
     
@@ -573,14 +796,21 @@ func (env *Environment) AddEntitySource(entitySource EntitySource) {
     entitySource.GetEntitySourceBase().BatchSize = max(1, entitySource.GetEntitySourceBase().BatchSize)
     entitySource.GetEntitySourceBase().MaxGenerations = 9999999999
     entitySource.GetEntitySourceBase().Env = env
+    env.AddRNG(entitySource.GetEntitySourceBase().RNG)
     env.EntitySources = append(env.EntitySources, entitySource)
 }
 
 func (env *Environment) AddEntity(entityType string, entity Entity) {
     entity.Initialize(env.NextEntityId, entityType)
     entity.GetEntityBase().Environment = env
+    entity.GetEntityBase().DateCreated = env.Now
     env.Entities[entity.GetId()] = entity
     env.NextEntityId++
+    env.RecordCreate(entity)
+    
+    if env.Tracer != nil {
+        env.Trace(TraceRecord{Type: TraceType_Create, Entity: entity.GetName()})
+    }
 }
 
 func (env *Environment) MaybeStartProcess(process Process) {
@@ -592,8 +822,11 @@ func (env *Environment) MaybeStartProcess(process Process) {
             seized := entity.GetResourceAmount(rid)
             if seized < amount {
                 if env.Resources[rid].GetAmount() >= amount {
-                    env.Resources[rid].SetAmount(env.Resources[rid].GetAmount() - amount)
+                    env.SetResourceAmount(rid, env.Resources[rid].GetAmount() - amount)
                     entity.SeizeResource(rid, amount, env.Now)
+                    env.Resources[rid].Dequeue(entity)
+                    env.Resources[rid].GetResourceBase().Uses++
+                    env.AddEntityCost(entity.GetEntityBase(), process.GetProcessBase().GetAllocation(), env.Resources[rid].GetResourceBase().UseCost)
                 } else {
                     readyToStart = false
                 }
@@ -601,7 +834,9 @@ func (env *Environment) MaybeStartProcess(process Process) {
         }
         
         if readyToStart {
-            env.Printf[2]("[PROCESS STARTED] %s | %s\n", process.GetId(), entity.GetName())
+            if env.IsLogging(slog.LevelDebug, LogComponent_Process) {
+                env.Debug(LogComponent_Process, "PROCESS STARTED", "process", process.GetId(), "entity", entity)
+            }
             entity.LeaveQueue(QueueType_Process, process.GetId(), env.Now)
             duration := process.GetDuration(entity)
             env.StartProcess(process, entity, env.Now + duration)
@@ -620,6 +855,10 @@ func (env *Environment) StartProcess(process Process, entity Entity, endDate flo
     process.Dequeue()
     ongoing := OngoingProcess{Process: process, Entity: entity, DateStart: env.Now, DateEnd: endDate}
     env.OngoingProcesses = append(env.OngoingProcesses, ongoing)
+    
+    if env.Tracer != nil {
+        env.Trace(TraceRecord{Type: TraceType_Start, Entity: entity.GetName(), Process: process.GetId(), Queue: process.GetQueueSize()})
+    }
 }
 
 func Cast[T Entity](entity Entity) T {
@@ -629,50 +868,37 @@ func Cast[T Entity](entity Entity) T {
     panic("Cast failed!")
 }
 
-func GetProgressBarSize(progress float64) int {
-    return int(math.Ceil(progress * float64(ProgressBarMaxSize)))
-}
-
-func RefreshProgressBar(progress float64) {
-    fmt.Printf("\033[%dD[", ProgressBarMaxSize+2+5)
-
-    progressBarSize := GetProgressBarSize(progress)
-
-    for c := 0; c < progressBarSize; c++ {
-        fmt.Printf("\u25A0")
-    }
-    fmt.Printf("%.*s] %3.0f%%", ProgressBarMaxSize - progressBarSize, "                                            ", progress * 100)
-}
-
 func (env *Environment) Begin() {
-    var NumDays [12]int = [12]int{31, 28, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
-    
-    Months := make([]MonthInfo, 12)
-    for m := 0; m < 12; m++ {
-        Months[m].NumDays = NumDays[m]
-    }
-    
-    for m := 1; m < 12; m++ {
-        Months[m].BeginingSec = float64(NumDays[m-1]) * 24 * 60 * 60
-    }
-    
     if env.StepThrough {
         env.LogLevel = 2
     }
     
-    env.SetLogLevel(env.LogLevel)
     sort.Sort(ByNextGen(env.EntitySources))
-    env.Now = env.EntitySources[0].GetNextGen()
+    if !env.Restored {
+        env.Now = env.EntitySources[0].GetNextGen()
+    }
+    env.BeginMonitors()
+    
+    if env.WarmUp > 0 && !env.Restored {
+        env.Schedule(Event{Date: env.WarmUp, Type: EventType_WarmUp})
+    }
     
     env.RunStart = time.Now()
-    env.LastBarRefresh = time.Now()
+    env.LastProgress = time.Now()
+    env.EventCount = 0
     
-    env.Printf[1]("[STARTING SIMULATION]\n")
-    env.Printf[1]("[REPLICATIONS] %d\n", env.Replications)
-    env.Printf[1]("[SIMULATED TIME] %s\n", GetHumanTime(env.EndDate))
+    // the progress bar is shown by default when only the start and end of
+    // runs are logged
+    if env.Progress == nil && env.LogLevel == 1 {
+        env.Progress = NewTerminalProgress(env.LogOutput)
+    }
     
-    env.ProgressBarSize = GetProgressBarSize(0)
-    env.ProgressPercent = 0;
+    env.Info(LogComponent_Run, "STARTING SIMULATION")
+    env.Info(LogComponent_Run, "REPLICATIONS", "replications", env.Replications)
+    env.Info(LogComponent_Run, "SIMULATED TIME", "duration", GetHumanTime(env.EndDate))
+    if !env.StartTime.IsZero() {
+        env.Info(LogComponent_Run, "START TIME", "start", env.GetHumanTime(0))
+    }
 }
 
 func (env *Environment) Advance() bool {
@@ -680,7 +906,9 @@ func (env *Environment) Advance() bool {
         return false
     }
     
-    env.Printf[2](AC_Green(AC_Bold("[SIMULATION CLOCK] %s (%.2fs)\n")), GetHumanTime(env.Now), env.Now)
+    if env.IsLogging(slog.LevelDebug, LogComponent_Clock) {
+        env.Debug(LogComponent_Clock, "SIMULATION CLOCK", "time", env.GetHumanTime(env.Now))
+    }
     
     for s := 0; s < len(env.EntitySources); {
         source := env.EntitySources[s]
@@ -691,8 +919,10 @@ func (env *Environment) Advance() bool {
         
         for e := 0; e < source.GetBatchSize(); e++ {
             entity := source.Generate()
-            env.Printf[2]("[NEW ENTITY] %s | %s\n", source.GetId(), entity.GetName())
-            _ = entity
+            env.EventCount++
+            if env.IsLogging(slog.LevelDebug, LogComponent_Source) {
+                env.Debug(LogComponent_Source, "NEW ENTITY", "source", source.GetId(), "entity", entity)
+            }
         }
         
         source.Update()
@@ -718,10 +948,17 @@ func (env *Environment) Advance() bool {
             process := ongoing.Process
             
             entity.EndProcess(env.Now)
-            env.Printf[2]("[PROCESS ENDED] %s | %s\n", process.GetId(), entity.GetName())
+            env.EventCount++
+            if env.IsLogging(slog.LevelDebug, LogComponent_Process) {
+                env.Debug(LogComponent_Process, "PROCESS ENDED", "process", process.GetId(), "entity", entity)
+            }
+            
+            if env.Tracer != nil {
+                env.Trace(TraceRecord{Type: TraceType_End, Entity: entity.GetName(), Process: process.GetId(), Queue: process.GetQueueSize()})
+            }
             
             for rid, amount := range process.GetNeeds() {
-                env.Resources[rid].SetAmount(env.Resources[rid].GetAmount() + amount)
+                env.SetResourceAmount(rid, env.Resources[rid].GetAmount() + amount)
             }
             
             entity.ReleaseResources()
@@ -730,24 +967,58 @@ func (env *Environment) Advance() bool {
             process.GetProcessBase().TotalEntitiesOut++
             process.GetProcessBase().AccumDuration += entity.GetProcessDuration()
             process.GetProcessBase().AvgDuration = process.GetProcessBase().AccumDuration / float64(process.GetProcessBase().TotalEntitiesOut)
+            process.GetProcessBase().Durations.Record(entity.GetProcessDuration())
+            env.RecordProcessEnd(process, entity)
+            env.NotifyChange(process.GetId())
             
             if ongoing.Process.GetProcessBase().Forward != nil {
                 ongoing.Process.GetProcessBase().Forward(entity)
             } else if ongoing.Process.GetProcessBase().NextProcess != "" {
                 env.ForwardTo(entity, ongoing.Process.GetProcessBase().NextProcess)
             } else {
-                // dispose
+                env.Dispose(entity)
             }
         }
         
-        // start processes that can be started
-        for _, process := range env.WatchedProcesses {
-            env.MaybeStartProcess(process)
+        for len(env.Events) > 0 && env.Events[0].Date <= env.Now {
+            event := env.Events[0]
+            env.Events = env.Events[1:]
+            env.EventCount++
+            
+            if env.Tracer != nil {
+                record := TraceRecord{Type: TraceType_Event, Event: event.Type, Id: event.Id}
+                if event.Entity != nil {
+                    record.Entity = event.Entity.GetName()
+                }
+                env.Trace(record)
+            }
+            env.EventHandlers[event.Type](event)
         }
         
-        for key, process := range env.WatchedProcesses {
-            if process == nil {
-                delete(env.WatchedProcesses, key)
+        // start processes that can be started, releasing held entities
+        // whose conditions became true until nothing else changes
+        for {
+            // sorted so that runs with the same seed are identical
+            watched := make([]string, 0, len(env.WatchedProcesses))
+            for pid, _ := range env.WatchedProcesses {
+                watched = append(watched, pid)
+            }
+            slices.Sort(watched)
+            
+            for _, pid := range watched {
+                if process := env.WatchedProcesses[pid]; process != nil {
+                    env.MaybeStartProcess(process)
+                }
+            }
+            
+            for key, process := range env.WatchedProcesses {
+                if process == nil {
+                    delete(env.WatchedProcesses, key)
+                }
+            }
+            
+            if !env.EvaluateHolds() {
+                break
             }
         }
         
@@ -763,35 +1034,23 @@ func (env *Environment) Advance() bool {
         if len(env.OngoingProcesses) > 0 {
             nextTime = min(nextTime, env.OngoingProcesses[0].DateEnd)
         }
+        
+        if len(env.Events) > 0 {
+            nextTime = min(nextTime, env.Events[0].Date)
+        }
     }
     
+    env.SampleMonitors()
     env.Now = nextTime
     
     if env.StepThrough {
         WaitForEnter()
-    } else if (env.LogLevel == 1) {
-        progress := env.Now / env.EndDate
-        newProgressPercent := int(math.Ceil(progress * 100))
-        if time.Since(env.LastBarRefresh).Seconds() >= 1.0/15.0 && (GetProgressBarSize(progress) > env.ProgressBarSize || env.ProgressPercent != newProgressPercent) {
-            env.LastBarRefresh = time.Now()
-            RefreshProgressBar(progress)
-            env.ProgressBarSize = GetProgressBarSize(progress)
-            env.ProgressPercent = newProgressPercent
-        }
-    } else {
-        env.Printf[2]("\n")
     }
+    env.ReportProgress()
     
     if env.Now >= env.EndDate {
-        if env.StepThrough {
-            RefreshProgressBar(1)
-        }
-        
-        env.Printf[1]("\n")
-        env.Printf[1]("[SIMULATION ENDED]\n")
-        env.Printf[1]("[AVG REPLICATION TIME] %.2fs\n", time.Since(env.RunStart).Seconds())
-        
-        env.Printf[1]("\n")
+        env.Info(LogComponent_Run, "SIMULATION ENDED")
+        env.Info(LogComponent_Run, "AVG REPLICATION TIME", "seconds", fmt.Sprintf("%.2fs", time.Since(env.RunStart).Seconds()))
         
         return false
     } else {
@@ -825,6 +1084,25 @@ func NewEnvironment() *Environment {
     env.Processes = make([]Process, 0)
     env.OngoingProcesses = make([]OngoingProcess, 0)
     env.WatchedProcesses = make(map[string]Process)
+    env.Events = make([]Event, 0)
+    env.EventHandlers = make(map[string]EventHandler)
+    env.Holds = make([]*HoldBase, 0)
+    env.Transporters = make([]*TransporterBase, 0)
+    env.Conveyors = make([]*ConveyorBase, 0)
+    env.Stations = make(map[string]Station)
+    env.Variables = make(map[string]float64)
+    env.ResourceSchedules = make(map[string]*ResourceSchedule)
+    env.Monitors = make([]*Monitor, 0)
+    env.Counters = make(map[string]*Counter)
+    env.Tallies = make(map[string]*Tally)
+    env.EntityTypes = make(map[string]*EntityTypeStatistics)
+    env.HoldingCosts = make(map[string]float64)
+    env.Flows = make(map[string]map[string]int)
+    env.ChangedKeys = make(map[string]bool)
+    env.RandSource = NewSource()
+    env.Rand = rand.New(env.RandSource)
+    env.ProgressInterval = time.Second / 15
+    env.AddEventHandler(EventType_WarmUp, env.HandleWarmUp)
     
     env.Replications = 1
     return env
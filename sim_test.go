@@ -0,0 +1,19 @@
+package sim
+
+type TestSource struct {
+    EntitySourceBase
+    Station     string
+}
+
+func (source *TestSource) Generate() Entity {
+    env := source.GetEnvironment()
+    entity := &EntityBase{}
+    env.AddEntity("Box", entity)
+    env.ForwardTo(entity, source.Station)
+    return entity
+}
+
+// NewTestSource returns a source of n entities at date 0, sent to station.
+func NewTestSource(station string, n int) *TestSource {
+    return &TestSource{EntitySourceBase: EntitySourceBase{Id: "Boxes", BatchSize: n, RNG: &RNGConstant{Value: Days(1)}}, Station: station}
+}
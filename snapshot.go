@@ -0,0 +1,971 @@
+package sim
+
+import (
+    "bufio"
+    "bytes"
+    "encoding"
+    "encoding/gob"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "reflect"
+    "slices"
+    "sort"
+    "sync"
+    
+    "golang.org/x/exp/rand"
+)
+
+func init() {
+    RegisterEntity("sim.EntityBase", &EntityBase{})
+    RegisterEntity("sim.ModelEntity", &ModelEntity{})
+}
+
+var (
+    entityTypesMutex    sync.Mutex
+    entityTypes         = make(map[string]reflect.Type)
+    entityNames         = make(map[reflect.Type]string)
+)
+
+// RegisterEntity registers an entity type, a pointer to a struct that
+// embeds EntityBase, so that its entities can be saved in snapshots. The
+// name must not change between the run that saves a snapshot and the one
+// that restores it:
+//
+//     sim.RegisterEntity("expograo.Truck", &Truck{})
+//
+// The exported fields of the struct are saved with encoding/gob:
+// unexported fields are lost and pointers are saved as copies of what they
+// point to, so fields that refer to other entities or to model data should
+// be unexported and set again after restoring.
+func RegisterEntity(name string, entity Entity) {
+    entityType := reflect.TypeOf(entity)
+    if entityType.Kind() != reflect.Pointer || entityType.Elem().Kind() != reflect.Struct {
+        log.Fatalf("Entity type must be a pointer to a struct: %s", name)
+    }
+    
+    entityTypesMutex.Lock()
+    defer entityTypesMutex.Unlock()
+    entityTypes[name] = entityType.Elem()
+    entityNames[entityType.Elem()] = name
+}
+
+func GetEntityTypeName(entity Entity) (string, bool) {
+    entityTypesMutex.Lock()
+    defer entityTypesMutex.Unlock()
+    name, ok := entityNames[reflect.TypeOf(entity).Elem()]
+    return name, ok
+}
+
+func GetEntityType(name string) (reflect.Type, bool) {
+    entityTypesMutex.Lock()
+    defer entityTypesMutex.Unlock()
+    entityType, ok := entityTypes[name]
+    return entityType, ok
+}
+
+// GetEntityDataFields returns the indices of the fields of an entity struct
+// that are saved in snapshots, besides its EntityBase.
+func GetEntityDataFields(structType reflect.Type) []int {
+    fields := make([]int, 0)
+    baseType := reflect.TypeOf(EntityBase{})
+    if structType == baseType {
+        return fields
+    }
+    
+    for f := 0; f < structType.NumField(); f++ {
+        field := structType.Field(f)
+        if field.IsExported() && !(field.Anonymous && field.Type == baseType) {
+            fields = append(fields, f)
+        }
+    }
+    return fields
+}
+
+// GetEntityDataType returns a struct type with the fields of an entity
+// saved in snapshots, so that gob never sees the environment the entity
+// points to.
+func GetEntityDataType(structType reflect.Type, fields []int) reflect.Type {
+    dataFields := make([]reflect.StructField, len(fields))
+    for i, f := range fields {
+        field := structType.Field(f)
+        dataFields[i] = reflect.StructField{Name: field.Name, Type: field.Type}
+    }
+    return reflect.StructOf(dataFields)
+}
+
+// EntitySnapshot is an entity of a registered type (see RegisterEntity).
+// Data holds the fields of the type other than EntityBase.
+type EntitySnapshot struct {
+    TypeName        string
+    Id              int
+    Type            string
+    DateCreated     float64
+    WaitTime        float64
+    ProcessTime     float64
+    TransferTime    float64
+    Disposed        bool
+    Costs           Costs
+    Station         string
+    QueueStats      []*QueueStats
+    ProcessStats    []*ProcessStats
+    Resources       map[string]float64
+    Data            []byte
+}
+
+func GetEntitySnapshot(entity Entity) (EntitySnapshot, error) {
+    name, ok := GetEntityTypeName(entity)
+    if !ok {
+        return EntitySnapshot{}, fmt.Errorf("entity type not registered: %T", entity)
+    }
+    
+    base := entity.GetEntityBase()
+    st := EntitySnapshot{
+        TypeName: name,
+        Id: base.Id,
+        Type: base.Type,
+        DateCreated: base.DateCreated,
+        WaitTime: base.WaitTime,
+        ProcessTime: base.ProcessTime,
+        TransferTime: base.TransferTime,
+        Disposed: base.Disposed,
+        Costs: base.Costs,
+        Station: base.Station,
+        QueueStats: CopyQueueStats(base.QueueStats),
+        ProcessStats: CopyProcessStats(base.ProcessStats),
+        Resources: CopyResources(base.Resources),
+    }
+    
+    value := reflect.ValueOf(entity).Elem()
+    fields := GetEntityDataFields(value.Type())
+    if len(fields) == 0 {
+        return st, nil
+    }
+    
+    data := reflect.New(GetEntityDataType(value.Type(), fields)).Elem()
+    for i, f := range fields {
+        data.Field(i).Set(value.Field(f))
+    }
+    
+    buffer := bytes.Buffer{}
+    if err := gob.NewEncoder(&buffer).Encode(data.Interface()); err != nil {
+        return st, fmt.Errorf("entity %s: %w", entity.GetName(), err)
+    }
+    st.Data = buffer.Bytes()
+    return st, nil
+}
+
+// NewEntityFromSnapshot creates an entity of the registered type of a
+// snapshot, without adding it to an environment.
+func NewEntityFromSnapshot(st EntitySnapshot) (Entity, error) {
+    structType, ok := GetEntityType(st.TypeName)
+    if !ok {
+        return nil, fmt.Errorf("entity type not registered: %s", st.TypeName)
+    }
+    
+    value := reflect.New(structType)
+    entity := value.Interface().(Entity)
+    base := entity.GetEntityBase()
+    base.Id = st.Id
+    base.Type = st.Type
+    base.DateCreated = st.DateCreated
+    base.WaitTime = st.WaitTime
+    base.ProcessTime = st.ProcessTime
+    base.TransferTime = st.TransferTime
+    base.Disposed = st.Disposed
+    base.Costs = st.Costs
+    base.Station = st.Station
+    base.QueueStats = CopyQueueStats(st.QueueStats)
+    base.ProcessStats = CopyProcessStats(st.ProcessStats)
+    base.Resources = CopyResources(st.Resources)
+    
+    fields := GetEntityDataFields(structType)
+    if len(fields) == 0 || len(st.Data) == 0 {
+        return entity, nil
+    }
+    
+    data := reflect.New(GetEntityDataType(structType, fields))
+    if err := gob.NewDecoder(bytes.NewReader(st.Data)).Decode(data.Interface()); err != nil {
+        return nil, fmt.Errorf("entity %s: %w", entity.GetName(), err)
+    }
+    
+    for i, f := range fields {
+        value.Elem().Field(f).Set(data.Elem().Field(i))
+    }
+    return entity, nil
+}
+
+// GetSource is implemented by RNGs whose state can be saved in snapshots.
+func (rng *RNGExponential) GetSource() rand.Source {return rng.Src}
+func (rng *RNGNormal) GetSource() rand.Source {return rng.Src}
+func (rng *RNGLogNormal) GetSource() rand.Source {return rng.Src}
+func (rng *RNGTriangular) GetSource() rand.Source {return rng.Src}
+func (rng *RNGDiscrete) GetSource() rand.Source {return rng.Src}
+
+type SourcedRNG interface {
+    RNG
+    GetSource() rand.Source
+}
+
+type EventSnapshot struct {
+    Date        float64
+    Type        string
+    Id          string
+    EntityId    int // -1 if none
+}
+
+type OngoingSnapshot struct {
+    Process     string
+    EntityId    int
+    DateStart   float64
+    DateEnd     float64
+}
+
+type SourceSnapshot struct {
+    Id          string
+    NextGen     float64
+    Generations int
+}
+
+type ProcessSnapshot struct {
+    Id          string
+    Queue       []int
+    QueueStats  QueueStatistics
+    AvgDuration float64
+    AccumDuration float64
+    TotalEntitiesOut int
+    Durations   Tally
+    TypeStats   map[string]ProcessTypeStatistics
+}
+
+type ResourceSnapshot struct {
+    Id          string
+    Amount      float64
+    Capacity    float64
+    Queue       []int
+    Busy        TimePersistent
+    TotalEntitiesIn int
+    TotalEntitiesOut int
+    TotalTimeInQueue float64
+    AvgTimeInQueue float64
+    Uses        int
+}
+
+type HoldSnapshot struct {
+    Id          string
+    Queue       []int
+    QueueStats  QueueStatistics
+}
+
+type TransportRequestSnapshot struct {
+    EntityId    int
+    Location    string
+    Then        string
+}
+
+type TransporterSnapshot struct {
+    Id          string
+    Vehicles    []Vehicle
+    Queue       []TransportRequestSnapshot
+    QueueStats  QueueStatistics
+}
+
+type ConveyorItemSnapshot struct {
+    EntityId    int
+    Size        float64
+    Position    float64
+    DateIn      float64
+}
+
+type ConveyorSnapshot struct {
+    Id              string
+    Queue           []int
+    Items           []ConveyorItemSnapshot
+    Blocked         bool
+    LastUpdate      float64
+    NextUpdate      float64
+    Waiting         []string
+    
+    QueueStats      QueueStatistics
+    TotalEntitiesOut int
+    TotalLoadOut    float64
+    AccumTransitTime float64
+    AvgTransitTime  float64
+    OccupiedTime    float64
+    BlockedTime     float64
+    BlockedSince    float64
+    Blockages       int
+    ResetDate       float64
+}
+
+// Snapshot is the state of an environment between two steps. Everything
+// that doesn't change while the model runs, like processes, handlers and
+// routing functions, is not part of it, and is rebuilt by the model before
+// restoring (see env.Restore).
+type Snapshot struct {
+    Now             float64
+    EndDate         float64
+    Replication     int
+    Seed            uint64
+    Seeded          bool
+    NextStream      int
+    NextEntityId    int
+    Variables       map[string]float64
+    ChangedKeys     []string
+    Watched         []string
+    
+    Entities        []EntitySnapshot
+    Events          []EventSnapshot
+    Ongoing         []OngoingSnapshot
+    Sources         []SourceSnapshot // in the order of env.EntitySources
+    Processes       []ProcessSnapshot
+    Resources       []ResourceSnapshot
+    Holds           []HoldSnapshot
+    Transporters    []TransporterSnapshot
+    Conveyors       []ConveyorSnapshot
+    Schedules       map[string]int // period of each resource schedule
+    Monitors        map[string][]MonitorSample
+    StatisticsStart float64
+    Counters        map[string]Counter
+    Tallies         map[string]Tally
+    EntityTypes     map[string]EntityTypeStatistics
+    Flows           map[string]map[string]int
+    
+    Rand            []byte
+    RNGs            [][]byte // in the order of env.RNGs
+}
+
+// The Copy functions copy the maps, slices and pointers of the state they
+// are given, so that a snapshot never shares them with the environments it
+// is taken from or set on, and each can go on running on its own.
+func CopyTally(tally Tally) Tally {
+    tally.Batches = slices.Clone(tally.Batches)
+    return tally
+}
+
+func CopyTimePersistent(st TimePersistent) TimePersistent {
+    st.Batches = slices.Clone(st.Batches)
+    return st
+}
+
+func CopyQueueStatistics(st QueueStatistics) QueueStatistics {
+    st.TimeInQueue = CopyTally(st.TimeInQueue)
+    st.QueueLength = CopyTimePersistent(st.QueueLength)
+    return st
+}
+
+func CopyProcessTypeStatistics(st ProcessTypeStatistics) ProcessTypeStatistics {
+    st.TimeInQueue = CopyTally(st.TimeInQueue)
+    st.Duration = CopyTally(st.Duration)
+    return st
+}
+
+func CopyEntityTypeStatistics(st EntityTypeStatistics) EntityTypeStatistics {
+    st.WIP = CopyTimePersistent(st.WIP)
+    st.WaitTime = CopyTally(st.WaitTime)
+    st.ProcessTime = CopyTally(st.ProcessTime)
+    st.TransferTime = CopyTally(st.TransferTime)
+    st.SystemTime = CopyTally(st.SystemTime)
+    st.EntityCost = CopyTally(st.EntityCost)
+    return st
+}
+
+func CopyVehicle(vehicle Vehicle) Vehicle {
+    vehicle.Loads = slices.Clone(vehicle.Loads)
+    return vehicle
+}
+
+func CopyQueueStats(stats []*QueueStats) []*QueueStats {
+    copied := make([]*QueueStats, len(stats))
+    for i, st := range stats {
+        queueStats := *st
+        copied[i] = &queueStats
+    }
+    return copied
+}
+
+func CopyProcessStats(stats []*ProcessStats) []*ProcessStats {
+    copied := make([]*ProcessStats, len(stats))
+    for i, st := range stats {
+        processStats := *st
+        copied[i] = &processStats
+    }
+    return copied
+}
+
+func CopyResources(resources map[string]float64) map[string]float64 {
+    copied := make(map[string]float64)
+    for rid, amount := range resources {
+        copied[rid] = amount
+    }
+    return copied
+}
+
+func CopyFlows(flows map[string]map[string]int) map[string]map[string]int {
+    copied := make(map[string]map[string]int)
+    for from, to := range flows {
+        copied[from] = make(map[string]int)
+        for station, n := range to {
+            copied[from][station] = n
+        }
+    }
+    return copied
+}
+
+func GetEntityIds(entities []Entity) []int {
+    ids := make([]int, len(entities))
+    for i, entity := range entities {
+        ids[i] = entity.GetId()
+    }
+    return ids
+}
+
+func GetSourceState(src rand.Source) ([]byte, error) {
+    marshaler, ok := src.(encoding.BinaryMarshaler)
+    if !ok {
+        return nil, fmt.Errorf("random source can't be saved: %T", src)
+    }
+    return marshaler.MarshalBinary()
+}
+
+func SetSourceState(src rand.Source, state []byte) error {
+    unmarshaler, ok := src.(encoding.BinaryUnmarshaler)
+    if !ok {
+        return fmt.Errorf("random source can't be restored: %T", src)
+    }
+    return unmarshaler.UnmarshalBinary(state)
+}
+
+// GetSnapshot returns the state of the environment. It must be called
+// between steps (env.Advance), not from inside handlers.
+func (env *Environment) GetSnapshot() (*Snapshot, error) {
+    snapshot := &Snapshot{
+        Now: env.Now,
+        EndDate: env.EndDate,
+        Replication: env.Replication,
+        Seed: env.Seed,
+        Seeded: env.Seeded,
+        NextStream: env.NextStream,
+        NextEntityId: env.NextEntityId,
+        Variables: make(map[string]float64),
+        Schedules: make(map[string]int),
+        Monitors: make(map[string][]MonitorSample),
+        StatisticsStart: env.StatisticsStart,
+        Counters: make(map[string]Counter),
+        Tallies: make(map[string]Tally),
+        EntityTypes: make(map[string]EntityTypeStatistics),
+    }
+    
+    for name, value := range env.Variables {
+        snapshot.Variables[name] = value
+    }
+    
+    for key, _ := range env.ChangedKeys {
+        snapshot.ChangedKeys = append(snapshot.ChangedKeys, key)
+    }
+    slices.Sort(snapshot.ChangedKeys)
+    
+    for pid, process := range env.WatchedProcesses {
+        if process != nil {
+            snapshot.Watched = append(snapshot.Watched, pid)
+        }
+    }
+    slices.Sort(snapshot.Watched)
+    
+    ids := make([]int, 0, len(env.Entities))
+    for id, _ := range env.Entities {
+        ids = append(ids, id)
+    }
+    slices.Sort(ids)
+    
+    for _, id := range ids {
+        st, err := GetEntitySnapshot(env.Entities[id])
+        if err != nil {
+            return nil, err
+        }
+        snapshot.Entities = append(snapshot.Entities, st)
+    }
+    
+    for _, event := range env.Events {
+        entityId := -1
+        if event.Entity != nil {
+            entityId = event.Entity.GetId()
+        }
+        snapshot.Events = append(snapshot.Events, EventSnapshot{Date: event.Date, Type: event.Type, Id: event.Id, EntityId: entityId})
+    }
+    
+    for _, ongoing := range env.OngoingProcesses {
+        snapshot.Ongoing = append(snapshot.Ongoing, OngoingSnapshot{Process: ongoing.Process.GetId(), EntityId: ongoing.Entity.GetId(), DateStart: ongoing.DateStart, DateEnd: ongoing.DateEnd})
+    }
+    
+    for _, source := range env.EntitySources {
+        base := source.GetEntitySourceBase()
+        snapshot.Sources = append(snapshot.Sources, SourceSnapshot{Id: base.Id, NextGen: base.NextGen, Generations: base.Generations})
+    }
+    
+    for _, process := range env.Processes {
+        base := process.GetProcessBase()
+        snapshot.Processes = append(snapshot.Processes, ProcessSnapshot{
+            Id: base.Id,
+            Queue: GetEntityIds(base.Queue),
+            QueueStats: CopyQueueStatistics(base.QueueStats),
+            AvgDuration: base.AvgDuration,
+            AccumDuration: base.AccumDuration,
+            TotalEntitiesOut: base.TotalEntitiesOut,
+            Durations: CopyTally(base.Durations),
+            TypeStats: make(map[string]ProcessTypeStatistics),
+        })
+        for entityType, st := range base.TypeStats {
+            snapshot.Processes[len(snapshot.Processes)-1].TypeStats[entityType] = CopyProcessTypeStatistics(*st)
+        }
+    }
+    
+    for rid, resource := range env.Resources {
+        base := resource.GetResourceBase()
+        snapshot.Resources = append(snapshot.Resources, ResourceSnapshot{
+            Id: rid,
+            Amount: base.Amount,
+            Capacity: base.Capacity,
+            Queue: GetEntityIds(base.Queue),
+            Busy: CopyTimePersistent(base.Busy),
+            TotalEntitiesIn: base.TotalEntitiesIn,
+            TotalEntitiesOut: base.TotalEntitiesOut,
+            TotalTimeInQueue: base.TotalTimeInQueue,
+            AvgTimeInQueue: base.AvgTimeInQueue,
+            Uses: base.Uses,
+        })
+    }
+    sort.Slice(snapshot.Resources, func(i, j int) bool { return snapshot.Resources[i].Id < snapshot.Resources[j].Id })
+    
+    for _, hold := range env.Holds {
+        snapshot.Holds = append(snapshot.Holds, HoldSnapshot{Id: hold.Id, Queue: GetEntityIds(hold.Queue), QueueStats: CopyQueueStatistics(hold.QueueStats)})
+    }
+    
+    for _, transporter := range env.Transporters {
+        st := TransporterSnapshot{Id: transporter.Id, QueueStats: CopyQueueStatistics(transporter.QueueStats)}
+        for _, vehicle := range transporter.Vehicles {
+            st.Vehicles = append(st.Vehicles, CopyVehicle(*vehicle))
+        }
+        for _, request := range transporter.Queue {
+            st.Queue = append(st.Queue, TransportRequestSnapshot{EntityId: request.Entity.GetId(), Location: request.Location, Then: request.Then})
+        }
+        snapshot.Transporters = append(snapshot.Transporters, st)
+    }
+    
+    for _, conveyor := range env.Conveyors {
+        st := ConveyorSnapshot{
+            Id: conveyor.Id,
+            Queue: GetEntityIds(conveyor.Queue),
+            Blocked: conveyor.Blocked,
+            LastUpdate: conveyor.LastUpdate,
+            NextUpdate: conveyor.NextUpdate,
+            QueueStats: CopyQueueStatistics(conveyor.QueueStats),
+            TotalEntitiesOut: conveyor.TotalEntitiesOut,
+            TotalLoadOut: conveyor.TotalLoadOut,
+            AccumTransitTime: conveyor.AccumTransitTime,
+            AvgTransitTime: conveyor.AvgTransitTime,
+            OccupiedTime: conveyor.OccupiedTime,
+            BlockedTime: conveyor.BlockedTime,
+            BlockedSince: conveyor.BlockedSince,
+            Blockages: conveyor.Blockages,
+            ResetDate: conveyor.ResetDate,
+        }
+        for _, item := range conveyor.Items {
+            st.Items = append(st.Items, ConveyorItemSnapshot{EntityId: item.Entity.GetId(), Size: item.Size, Position: item.Position, DateIn: item.DateIn})
+        }
+        for _, waiting := range conveyor.Waiting {
+            st.Waiting = append(st.Waiting, waiting.Id)
+        }
+        snapshot.Conveyors = append(snapshot.Conveyors, st)
+    }
+    
+    for rid, schedule := range env.ResourceSchedules {
+        snapshot.Schedules[rid] = schedule.Period
+    }
+    
+    for _, monitor := range env.Monitors {
+        snapshot.Monitors[monitor.Id] = slices.Clone(monitor.Samples)
+    }
+    
+    for id, counter := range env.Counters {
+        snapshot.Counters[id] = *counter
+    }
+    
+    for id, tally := range env.Tallies {
+        snapshot.Tallies[id] = CopyTally(*tally)
+    }
+    
+    for entityType, st := range env.EntityTypes {
+        snapshot.EntityTypes[entityType] = CopyEntityTypeStatistics(*st)
+    }
+    snapshot.Flows = CopyFlows(env.Flows)
+    
+    var err error
+    if snapshot.Rand, err = GetSourceState(env.RandSource); err != nil {
+        return nil, err
+    }
+    
+    for _, rng := range env.RNGs {
+        var state []byte
+        if sourced, ok := rng.(SourcedRNG); ok {
+            if state, err = GetSourceState(sourced.GetSource()); err != nil {
+                return nil, err
+            }
+        }
+        snapshot.RNGs = append(snapshot.RNGs, state)
+    }
+    
+    return snapshot, nil
+}
+
+// Snapshot writes the state of the environment (see GetSnapshot) with
+// encoding/gob. Entity types must be registered with RegisterEntity.
+func (env *Environment) Snapshot(w io.Writer) error {
+    snapshot, err := env.GetSnapshot()
+    if err != nil {
+        return err
+    }
+    
+    if err := gob.NewEncoder(w).Encode(snapshot); err != nil {
+        return fmt.Errorf("snapshot: %w", err)
+    }
+    return nil
+}
+
+func (env *Environment) SaveSnapshot(path string) error {
+    file, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    
+    writer := bufio.NewWriter(file)
+    if err := env.Snapshot(writer); err != nil {
+        file.Close()
+        return err
+    }
+    
+    if err := writer.Flush(); err != nil {
+        file.Close()
+        return err
+    }
+    return file.Close()
+}
+
+// Restore reads a snapshot written by env.Snapshot. The environment must
+// have been built by the same model that saved it, with the same
+// processes, resources, sources, holds, transporters, conveyors and RNGs;
+// running it afterwards continues the run where it was saved, with the
+// same trajectory.
+func (env *Environment) Restore(r io.Reader) error {
+    snapshot := &Snapshot{}
+    if err := gob.NewDecoder(bufio.NewReader(r)).Decode(snapshot); err != nil {
+        return fmt.Errorf("restore: %w", err)
+    }
+    return env.SetSnapshot(snapshot)
+}
+
+func (env *Environment) RestoreFile(path string) error {
+    file, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    return env.Restore(file)
+}
+
+// SetSnapshot sets the state of the environment to a snapshot (see
+// env.Restore).
+func (env *Environment) SetSnapshot(snapshot *Snapshot) error {
+    if len(snapshot.RNGs) != len(env.RNGs) {
+        return fmt.Errorf("restore: snapshot has %d RNGs, model has %d", len(snapshot.RNGs), len(env.RNGs))
+    }
+    
+    env.Now = snapshot.Now
+    env.EndDate = snapshot.EndDate
+    env.Replication = snapshot.Replication
+    env.Seed = snapshot.Seed
+    env.Seeded = snapshot.Seeded
+    env.NextStream = snapshot.NextStream
+    env.NextEntityId = snapshot.NextEntityId
+    env.Restored = true
+    
+    env.Variables = make(map[string]float64)
+    for name, value := range snapshot.Variables {
+        env.Variables[name] = value
+    }
+    
+    env.ChangedKeys = make(map[string]bool)
+    for _, key := range snapshot.ChangedKeys {
+        env.ChangedKeys[key] = true
+    }
+    
+    env.Entities = make(map[int]Entity)
+    for _, st := range snapshot.Entities {
+        entity, err := NewEntityFromSnapshot(st)
+        if err != nil {
+            return fmt.Errorf("restore: %w", err)
+        }
+        entity.GetEntityBase().Environment = env
+        env.Entities[entity.GetId()] = entity
+    }
+    
+    getEntity := func (id int) (Entity, error) {
+        entity, ok := env.Entities[id]
+        if !ok {
+            return nil, fmt.Errorf("restore: entity not found: %d", id)
+        }
+        return entity, nil
+    }
+    
+    getEntities := func (ids []int) ([]Entity, error) {
+        entities := make([]Entity, len(ids))
+        for i, id := range ids {
+            entity, err := getEntity(id)
+            if err != nil {
+                return nil, err
+            }
+            entities[i] = entity
+        }
+        return entities, nil
+    }
+    
+    getProcess := func (pid string) (Process, error) {
+        process := env.GetProcess(pid)
+        if process == nil {
+            return nil, fmt.Errorf("restore: process not found: %s", pid)
+        }
+        return process, nil
+    }
+    
+    env.Events = make([]Event, 0, len(snapshot.Events))
+    for _, st := range snapshot.Events {
+        event := Event{Date: st.Date, Type: st.Type, Id: st.Id}
+        if st.EntityId >= 0 {
+            entity, err := getEntity(st.EntityId)
+            if err != nil {
+                return err
+            }
+            event.Entity = entity
+        }
+        
+        if _, ok := env.EventHandlers[event.Type]; !ok {
+            return fmt.Errorf("restore: event handler not found: %s", event.Type)
+        }
+        env.Events = append(env.Events, event)
+    }
+    
+    env.OngoingProcesses = make([]OngoingProcess, 0, len(snapshot.Ongoing))
+    for _, st := range snapshot.Ongoing {
+        process, err := getProcess(st.Process)
+        if err != nil {
+            return err
+        }
+        
+        entity, err := getEntity(st.EntityId)
+        if err != nil {
+            return err
+        }
+        env.OngoingProcesses = append(env.OngoingProcesses, OngoingProcess{Process: process, Entity: entity, DateStart: st.DateStart, DateEnd: st.DateEnd})
+    }
+    
+    // sources that ended are removed
+    sources := make(map[string]EntitySource)
+    for _, source := range env.EntitySources {
+        sources[source.GetId()] = source
+    }
+    
+    env.EntitySources = make([]EntitySource, 0, len(snapshot.Sources))
+    for _, st := range snapshot.Sources {
+        source, ok := sources[st.Id]
+        if !ok {
+            return fmt.Errorf("restore: entity source not found: %s", st.Id)
+        }
+        source.GetEntitySourceBase().NextGen = st.NextGen
+        source.GetEntitySourceBase().Generations = st.Generations
+        env.EntitySources = append(env.EntitySources, source)
+    }
+    
+    for _, st := range snapshot.Processes {
+        process, err := getProcess(st.Id)
+        if err != nil {
+            return err
+        }
+        
+        base := process.GetProcessBase()
+        if base.Queue, err = getEntities(st.Queue); err != nil {
+            return err
+        }
+        base.QueueStats = CopyQueueStatistics(st.QueueStats)
+        base.AvgDuration = st.AvgDuration
+        base.AccumDuration = st.AccumDuration
+        base.TotalEntitiesOut = st.TotalEntitiesOut
+        base.Durations = CopyTally(st.Durations)
+        base.TypeStats = make(map[string]*ProcessTypeStatistics)
+        for entityType, typeStats := range st.TypeStats {
+            copied := CopyProcessTypeStatistics(typeStats)
+            base.TypeStats[entityType] = &copied
+        }
+    }
+    
+    env.WatchedProcesses = make(map[string]Process)
+    for _, pid := range snapshot.Watched {
+        process, err := getProcess(pid)
+        if err != nil {
+            return err
+        }
+        env.WatchedProcesses[pid] = process
+    }
+    
+    for _, st := range snapshot.Resources {
+        resource, ok := env.Resources[st.Id]
+        if !ok {
+            return fmt.Errorf("restore: resource not found: %s", st.Id)
+        }
+        
+        var err error
+        base := resource.GetResourceBase()
+        if base.Queue, err = getEntities(st.Queue); err != nil {
+            return err
+        }
+        base.Amount = st.Amount
+        base.Capacity = st.Capacity
+        base.Busy = CopyTimePersistent(st.Busy)
+        base.TotalEntitiesIn = st.TotalEntitiesIn
+        base.TotalEntitiesOut = st.TotalEntitiesOut
+        base.TotalTimeInQueue = st.TotalTimeInQueue
+        base.AvgTimeInQueue = st.AvgTimeInQueue
+        base.Uses = st.Uses
+    }
+    
+    for _, st := range snapshot.Holds {
+        hold := env.GetHold(st.Id)
+        if hold == nil {
+            return fmt.Errorf("restore: hold not found: %s", st.Id)
+        }
+        
+        var err error
+        if hold.Queue, err = getEntities(st.Queue); err != nil {
+            return err
+        }
+        hold.QueueStats = CopyQueueStatistics(st.QueueStats)
+    }
+    
+    for _, st := range snapshot.Transporters {
+        transporter := env.GetTransporter(st.Id)
+        if transporter == nil {
+            return fmt.Errorf("restore: transporter not found: %s", st.Id)
+        }
+        transporter.QueueStats = CopyQueueStatistics(st.QueueStats)
+        
+        transporter.Vehicles = make([]*Vehicle, len(st.Vehicles))
+        for i, vehicle := range st.Vehicles {
+            copied := CopyVehicle(vehicle)
+            transporter.Vehicles[i] = &copied
+        }
+        
+        transporter.Queue = make([]TransportRequest, 0, len(st.Queue))
+        for _, request := range st.Queue {
+            entity, err := getEntity(request.EntityId)
+            if err != nil {
+                return err
+            }
+            transporter.Queue = append(transporter.Queue, TransportRequest{Entity: entity, Location: request.Location, Then: request.Then})
+        }
+    }
+    
+    for _, st := range snapshot.Conveyors {
+        conveyor := env.GetConveyor(st.Id)
+        if conveyor == nil {
+            return fmt.Errorf("restore: conveyor not found: %s", st.Id)
+        }
+        
+        var err error
+        if conveyor.Queue, err = getEntities(st.Queue); err != nil {
+            return err
+        }
+        
+        conveyor.Items = make([]*ConveyorItem, 0, len(st.Items))
+        for _, item := range st.Items {
+            entity, err := getEntity(item.EntityId)
+            if err != nil {
+                return err
+            }
+            conveyor.Items = append(conveyor.Items, &ConveyorItem{Entity: entity, Size: item.Size, Position: item.Position, DateIn: item.DateIn})
+        }
+        
+        conveyor.Waiting = nil
+        for _, cid := range st.Waiting {
+            waiting := env.GetConveyor(cid)
+            if waiting == nil {
+                return fmt.Errorf("restore: conveyor not found: %s", cid)
+            }
+            conveyor.Waiting = append(conveyor.Waiting, waiting)
+        }
+        
+        conveyor.Blocked = st.Blocked
+        conveyor.LastUpdate = st.LastUpdate
+        conveyor.NextUpdate = st.NextUpdate
+        conveyor.QueueStats = CopyQueueStatistics(st.QueueStats)
+        conveyor.TotalEntitiesOut = st.TotalEntitiesOut
+        conveyor.TotalLoadOut = st.TotalLoadOut
+        conveyor.AccumTransitTime = st.AccumTransitTime
+        conveyor.AvgTransitTime = st.AvgTransitTime
+        conveyor.OccupiedTime = st.OccupiedTime
+        conveyor.BlockedTime = st.BlockedTime
+        conveyor.BlockedSince = st.BlockedSince
+        conveyor.Blockages = st.Blockages
+        conveyor.ResetDate = st.ResetDate
+    }
+    
+    for rid, period := range snapshot.Schedules {
+        schedule, ok := env.ResourceSchedules[rid]
+        if !ok {
+            return fmt.Errorf("restore: resource schedule not found: %s", rid)
+        }
+        schedule.Period = period
+    }
+    
+    for id, samples := range snapshot.Monitors {
+        monitor := env.GetMonitor(id)
+        if monitor == nil {
+            return fmt.Errorf("restore: monitor not found: %s", id)
+        }
+        monitor.Samples = slices.Clone(samples)
+    }
+    
+    env.StatisticsStart = snapshot.StatisticsStart
+    env.Counters = make(map[string]*Counter)
+    for id, st := range snapshot.Counters {
+        counter := st
+        env.Counters[id] = &counter
+    }
+    
+    env.Tallies = make(map[string]*Tally)
+    for id, st := range snapshot.Tallies {
+        tally := CopyTally(st)
+        env.Tallies[id] = &tally
+    }
+    
+    env.EntityTypes = make(map[string]*EntityTypeStatistics)
+    for entityType, st := range snapshot.EntityTypes {
+        copied := CopyEntityTypeStatistics(st)
+        env.EntityTypes[entityType] = &copied
+    }
+    
+    env.Flows = CopyFlows(snapshot.Flows)
+    
+    if err := SetSourceState(env.RandSource, snapshot.Rand); err != nil {
+        return err
+    }
+    
+    for i, rng := range env.RNGs {
+        if sourced, ok := rng.(SourcedRNG); ok {
+            if err := SetSourceState(sourced.GetSource(), snapshot.RNGs[i]); err != nil {
+                return err
+            }
+        }
+    }
+    
+    return nil
+}
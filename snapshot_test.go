@@ -0,0 +1,145 @@
+package sim
+
+import (
+    "bytes"
+    "testing"
+)
+
+type TestTruck struct {
+    EntityBase
+    Load        float64
+}
+
+type TestTruckSource struct {
+    EntitySourceBase
+}
+
+func (source *TestTruckSource) Generate() Entity {
+    env := source.GetEnvironment()
+    truck := &TestTruck{Load: float64(env.NextEntityId % 3)}
+    env.AddEntity("Truck", truck)
+    env.ForwardTo(truck, "Weigh")
+    return truck
+}
+
+// BuildTerminal weighs trucks at a scale, sends the loaded ones along a
+// belt and carts them to the yard, where they are unloaded.
+func BuildTerminal(env *Environment) {
+    env.AddEntitySource(&TestTruckSource{EntitySourceBase{Id: "Trucks", RNG: NewRNGExponential(1/60.0)}})
+    env.AddResource(&ResourceBase{Id: "Scale", Amount: 1})
+    env.AddProcess(ProcessBase{Id: "Weigh", Needs: map[string]float64{"Scale": 1}, RNG: NewRNGExponential(1/50.0), Forward: func (entity Entity) {
+        if Cast[*TestTruck](entity).Load > 0 {
+            env.ForwardTo(entity, "Belt")
+        } else {
+            env.Dispose(entity)
+        }
+    }})
+    env.AddConveyor(ConveyorBase{Id: "Belt", Length: 20, Speed: 1, CellSize: 2, Forward: func (entity Entity) {
+        env.RequestTransporter(entity, "Cart", "Dock", "Load")
+    }})
+    env.AddTransporter(TransporterBase{Id: "Cart", Home: "Yard", Speed: 1, NumVehicles: 2, Distances: map[string]map[string]float64{
+        "Yard": {"Dock": 30},
+    }})
+    env.AddProcess(ProcessBase{Id: "Load", RNG: NewRNGExponential(1/10.0), Forward: func (entity Entity) {
+        env.TransportTo(entity, "Yard", "Unload")
+    }})
+    env.AddProcess(ProcessBase{Id: "Unload", RNG: &RNGConstant{Value: 5}, Forward: func (entity Entity) {
+        env.FreeTransporter(entity)
+        env.Dispose(entity)
+    }})
+}
+
+func NewTerminal() *Environment {
+    env := NewEnvironment()
+    env.SetSeed(1)
+    env.EndDate = Hours(8)
+    BuildTerminal(env)
+    return env
+}
+
+// A run saved and restored halfway ends with the same results as a run
+// that was never interrupted.
+func TestSnapshotRestore(t *testing.T) {
+    RegisterEntity("sim.TestTruck", &TestTruck{})
+    
+    env := NewTerminal()
+    env.Run()
+    want := env.GetResults()
+    
+    for _, date := range []float64{Hours(1), Hours(3), Hours(7)} {
+        env = NewTerminal()
+        env.Begin()
+        for env.Now < date && env.Advance() {}
+        
+        for _, entity := range env.Entities {
+            if entity.GetEntityBase().Disposed {
+                t.Errorf("disposed entity in the environment: %s", entity.GetName())
+            }
+        }
+        
+        var buf bytes.Buffer
+        if err := env.Snapshot(&buf); err != nil {
+            t.Fatal(err)
+        }
+        
+        env = NewTerminal()
+        if err := env.Restore(&buf); err != nil {
+            t.Fatal(err)
+        }
+        env.Run()
+        got := env.GetResults()
+        
+        if len(got.Values) != len(want.Values) {
+            t.Fatalf("restored at %g: got %d results, want %d", date, len(got.Values), len(want.Values))
+        }
+        for key, value := range want.Values {
+            if got.Values[key] != value {
+                t.Errorf("restored at %g: %s: got %v, want %v", date, key, got.Values[key], value)
+            }
+        }
+    }
+}
+
+// Environments set on the same snapshot, and the one it was taken from,
+// run on their own and end with the same results.
+func TestSnapshotBranch(t *testing.T) {
+    RegisterEntity("sim.TestTruck", &TestTruck{})
+    
+    env := NewTerminal()
+    env.Run()
+    want := env.GetResults()
+    
+    env = NewTerminal()
+    env.Begin()
+    for env.Now < Hours(3) && env.Advance() {}
+    snapshot, err := env.GetSnapshot()
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    branches := []*Environment{NewTerminal(), NewTerminal()}
+    for _, branch := range branches {
+        if err := branch.SetSnapshot(snapshot); err != nil {
+            t.Fatal(err)
+        }
+    }
+    
+    // the original run goes on first, then each branch in turn
+    for env.Advance() {}
+    results := []*Results{env.GetResults()}
+    for _, branch := range branches {
+        branch.Run()
+        results = append(results, branch.GetResults())
+    }
+    
+    for i, got := range results {
+        if len(got.Values) != len(want.Values) {
+            t.Fatalf("run %d: got %d results, want %d", i, len(got.Values), len(want.Values))
+        }
+        for key, value := range want.Values {
+            if got.Values[key] != value {
+                t.Errorf("run %d: %s: got %v, want %v", i, key, got.Values[key], value)
+            }
+        }
+    }
+}
@@ -0,0 +1,288 @@
+package sim
+
+import (
+    "math"
+)
+
+// Statistics keep a bounded number of batches of their observations, so
+// that batch means can be computed over runs of any length. When they
+// reach 2*MaxBatches, pairs of adjacent batches are merged and the batch
+// size doubles.
+const MaxBatches = 320
+
+// Batched is implemented by statistics that can be split into batch means.
+type Batched interface {
+    GetBatchMeans(n int) []float64
+}
+
+// Tally is an observation-based statistic, like the time each entity
+// spends in a queue.
+type Tally struct {
+    Count       int
+    Mean        float64
+    M2          float64
+    Min         float64
+    Max         float64
+    
+    Batches     []float64
+    BatchSize   int
+    BatchSum    float64
+    BatchCount  int
+}
+
+func (tally *Tally) Record(x float64) {
+    if tally.Count == 0 {
+        tally.Min = x
+        tally.Max = x
+    } else {
+        tally.Min = min(tally.Min, x)
+        tally.Max = max(tally.Max, x)
+    }
+    
+    tally.Count++
+    delta := x - tally.Mean
+    tally.Mean += delta / float64(tally.Count)
+    tally.M2 += delta * (x - tally.Mean)
+    
+    if tally.BatchSize == 0 {
+        tally.BatchSize = 1
+    }
+    
+    tally.BatchSum += x
+    tally.BatchCount++
+    
+    if tally.BatchCount == tally.BatchSize {
+        tally.Batches = append(tally.Batches, tally.BatchSum)
+        tally.BatchSum = 0
+        tally.BatchCount = 0
+        
+        if len(tally.Batches) == 2*MaxBatches {
+            tally.Batches = MergeBatches(tally.Batches)
+            tally.BatchSize *= 2
+        }
+    }
+}
+
+// Merge adds the observations of other to the tally, as if they had been
+// recorded in it. Batches are not merged.
+func (tally *Tally) Merge(other *Tally) {
+    if other.Count == 0 {
+        return
+    }
+    
+    if tally.Count == 0 {
+        tally.Min = other.Min
+        tally.Max = other.Max
+    } else {
+        tally.Min = min(tally.Min, other.Min)
+        tally.Max = max(tally.Max, other.Max)
+    }
+    
+    count := tally.Count + other.Count
+    delta := other.Mean - tally.Mean
+    tally.M2 += other.M2 + delta * delta * float64(tally.Count) * float64(other.Count) / float64(count)
+    tally.Mean += delta * float64(other.Count) / float64(count)
+    tally.Count = count
+}
+
+func (tally *Tally) GetMean() float64 {
+    return tally.Mean
+}
+
+func (tally *Tally) GetStdDev() float64 {
+    if tally.Count < 2 {
+        return 0
+    }
+    return math.Sqrt(tally.M2 / float64(tally.Count-1))
+}
+
+func (tally *Tally) GetSum() float64 {
+    return tally.Mean * float64(tally.Count)
+}
+
+// GetBatchMeans splits the observations recorded so far into n batches of
+// the same size and returns their means. The most recent observations that
+// don't fill a batch are left out. Returns nil if there are less than n
+// batches.
+func (tally *Tally) GetBatchMeans(n int) []float64 {
+    if n <= 0 || len(tally.Batches) < n {
+        return nil
+    }
+    
+    m := len(tally.Batches) / n
+    means := make([]float64, n)
+    
+    for i := 0; i < n; i++ {
+        sum := 0.0
+        for _, batch := range tally.Batches[i*m:(i+1)*m] {
+            sum += batch
+        }
+        means[i] = sum / float64(m*tally.BatchSize)
+    }
+    
+    return means
+}
+
+func (tally *Tally) Reset() {
+    *tally = Tally{}
+}
+
+// TimePersistent is a statistic weighted by how long each value lasts,
+// like the length of a queue or the number of busy units of a resource.
+// The zero value is 0 from date 0, unless it is updated at date 0, so
+// statistics of values that start elsewhere, like the level of a full
+// tank, don't report a minimum of 0.
+type TimePersistent struct {
+    Value       float64
+    StartDate   float64
+    LastDate    float64
+    Area        float64
+    AreaSq      float64
+    Min         float64
+    Max         float64
+    Initialized bool // Min and Max include Value
+    
+    Batches     []float64
+    BatchWidth  float64
+    BatchArea   float64
+}
+
+// Update sets the value of the statistic from date on.
+func (st *TimePersistent) Update(date float64, value float64) {
+    st.Integrate(date)
+    if !st.Initialized && date <= st.StartDate {
+        // the initial value never lasted
+        st.Min = value
+        st.Max = value
+    } else {
+        st.Min = min(st.Min, value)
+        st.Max = max(st.Max, value)
+    }
+    st.Value = value
+    st.Initialized = true
+}
+
+// Integrate accumulates the current value up to date.
+func (st *TimePersistent) Integrate(date float64) {
+    if st.BatchWidth == 0 {
+        st.BatchWidth = 1
+    }
+    
+    for st.LastDate < date {
+        batchEnd := st.StartDate + float64(len(st.Batches)+1) * st.BatchWidth
+        to := min(date, batchEnd)
+        dt := to - st.LastDate
+        
+        st.Area += st.Value * dt
+        st.AreaSq += st.Value * st.Value * dt
+        st.BatchArea += st.Value * dt
+        st.LastDate = to
+        
+        if to == batchEnd {
+            st.Batches = append(st.Batches, st.BatchArea)
+            st.BatchArea = 0
+            
+            if len(st.Batches) == 2*MaxBatches {
+                st.Batches = MergeBatches(st.Batches)
+                st.BatchWidth *= 2
+            }
+        }
+    }
+}
+
+func (st *TimePersistent) GetMean(now float64) float64 {
+    duration := now - st.StartDate
+    if duration <= 0 {
+        return st.Value
+    }
+    return (st.Area + st.Value * (now - st.LastDate)) / duration
+}
+
+func (st *TimePersistent) GetStdDev(now float64) float64 {
+    duration := now - st.StartDate
+    if duration <= 0 {
+        return 0
+    }
+    
+    mean := st.GetMean(now)
+    meanSq := (st.AreaSq + st.Value * st.Value * (now - st.LastDate)) / duration
+    return math.Sqrt(max(0, meanSq - mean*mean))
+}
+
+// GetBatchMeans splits the time integrated so far into n intervals of the
+// same length and returns the average value in each of them. Returns nil
+// if there are less than n batches.
+func (st *TimePersistent) GetBatchMeans(n int) []float64 {
+    if n <= 0 || len(st.Batches) < n {
+        return nil
+    }
+    
+    m := len(st.Batches) / n
+    means := make([]float64, n)
+    
+    for i := 0; i < n; i++ {
+        area := 0.0
+        for _, batch := range st.Batches[i*m:(i+1)*m] {
+            area += batch
+        }
+        means[i] = area / (float64(m) * st.BatchWidth)
+    }
+    
+    return means
+}
+
+// Reset clears the statistic, keeping its current value, as if it had
+// started at date.
+func (st *TimePersistent) Reset(date float64) {
+    *st = TimePersistent{Value: st.Value, StartDate: date, LastDate: date, Min: st.Value, Max: st.Value, Initialized: true}
+}
+
+// Counter is a statistic that adds up quantities, like tons exported, and
+// counts how many were added.
+type Counter struct {
+    Value       float64
+    Count       int
+}
+
+func (counter *Counter) Add(quantity float64) {
+    counter.Value += quantity
+    counter.Count++
+}
+
+func (counter *Counter) Reset() {
+    *counter = Counter{}
+}
+
+func MergeBatches(batches []float64) []float64 {
+    merged := batches[:len(batches)/2]
+    for i := 0; i < len(merged); i++ {
+        merged[i] = batches[2*i] + batches[2*i+1]
+    }
+    return merged
+}
+
+// RecordIn updates the statistics of a queue after an entity enters it.
+func (st *QueueStatistics) RecordIn(date float64, size int) {
+    st.TotalEntitiesIn++
+    st.QueueLength.Update(date, float64(size))
+}
+
+// Reset clears the statistics of a queue as if it had started at date,
+// keeping its current length.
+func (st *QueueStatistics) Reset(date float64) {
+    st.TotalEntitiesIn = 0
+    st.TotalEntitiesOut = 0
+    st.TotalTimeInQueue = 0
+    st.AvgTimeInQueue = 0
+    st.TimeInQueue.Reset()
+    st.QueueLength.Reset(date)
+}
+
+// RecordOut updates the statistics of a queue after an entity leaves it.
+func (st *QueueStatistics) RecordOut(date float64, size int, timeInQueue float64) {
+    st.TotalEntitiesOut++
+    st.TotalTimeInQueue += timeInQueue
+    st.AvgTimeInQueue = st.TotalTimeInQueue / float64(st.TotalEntitiesOut)
+    st.TimeInQueue.Record(timeInQueue)
+    st.QueueLength.Update(date, float64(size))
+}
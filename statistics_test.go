@@ -0,0 +1,273 @@
+package sim
+
+import (
+    "math"
+    "math/rand"
+    "slices"
+    "testing"
+    "gonum.org/v1/gonum/stat"
+)
+
+func IsClose(a float64, b float64) bool {
+    return math.Abs(a - b) <= 1e-9 * max(1, math.Abs(a), math.Abs(b))
+}
+
+func GetRandomSamples(n int, seed int64) []float64 {
+    r := rand.New(rand.NewSource(seed))
+    x := make([]float64, n)
+    for i := range x {
+        x[i] = r.ExpFloat64() * 10
+    }
+    return x
+}
+
+func TestTally(t *testing.T) {
+    tests := []struct {
+        name    string
+        x       []float64
+    }{
+        {"one", []float64{3}},
+        {"two", []float64{3, 5}},
+        {"constant", []float64{2, 2, 2, 2}},
+        {"negative", []float64{-1, 4, -7, 0, 2.5}},
+        {"exponential", GetRandomSamples(10000, 1)},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            var tally Tally
+            for _, x := range test.x {
+                tally.Record(x)
+            }
+            
+            mean, stdDev := stat.MeanStdDev(test.x, nil)
+            if len(test.x) < 2 {
+                stdDev = 0
+            }
+            
+            if tally.Count != len(test.x) {
+                t.Errorf("count: got %d, want %d", tally.Count, len(test.x))
+            }
+            if !IsClose(tally.GetMean(), mean) {
+                t.Errorf("mean: got %g, want %g", tally.GetMean(), mean)
+            }
+            if !IsClose(tally.GetStdDev(), stdDev) {
+                t.Errorf("std dev: got %g, want %g", tally.GetStdDev(), stdDev)
+            }
+            if tally.Min != slices.Min(test.x) || tally.Max != slices.Max(test.x) {
+                t.Errorf("bounds: got [%g, %g], want [%g, %g]", tally.Min, tally.Max, slices.Min(test.x), slices.Max(test.x))
+            }
+        })
+    }
+}
+
+func TestTallyMerge(t *testing.T) {
+    x := GetRandomSamples(1000, 2)
+    
+    tests := []struct {
+        name    string
+        split   int
+    }{
+        {"empty left", 0},
+        {"empty right", len(x)},
+        {"one left", 1},
+        {"half", len(x)/2},
+        {"uneven", 137},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            var all, left, right Tally
+            for i, v := range x {
+                all.Record(v)
+                if i < test.split {
+                    left.Record(v)
+                } else {
+                    right.Record(v)
+                }
+            }
+            
+            left.Merge(&right)
+            
+            if left.Count != all.Count {
+                t.Errorf("count: got %d, want %d", left.Count, all.Count)
+            }
+            if !IsClose(left.GetMean(), all.GetMean()) {
+                t.Errorf("mean: got %g, want %g", left.GetMean(), all.GetMean())
+            }
+            if !IsClose(left.GetStdDev(), all.GetStdDev()) {
+                t.Errorf("std dev: got %g, want %g", left.GetStdDev(), all.GetStdDev())
+            }
+            if left.Min != all.Min || left.Max != all.Max {
+                t.Errorf("bounds: got [%g, %g], want [%g, %g]", left.Min, left.Max, all.Min, all.Max)
+            }
+        })
+    }
+}
+
+func TestTallyBatchMeans(t *testing.T) {
+    tests := []struct {
+        name    string
+        count   int
+        n       int
+    }{
+        {"few", 40, 10},
+        {"not enough", 9, 10},
+        {"merged batches", 1000, 10},
+        {"merged twice", 3000, 20},
+        {"leftover", 1003, 7},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            x := GetRandomSamples(test.count, 3)
+            var tally Tally
+            for _, v := range x {
+                tally.Record(v)
+            }
+            
+            means := tally.GetBatchMeans(test.n)
+            if test.count < test.n {
+                if means != nil {
+                    t.Fatalf("got %d batch means, want none", len(means))
+                }
+                return
+            }
+            
+            if len(means) != test.n {
+                t.Fatalf("got %d batch means, want %d", len(means), test.n)
+            }
+            
+            // each batch mean is the mean of consecutive observations
+            size := len(tally.Batches) / test.n * tally.BatchSize
+            for i, mean := range means {
+                want := stat.Mean(x[i*size:(i+1)*size], nil)
+                if !IsClose(mean, want) {
+                    t.Errorf("batch %d: got %g, want %g", i, mean, want)
+                }
+            }
+        })
+    }
+}
+
+type Step struct {
+    Date    float64
+    Value   float64
+}
+
+func TestTimePersistent(t *testing.T) {
+    tests := []struct {
+        name    string
+        steps   []Step
+        now     float64
+        min     float64
+        max     float64
+    }{
+        {"queue", []Step{{1, 1}, {3, 2}, {4, 1}, {8, 0}}, 10, 0, 2},
+        {"starts full", []Step{{0, 500}, {10, 300}, {25, 450}}, 40, 300, 500},
+        {"starts empty", []Step{{5, 500}, {10, 300}}, 20, 0, 500},
+        {"simultaneous", []Step{{0, 4}, {2, 5}, {2, 3}, {6, 4}}, 10, 3, 5},
+        {"constant", []Step{{0, 7}}, 10, 7, 7},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            var st TimePersistent
+            for _, step := range test.steps {
+                st.Update(step.Date, step.Value)
+            }
+            
+            // the values, weighted by how long they lasted
+            values := make([]float64, 0)
+            weights := make([]float64, 0)
+            date, value := 0.0, 0.0
+            for _, step := range append(test.steps, Step{test.now, 0}) {
+                if step.Date > date {
+                    values = append(values, value)
+                    weights = append(weights, step.Date - date)
+                }
+                date, value = step.Date, step.Value
+            }
+            mean, stdDev := stat.PopMeanStdDev(values, weights)
+            
+            if !IsClose(st.GetMean(test.now), mean) {
+                t.Errorf("mean: got %g, want %g", st.GetMean(test.now), mean)
+            }
+            if !IsClose(st.GetStdDev(test.now), stdDev) {
+                t.Errorf("std dev: got %g, want %g", st.GetStdDev(test.now), stdDev)
+            }
+            if st.Min != test.min || st.Max != test.max {
+                t.Errorf("bounds: got [%g, %g], want [%g, %g]", st.Min, st.Max, test.min, test.max)
+            }
+        })
+    }
+}
+
+func TestTimePersistentReset(t *testing.T) {
+    var st TimePersistent
+    st.Update(0, 10)
+    st.Update(5, 2)
+    st.Reset(8)
+    st.Update(10, 6)
+    
+    // 2 from 8 to 10 and 6 from 10 to 12
+    if !IsClose(st.GetMean(12), 4) {
+        t.Errorf("mean: got %g, want 4", st.GetMean(12))
+    }
+    if st.Min != 2 || st.Max != 6 {
+        t.Errorf("bounds: got [%g, %g], want [2, 6]", st.Min, st.Max)
+    }
+}
+
+func TestTimePersistentBatchMeans(t *testing.T) {
+    tests := []struct {
+        name    string
+        end     float64
+        n       int
+    }{
+        {"few", 100, 10},
+        {"not enough", 5, 10},
+        {"merged batches", 1000, 10},
+        {"merged twice", 3000, 20},
+    }
+    
+    // the value is i from i*step to (i+1)*step
+    step := 0.7
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            var st TimePersistent
+            for i := 0; float64(i)*step < test.end; i++ {
+                st.Update(float64(i)*step, float64(i))
+            }
+            st.Integrate(test.end)
+            
+            means := st.GetBatchMeans(test.n)
+            if test.end < float64(test.n) {
+                if means != nil {
+                    t.Fatalf("got %d batch means, want none", len(means))
+                }
+                return
+            }
+            
+            if len(means) != test.n {
+                t.Fatalf("got %d batch means, want %d", len(means), test.n)
+            }
+            
+            width := float64(len(st.Batches) / test.n) * st.BatchWidth
+            for b, mean := range means {
+                from, to := float64(b)*width, float64(b+1)*width
+                area := 0.0
+                for i := 0; float64(i)*step < to; i++ {
+                    overlap := min(to, float64(i+1)*step) - max(from, float64(i)*step)
+                    if overlap > 0 {
+                        area += float64(i) * overlap
+                    }
+                }
+                if !IsClose(mean, area/width) {
+                    t.Errorf("batch %d: got %g, want %g", b, mean, area/width)
+                }
+            }
+        })
+    }
+}
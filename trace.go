@@ -0,0 +1,298 @@
+package sim
+
+import (
+    "bufio"
+    "encoding/json"
+    "io"
+    "os"
+    "slices"
+    "sort"
+)
+
+const (
+    TraceType_Create    string = "Create"
+    TraceType_Enqueue   string = "Enqueue"
+    TraceType_Start     string = "Start"
+    TraceType_End       string = "End"
+    TraceType_Dispose   string = "Dispose"
+    TraceType_Hold      string = "Hold"
+    TraceType_Release   string = "Release"
+    TraceType_Convey    string = "Convey"    // queued at the entrance of a conveyor
+    TraceType_Board     string = "Board"     // got on the belt
+    TraceType_Exit      string = "Exit"      // got off the belt
+    TraceType_Request   string = "Request"   // queued for a vehicle
+    TraceType_Allocate  string = "Allocate"  // a vehicle is coming
+    TraceType_Transport string = "Transport" // riding the vehicle
+    TraceType_Resource  string = "Resource"
+    TraceType_Event     string = "Event"
+)
+
+// StationTraceTypes are the types of records of entities in holds,
+// conveyors and transporters, which are given by Id instead of Process.
+var StationTraceTypes = []string{
+    TraceType_Hold, TraceType_Release,
+    TraceType_Convey, TraceType_Board, TraceType_Exit,
+    TraceType_Request, TraceType_Allocate, TraceType_Transport,
+}
+
+// TraceRecord is a line of an event trace. Queue is the length of the queue
+// of Process (or of the hold, conveyor or transporter Id) after the record,
+// and Amount and Capacity are the levels of Resource.
+type TraceRecord struct {
+    Date        float64 `json:"t"`
+    Type        string  `json:"type"`
+    Entity      string  `json:"entity,omitempty"`
+    Process     string  `json:"process,omitempty"`
+    Resource    string  `json:"resource,omitempty"`
+    Event       string  `json:"event,omitempty"`
+    Id          string  `json:"id,omitempty"`
+    Queue       int     `json:"queue,omitempty"`
+    Amount      float64 `json:"amount,omitempty"`
+    Capacity    float64 `json:"capacity,omitempty"`
+}
+
+// TraceFilter selects records by entity, by process (or station) and by a
+// time window. Empty lists match everything and a To of 0 has no limit.
+// Records without an entity or process, like resource levels, are only
+// filtered by time.
+type TraceFilter struct {
+    Entities    []string
+    Processes   []string
+    From        float64
+    To          float64
+}
+
+func (filter *TraceFilter) Match(record *TraceRecord) bool {
+    if record.Date < filter.From || (filter.To > 0 && record.Date > filter.To) {
+        return false
+    }
+    
+    if len(filter.Entities) > 0 && record.Entity != "" && !slices.Contains(filter.Entities, record.Entity) {
+        return false
+    }
+    
+    station := record.Process
+    if station == "" && slices.Contains(StationTraceTypes, record.Type) {
+        station = record.Id
+    }
+    
+    if len(filter.Processes) > 0 && station != "" && !slices.Contains(filter.Processes, station) {
+        return false
+    }
+    
+    return true
+}
+
+// Tracer writes the records of a run as JSON lines.
+type Tracer struct {
+    Filter      TraceFilter
+    Writer      *bufio.Writer
+    Encoder     *json.Encoder
+    Closer      io.Closer
+    Err         error
+}
+
+func NewTracer(w io.Writer) *Tracer {
+    writer := bufio.NewWriter(w)
+    return &Tracer{Writer: writer, Encoder: json.NewEncoder(writer)}
+}
+
+// CreateTraceFile creates a tracer that writes to a file, which is closed
+// by tracer.Close.
+func CreateTraceFile(path string) (*Tracer, error) {
+    file, err := os.Create(path)
+    if err != nil {
+        return nil, err
+    }
+    
+    tracer := NewTracer(file)
+    tracer.Closer = file
+    return tracer, nil
+}
+
+func (tracer *Tracer) Write(record TraceRecord) {
+    if tracer.Err != nil || !tracer.Filter.Match(&record) {
+        return
+    }
+    tracer.Err = tracer.Encoder.Encode(record)
+}
+
+// Close flushes the trace and closes its file, if any. Returns the first
+// error found while writing.
+func (tracer *Tracer) Close() error {
+    if err := tracer.Writer.Flush(); err != nil && tracer.Err == nil {
+        tracer.Err = err
+    }
+    
+    if tracer.Closer != nil {
+        if err := tracer.Closer.Close(); err != nil && tracer.Err == nil {
+            tracer.Err = err
+        }
+    }
+    return tracer.Err
+}
+
+// Trace writes a record at the current time if the environment has a
+// tracer. Callers check env.Tracer first so that building records costs
+// nothing when tracing is off.
+func (env *Environment) Trace(record TraceRecord) {
+    if env.Tracer == nil {
+        return
+    }
+    record.Date = env.Now
+    env.Tracer.Write(record)
+}
+
+func (env *Environment) TraceResource(rid string) {
+    base := env.Resources[rid].GetResourceBase()
+    env.Trace(TraceRecord{Type: TraceType_Resource, Resource: rid, Amount: base.Amount, Capacity: base.Capacity})
+}
+
+// ReadTrace reads the records of a trace that match the filter.
+func ReadTrace(r io.Reader, filter TraceFilter) ([]TraceRecord, error) {
+    records := make([]TraceRecord, 0)
+    decoder := json.NewDecoder(bufio.NewReader(r))
+    
+    for {
+        record := TraceRecord{}
+        if err := decoder.Decode(&record); err == io.EOF {
+            break
+        } else if err != nil {
+            return records, err
+        }
+        
+        if filter.Match(&record) {
+            records = append(records, record)
+        }
+    }
+    
+    return records, nil
+}
+
+func ReadTraceFile(path string, filter TraceFilter) ([]TraceRecord, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    return ReadTrace(file, filter)
+}
+
+// TraceEntity is the state of an entity in a replay. Location is the
+// process, hold, conveyor or transporter where it is, and Status the type
+// of its last record, like Create, Enqueue, Start, Hold or Board.
+type TraceEntity struct {
+    Name        string
+    Location    string
+    Status      string
+    Since       float64
+}
+
+type TraceResource struct {
+    Amount      float64
+    Capacity    float64
+}
+
+// TraceState is the state of a model at Date, rebuilt from its trace.
+type TraceState struct {
+    Date        float64
+    Entities    map[string]*TraceEntity
+    Queues      map[string]int
+    Active      map[string]int // entities in process, on belts or riding vehicles
+    Resources   map[string]TraceResource
+}
+
+func NewTraceState() *TraceState {
+    return &TraceState{
+        Entities: make(map[string]*TraceEntity),
+        Queues: make(map[string]int),
+        Active: make(map[string]int),
+        Resources: make(map[string]TraceResource),
+    }
+}
+
+// IsActiveTraceType tells whether entities are being processed or moved
+// after records of the type, rather than waiting.
+func IsActiveTraceType(recordType string) bool {
+    return recordType == TraceType_Start || recordType == TraceType_Board || recordType == TraceType_Transport
+}
+
+func (state *TraceState) Apply(record *TraceRecord) {
+    state.Date = record.Date
+    
+    if record.Type == TraceType_Resource {
+        state.Resources[record.Resource] = TraceResource{Amount: record.Amount, Capacity: record.Capacity}
+        return
+    }
+    
+    if record.Type == TraceType_Event || record.Entity == "" {
+        return
+    }
+    
+    entity, ok := state.Entities[record.Entity]
+    if !ok {
+        entity = &TraceEntity{Name: record.Entity}
+        state.Entities[record.Entity] = entity
+    }
+    
+    if IsActiveTraceType(entity.Status) {
+        state.Active[entity.Location]--
+    }
+    
+    entity.Status = record.Type
+    entity.Since = record.Date
+    
+    if record.Type == TraceType_Enqueue || record.Type == TraceType_Start || record.Type == TraceType_End {
+        entity.Location = record.Process
+        state.Queues[record.Process] = record.Queue
+    } else if slices.Contains(StationTraceTypes, record.Type) {
+        entity.Location = record.Id
+        state.Queues[record.Id] = record.Queue
+    }
+    
+    if IsActiveTraceType(record.Type) {
+        state.Active[entity.Location]++
+    } else if record.Type == TraceType_Dispose {
+        delete(state.Entities, record.Entity)
+    }
+}
+
+// TraceReplay rebuilds the state of a model at any time from its trace.
+type TraceReplay struct {
+    Records     []TraceRecord
+    Next        int
+    State       *TraceState
+}
+
+func NewTraceReplay(records []TraceRecord) *TraceReplay {
+    return &TraceReplay{Records: records, State: NewTraceState()}
+}
+
+// SeekTo applies every record up to date, starting over if date is before
+// the current state, and returns the state.
+func (replay *TraceReplay) SeekTo(date float64) *TraceState {
+    if date < replay.State.Date {
+        replay.State = NewTraceState()
+        replay.Next = 0
+    }
+    
+    end := sort.Search(len(replay.Records), func(i int) bool { return replay.Records[i].Date > date })
+    for ; replay.Next < end; replay.Next++ {
+        replay.State.Apply(&replay.Records[replay.Next])
+    }
+    
+    replay.State.Date = date
+    return replay.State
+}
+
+// Step applies the next record and returns it, or nil at the end.
+func (replay *TraceReplay) Step() *TraceRecord {
+    if replay.Next >= len(replay.Records) {
+        return nil
+    }
+    
+    record := &replay.Records[replay.Next]
+    replay.State.Apply(record)
+    replay.Next++
+    return record
+}
@@ -0,0 +1,116 @@
+package sim
+
+import (
+    "bytes"
+    "testing"
+)
+
+// BuildYard sends boxes along a belt to a dock, where a truck picks them up
+// one at a time, loads them and takes them to the yard.
+func BuildYard(env *Environment, boxes int) {
+    env.AddEntitySource(NewTestSource("Belt", boxes))
+    env.AddConveyor(ConveyorBase{Id: "Belt", Length: 4, Speed: 1, CellSize: 1, Forward: func (entity Entity) {
+        env.RequestTransporter(entity, "Truck", "Dock", "Load")
+    }})
+    env.AddTransporter(TransporterBase{Id: "Truck", Home: "Yard", Speed: 1, NumVehicles: 2, Distances: map[string]map[string]float64{
+        "Yard": {"Dock": 10},
+    }})
+    env.AddProcess(ProcessBase{Id: "Load", RNG: &RNGConstant{Value: 2}, Forward: func (entity Entity) {
+        env.TransportTo(entity, "Yard", "Unload")
+    }})
+    env.AddProcess(ProcessBase{Id: "Unload", RNG: &RNGConstant{Value: 1}, Forward: func (entity Entity) {
+        env.FreeTransporter(entity)
+        env.Dispose(entity)
+    }})
+}
+
+type YardState struct {
+    Date            float64
+    BeltQueue       int
+    BeltItems       int
+    TruckQueue      int
+    TrucksLoaded    int
+}
+
+func TestTraceReplay(t *testing.T) {
+    var buf bytes.Buffer
+    env := NewEnvironment()
+    env.EndDate = 200
+    env.Tracer = NewTracer(&buf)
+    BuildYard(env, 5)
+    
+    belt := env.GetConveyor("Belt")
+    truck := env.GetTransporter("Truck")
+    
+    states := make([]YardState, 0)
+    // Advance handles the events at Now and moves the clock to the next
+    // event, so the state it leaves is the state at the previous Now
+    env.Begin()
+    for date := env.Now; env.Advance(); date = env.Now {
+        loaded := 0
+        for _, vehicle := range truck.Vehicles {
+            if vehicle.Status == VehicleStatus_MovingLoaded {
+                loaded++
+            }
+        }
+        states = append(states, YardState{Date: date, BeltQueue: len(belt.Queue), BeltItems: len(belt.Items), TruckQueue: len(truck.Queue), TrucksLoaded: loaded})
+    }
+    
+    if err := env.Tracer.Close(); err != nil {
+        t.Fatal(err)
+    }
+    records, err := ReadTrace(&buf, TraceFilter{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    types := make(map[string]int)
+    for _, record := range records {
+        types[record.Type]++
+    }
+    for _, recordType := range []string{TraceType_Convey, TraceType_Board, TraceType_Exit, TraceType_Request, TraceType_Allocate, TraceType_Transport} {
+        if types[recordType] != 5 {
+            t.Errorf("%s records: got %d, want 5", recordType, types[recordType])
+        }
+    }
+    
+    replay := NewTraceReplay(records)
+    for _, want := range states {
+        state := replay.SeekTo(want.Date)
+        got := YardState{Date: want.Date, BeltQueue: state.Queues["Belt"], BeltItems: state.Active["Belt"], TruckQueue: state.Queues["Truck"], TrucksLoaded: state.Active["Truck"]}
+        if got != want {
+            t.Errorf("got %+v, want %+v", got, want)
+        }
+    }
+    
+    // entities are only at the belt, the truck or the processes
+    for _, entity := range replay.SeekTo(20).Entities {
+        if entity.Location != "Belt" && entity.Location != "Truck" && entity.Location != "Load" && entity.Location != "Unload" {
+            t.Errorf("%s is at %q", entity.Name, entity.Location)
+        }
+    }
+}
+
+func TestTraceFilterStations(t *testing.T) {
+    var buf bytes.Buffer
+    env := NewEnvironment()
+    env.EndDate = 200
+    env.Tracer = NewTracer(&buf)
+    env.Tracer.Filter = TraceFilter{Processes: []string{"Truck"}}
+    BuildYard(env, 3)
+    env.Run()
+    
+    if err := env.Tracer.Close(); err != nil {
+        t.Fatal(err)
+    }
+    records, err := ReadTrace(&buf, TraceFilter{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    for _, record := range records {
+        if record.Process != "" || (record.Id != "" && record.Id != "Truck" && record.Type != TraceType_Event) {
+            t.Errorf("record of another station: %+v", record)
+        }
+    }
+}
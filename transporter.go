@@ -0,0 +1,447 @@
+package sim
+
+import (
+    "fmt"
+    "log"
+    "math"
+    "slices"
+)
+
+const (
+    EventType_TransporterArrival string = "TransporterArrival"
+)
+
+type VehicleStatus int
+
+const (
+    VehicleStatus_Idle VehicleStatus = iota
+    VehicleStatus_MovingEmpty
+    VehicleStatus_Allocated
+    VehicleStatus_MovingLoaded
+)
+
+// VehicleLoad is an entity allocated to a vehicle. Then is where it is
+// forwarded when the vehicle arrives, and Destination, once set by
+// env.TransportTo, where it is ready to go.
+type VehicleLoad struct {
+    EntityId    int
+    Then        string
+    Destination string
+}
+
+// Vehicle is a single unit of a transporter fleet, which carries up to
+// Capacity entities. While moving, Location is where it departed from and
+// Destination where it is going.
+type Vehicle struct {
+    Index       int
+    Home        string
+    Capacity    int
+    Location    string
+    Destination string
+    Status      VehicleStatus
+    Loads       []VehicleLoad
+    DateDepart  float64
+    DateArrival float64
+    
+    // Statistics
+    BusySince       float64
+    BusyTime        float64
+    EmptyDistance   float64
+    LoadedDistance  float64
+    Trips           int
+    ResetDate       float64 // statistics start
+}
+
+type TransportRequest struct {
+    Entity      Entity
+    Location    string
+    Then        string
+}
+
+// TransporterBase is a finite fleet of vehicles that carry entities between
+// locations. An entity requests a vehicle (env.RequestTransporter), waits
+// for it to travel empty to its location, rides it to a destination
+// (env.TransportTo) and frees it (env.FreeTransporter). Freed vehicles stay
+// where they are until requested again; they all start at Home.
+//
+// Each vehicle carries up to Capacity entities at a time, 1 if not set.
+// Requests join a vehicle with room left that is at their location, or on
+// its way there, and the vehicle leaves once all the entities on board are
+// ready to go to the same destination. Travel time is the distance between
+// locations divided by Speed. Distances are taken from Distance, if set, or
+// else from the symmetric Distances table.
+type TransporterBase struct {
+    Id          string
+    Home        string
+    Speed       float64
+    Capacity    int
+    NumVehicles int
+    Distance    func (from string, to string) float64
+    Distances   map[string]map[string]float64
+    Vehicles    []*Vehicle
+    Queue       []TransportRequest
+    Env         *Environment
+    
+    QueueStats  QueueStatistics
+}
+
+func (transporter *TransporterBase) GetId() string {
+    return transporter.Id
+}
+
+func (transporter *TransporterBase) GetDistance(from string, to string) float64 {
+    if from == to {
+        return 0
+    }
+    
+    if transporter.Distance != nil {
+        return transporter.Distance(from, to)
+    }
+    
+    if d, ok := transporter.Distances[from][to]; ok {
+        return d
+    }
+    
+    if d, ok := transporter.Distances[to][from]; ok {
+        return d
+    }
+    
+    log.Fatalf("Distance not found: %s | %s -> %s", transporter.Id, from, to)
+    return 0
+}
+
+func (vehicle *Vehicle) GetLoadIndex(entityId int) int {
+    return slices.IndexFunc(vehicle.Loads, func (load VehicleLoad) bool { return load.EntityId == entityId })
+}
+
+func (transporter *TransporterBase) GetVehicle(entity Entity) *Vehicle {
+    for _, vehicle := range transporter.Vehicles {
+        if vehicle.Status != VehicleStatus_Idle && vehicle.GetLoadIndex(entity.GetId()) >= 0 {
+            return vehicle
+        }
+    }
+    return nil
+}
+
+func (transporter *TransporterBase) GetNumIdle() int {
+    n := 0
+    for _, vehicle := range transporter.Vehicles {
+        if vehicle.Status == VehicleStatus_Idle {
+            n++
+        }
+    }
+    return n
+}
+
+// GetVehicleWithRoom returns a vehicle with room left that is at location,
+// or on its way there to pick up entities, or nil if there is none.
+func (transporter *TransporterBase) GetVehicleWithRoom(location string) *Vehicle {
+    for _, vehicle := range transporter.Vehicles {
+        if (vehicle.Status == VehicleStatus_MovingEmpty || vehicle.Status == VehicleStatus_Allocated) && vehicle.Destination == location && len(vehicle.Loads) < vehicle.Capacity {
+            return vehicle
+        }
+    }
+    return nil
+}
+
+func (transporter *TransporterBase) GetClosestIdle(location string) *Vehicle {
+    var closest *Vehicle
+    closestDistance := math.Inf(1)
+    
+    for _, vehicle := range transporter.Vehicles {
+        if vehicle.Status != VehicleStatus_Idle {
+            continue
+        }
+        
+        d := transporter.GetDistance(vehicle.Location, location)
+        if d < closestDistance {
+            closest = vehicle
+            closestDistance = d
+        }
+    }
+    return closest
+}
+
+// Dispatch allocates vehicles to pending requests, first come first
+// served. A request joins a vehicle with room left at its location, or on
+// its way there; otherwise the closest idle vehicle is sent to it.
+// Entities that join a vehicle already at their location board it at once.
+func (transporter *TransporterBase) Dispatch() {
+    env := transporter.Env
+    boarding := make([]TransportRequest, 0)
+    blocked := false
+    
+    for i := 0; i < len(transporter.Queue); {
+        request := transporter.Queue[i]
+        
+        vehicle := transporter.GetVehicleWithRoom(request.Location)
+        if vehicle == nil && !blocked {
+            vehicle = transporter.GetClosestIdle(request.Location)
+        }
+        
+        if vehicle == nil {
+            // later requests don't take idle vehicles before this one
+            blocked = true
+            i++
+            continue
+        }
+        
+        transporter.Queue = slices.Delete(transporter.Queue, i, i+1)
+        vehicle.Loads = append(vehicle.Loads, VehicleLoad{EntityId: request.Entity.GetId(), Then: request.Then})
+        
+        if vehicle.Status == VehicleStatus_Idle {
+            d := transporter.GetDistance(vehicle.Location, request.Location)
+            vehicle.Status = VehicleStatus_MovingEmpty
+            vehicle.BusySince = env.Now
+            vehicle.EmptyDistance += d
+            transporter.Move(vehicle, request.Location, request.Entity)
+        } else if vehicle.Status == VehicleStatus_Allocated {
+            boarding = append(boarding, request)
+        }
+        
+        env.Debug(LogComponent_Transporter, "TRANSPORTER ALLOCATED", "transporter", transporter.Id, "vehicle", vehicle.Index, "entity", request.Entity)
+        
+        if env.Tracer != nil {
+            env.Trace(TraceRecord{Type: TraceType_Allocate, Entity: request.Entity.GetName(), Id: transporter.Id, Queue: len(transporter.Queue)})
+        }
+    }
+    
+    for _, request := range boarding {
+        transporter.Board(request.Entity, request.Then)
+    }
+}
+
+// Board takes the entity out of the transporter queue, once its vehicle is
+// at its location, and forwards it to then.
+func (transporter *TransporterBase) Board(entity Entity, then string) {
+    env := transporter.Env
+    entity.LeaveQueue(QueueType_Transporter, transporter.Id, env.Now)
+    st := entity.GetEntityBase().GetQueueStats(QueueType_Transporter, transporter.Id)
+    transporter.QueueStats.RecordOut(env.Now, len(transporter.Queue), st.DateOut - st.DateIn)
+    
+    if then != "" {
+        env.ForwardTo(entity, then)
+    }
+}
+
+// MaybeDepart sends the vehicle to the destination of its loads once all of
+// them are ready to go (env.TransportTo).
+func (transporter *TransporterBase) MaybeDepart(vehicle *Vehicle) {
+    env := transporter.Env
+    if len(vehicle.Loads) == 0 {
+        return
+    }
+    
+    destination := vehicle.Loads[0].Destination
+    for _, load := range vehicle.Loads {
+        if load.Destination == "" {
+            return
+        }
+        if load.Destination != destination {
+            log.Fatalf("Vehicle loads have different destinations: %s | %s, %s", transporter.Id, destination, load.Destination)
+        }
+    }
+    
+    vehicle.Status = VehicleStatus_MovingLoaded
+    vehicle.LoadedDistance += transporter.GetDistance(vehicle.Location, destination)
+    vehicle.Trips++
+    transporter.Move(vehicle, destination, env.Entities[vehicle.Loads[0].EntityId])
+    
+    for _, load := range vehicle.Loads {
+        entity := env.Entities[load.EntityId]
+        env.Debug(LogComponent_Transporter, "TRANSPORT STARTED", "transporter", transporter.Id, "vehicle", vehicle.Index, "entity", entity, "from", vehicle.Location, "to", destination)
+        
+        if env.Tracer != nil {
+            env.Trace(TraceRecord{Type: TraceType_Transport, Entity: entity.GetName(), Id: transporter.Id, Queue: len(transporter.Queue)})
+        }
+    }
+}
+
+func (transporter *TransporterBase) Move(vehicle *Vehicle, destination string, entity Entity) {
+    env := transporter.Env
+    vehicle.Destination = destination
+    vehicle.DateDepart = env.Now
+    vehicle.DateArrival = env.Now + transporter.GetDistance(vehicle.Location, destination) / transporter.Speed
+    env.Schedule(Event{Date: vehicle.DateArrival, Type: EventType_TransporterArrival, Id: transporter.Id, Entity: entity})
+}
+
+func (env *Environment) AddTransporter(base TransporterBase) {
+    if base.Speed <= 0 {
+        log.Fatalf("Invalid transporter speed: %s | %g", base.Id, base.Speed)
+    }
+    
+    base.NumVehicles = max(1, base.NumVehicles)
+    base.Capacity = max(1, base.Capacity)
+    base.Env = env
+    base.Queue = make([]TransportRequest, 0)
+    base.Vehicles = make([]*Vehicle, base.NumVehicles)
+    
+    for i := 0; i < base.NumVehicles; i++ {
+        base.Vehicles[i] = &Vehicle{Index: i, Home: base.Home, Capacity: base.Capacity, Location: base.Home, Destination: base.Home}
+    }
+    
+    env.Transporters = append(env.Transporters, &base)
+    env.AddEventHandler(EventType_TransporterArrival, env.HandleTransporterArrival)
+}
+
+func (env *Environment) GetTransporter(tid string) *TransporterBase {
+    for _, transporter := range env.Transporters {
+        if transporter.Id == tid {
+            return transporter
+        }
+    }
+    return nil
+}
+
+// RequestTransporter queues the entity for a vehicle of transporter tid
+// that picks it up at location. When the vehicle arrives, the entity is
+// forwarded to then.
+func (env *Environment) RequestTransporter(entity Entity, tid string, location string, then string) {
+    transporter := env.GetTransporter(tid)
+    if transporter == nil {
+        log.Fatalf("Transporter not found: %s", tid)
+    }
+    
+    transporter.Queue = append(transporter.Queue, TransportRequest{Entity: entity, Location: location, Then: then})
+    transporter.QueueStats.RecordIn(env.Now, len(transporter.Queue))
+    entity.EnterQueue(QueueType_Transporter, tid, env.Now)
+    env.Debug(LogComponent_Transporter, "TRANSPORTER REQUESTED", "transporter", tid, "entity", entity)
+    
+    if env.Tracer != nil {
+        env.Trace(TraceRecord{Type: TraceType_Request, Entity: entity.GetName(), Id: tid, Queue: len(transporter.Queue)})
+    }
+    
+    if env.Debugger != nil {
+        env.Debugger.OnEnter(entity, tid, len(transporter.Queue))
+    }
+    
+    transporter.Dispatch()
+}
+
+// TransportTo moves the entity on its allocated vehicle to destination and
+// forwards it to then on arrival. The vehicle waits until all the entities
+// on board are ready to go.
+func (env *Environment) TransportTo(entity Entity, destination string, then string) {
+    transporter, vehicle := env.GetEntityVehicle(entity)
+    if vehicle == nil || vehicle.Status != VehicleStatus_Allocated {
+        log.Fatalf("Entity has no transporter available: %s", entity.GetName())
+    }
+    
+    load := &vehicle.Loads[vehicle.GetLoadIndex(entity.GetId())]
+    load.Destination = destination
+    load.Then = then
+    transporter.MaybeDepart(vehicle)
+}
+
+// FreeTransporter takes the entity off its vehicle, which is released when
+// it has no entities left.
+func (env *Environment) FreeTransporter(entity Entity) {
+    transporter, vehicle := env.GetEntityVehicle(entity)
+    if vehicle == nil || vehicle.Status != VehicleStatus_Allocated {
+        log.Fatalf("Entity has no transporter to free: %s", entity.GetName())
+    }
+    
+    i := vehicle.GetLoadIndex(entity.GetId())
+    vehicle.Loads = slices.Delete(vehicle.Loads, i, i+1)
+    if len(vehicle.Loads) == 0 {
+        vehicle.Status = VehicleStatus_Idle
+        vehicle.BusyTime += env.Now - vehicle.BusySince
+    } else {
+        transporter.MaybeDepart(vehicle)
+    }
+    
+    env.Debug(LogComponent_Transporter, "TRANSPORTER FREED", "transporter", transporter.Id, "vehicle", vehicle.Index, "entity", entity)
+    
+    transporter.Dispatch()
+}
+
+func (env *Environment) GetEntityVehicle(entity Entity) (*TransporterBase, *Vehicle) {
+    for _, transporter := range env.Transporters {
+        if vehicle := transporter.GetVehicle(entity); vehicle != nil {
+            return transporter, vehicle
+        }
+    }
+    return nil, nil
+}
+
+func (env *Environment) HandleTransporterArrival(event Event) {
+    transporter := env.GetTransporter(event.Id)
+    vehicle := transporter.GetVehicle(event.Entity)
+    loaded := vehicle.Status == VehicleStatus_MovingLoaded
+    
+    vehicle.Location = vehicle.Destination
+    vehicle.Status = VehicleStatus_Allocated
+    env.Debug(LogComponent_Transporter, "TRANSPORTER ARRIVED", "transporter", transporter.Id, "vehicle", vehicle.Index, "loads", len(vehicle.Loads), "location", vehicle.Location)
+    
+    // forwarded entities may free the vehicle or join it
+    loads := slices.Clone(vehicle.Loads)
+    for i := range vehicle.Loads {
+        vehicle.Loads[i].Destination = ""
+    }
+    
+    for _, load := range loads {
+        entity := env.Entities[load.EntityId]
+        if loaded {
+            env.AddEntityTime(entity.GetEntityBase(), Allocation_Transfer, env.Now - vehicle.DateDepart)
+            if load.Then != "" {
+                env.ForwardTo(entity, load.Then)
+            }
+        } else {
+            transporter.Board(entity, load.Then)
+        }
+    }
+}
+
+// GetUtilization returns the fraction of time the vehicle was allocated to
+// an entity.
+func (vehicle *Vehicle) GetUtilization(now float64) float64 {
+    busy := vehicle.BusyTime
+    if vehicle.Status != VehicleStatus_Idle {
+        busy += now - vehicle.BusySince
+    }
+    
+    if now <= vehicle.ResetDate {
+        return 0
+    }
+    return busy / (now - vehicle.ResetDate)
+}
+
+// Reset clears the statistics of the vehicle as if it had started at date.
+func (vehicle *Vehicle) Reset(date float64) {
+    if vehicle.Status != VehicleStatus_Idle {
+        vehicle.BusySince = date
+    }
+    vehicle.BusyTime = 0
+    vehicle.EmptyDistance = 0
+    vehicle.LoadedDistance = 0
+    vehicle.Trips = 0
+    vehicle.ResetDate = date
+}
+
+func (env *Environment) PrintTransportersStatistics(tids ...string) {
+    fmt.Printf("[TRANSPORTER STATISTICS]\n")
+    
+    fmt.Printf("%24s%10s%14s%16s%16s%10s%16s\n", "Transporter", "Vehicle", "Utilization", "Empty Distance", "Loaded Distance", "Trips", "Avg Q Time (s)")
+    
+    for _, transporter := range env.Transporters {
+        if len(tids) > 0 && !slices.Contains(tids, transporter.Id) {
+            continue
+        }
+        
+        utilization := 0.0
+        emptyDistance := 0.0
+        loadedDistance := 0.0
+        trips := 0
+        
+        for _, vehicle := range transporter.Vehicles {
+            fmt.Printf("%24.24s%10d%13.2f%%%16.2f%16.2f%10d%16s\n", transporter.Id, vehicle.Index, vehicle.GetUtilization(env.Now)*100, vehicle.EmptyDistance, vehicle.LoadedDistance, vehicle.Trips, "")
+            utilization += vehicle.GetUtilization(env.Now)
+            emptyDistance += vehicle.EmptyDistance
+            loadedDistance += vehicle.LoadedDistance
+            trips += vehicle.Trips
+        }
+        
+        utilization /= float64(len(transporter.Vehicles))
+        fmt.Printf("%24.24s%10s%13.2f%%%16.2f%16.2f%10d%16.2f\n", transporter.Id, "All", utilization*100, emptyDistance, loadedDistance, trips, transporter.QueueStats.AvgTimeInQueue)
+    }
+}
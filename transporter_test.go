@@ -0,0 +1,67 @@
+package sim
+
+import (
+    "testing"
+)
+
+// Six boxes ask at 1 s for a single truck, 10 s away at the yard, which
+// waits 2 s for each load to be loaded and 1 s for it to be unloaded. The
+// truck carries as many boxes as it can on each trip.
+func TestVehicleCapacity(t *testing.T) {
+    tests := []struct {
+        name        string
+        capacity    int
+        trips       int
+        done        float64
+    }{
+        {"default", 0, 6, 139},
+        {"one", 1, 6, 139},
+        {"three", 3, 2, 47},
+        {"four", 4, 2, 47},
+        {"six", 6, 1, 24},
+    }
+    
+    for _, test := range tests {
+        t.Run(test.name, func (t *testing.T) {
+            env := NewEnvironment()
+            env.EndDate = 1000
+            done := 0.0
+            env.AddEntitySource(NewTestSource("Arrive", 6))
+            env.AddProcess(ProcessBase{Id: "Arrive", RNG: &RNGConstant{Value: 1}, Forward: func (entity Entity) {
+                env.RequestTransporter(entity, "Truck", "Dock", "Load")
+            }})
+            env.AddTransporter(TransporterBase{Id: "Truck", Home: "Yard", Speed: 1, Capacity: test.capacity, Distances: map[string]map[string]float64{
+                "Yard": {"Dock": 10},
+            }})
+            env.AddProcess(ProcessBase{Id: "Load", RNG: &RNGConstant{Value: 2}, Forward: func (entity Entity) {
+                env.TransportTo(entity, "Yard", "Unload")
+            }})
+            env.AddProcess(ProcessBase{Id: "Unload", RNG: &RNGConstant{Value: 1}, Forward: func (entity Entity) {
+                env.FreeTransporter(entity)
+                env.Dispose(entity)
+                done = env.Now
+            }})
+            
+            truck := env.GetTransporter("Truck").Vehicles[0]
+            env.Begin()
+            for env.Advance() {
+                if len(truck.Loads) > truck.Capacity {
+                    t.Fatalf("%d boxes on a truck for %d", len(truck.Loads), truck.Capacity)
+                }
+            }
+            
+            if env.GetEntityTypeStatistics("Box").Disposed != 6 {
+                t.Fatalf("got %d boxes unloaded, want 6", env.GetEntityTypeStatistics("Box").Disposed)
+            }
+            if truck.Trips != test.trips || truck.LoadedDistance != float64(10 * test.trips) || truck.EmptyDistance != float64(10 * test.trips) {
+                t.Errorf("got %d trips, %g loaded and %g empty, want %d trips of 10", truck.Trips, truck.LoadedDistance, truck.EmptyDistance, test.trips)
+            }
+            if done != test.done {
+                t.Errorf("last box unloaded at %g, want %g", done, test.done)
+            }
+            if truck.Status != VehicleStatus_Idle || len(truck.Loads) != 0 {
+                t.Errorf("truck still busy with %d boxes", len(truck.Loads))
+            }
+        })
+    }
+}
@@ -0,0 +1,71 @@
+package sim
+
+const (
+    EventType_WarmUp string = "WarmUp"
+)
+
+// The first env.WarmUp seconds of a run are a warm-up period: when it ends,
+// all statistics are reset, so that results describe the steady state
+// rather than the empty system the model starts in.
+
+func (env *Environment) HandleWarmUp(event Event) {
+    env.ResetStatistics()
+    env.Info(LogComponent_Run, "WARM-UP ENDED", "time", env.GetHumanTime(env.Now))
+}
+
+// ResetStatistics clears the statistics of processes, resources, holds,
+// transporters, conveyors, counters, tallies, entity types and flows,
+// costs included, as if they had started now. The state of the model, like
+// queues and busy resources, is kept.
+func (env *Environment) ResetStatistics() {
+    env.StatisticsStart = env.Now
+    
+    for _, process := range env.Processes {
+        base := process.GetProcessBase()
+        base.QueueStats.Reset(env.Now)
+        base.AvgDuration = 0
+        base.AccumDuration = 0
+        base.TotalEntitiesOut = 0
+        base.Durations.Reset()
+        base.TypeStats = nil
+    }
+    
+    for _, resource := range env.Resources {
+        base := resource.GetResourceBase()
+        base.Busy.Reset(env.Now)
+        base.TotalEntitiesIn = 0
+        base.TotalEntitiesOut = 0
+        base.TotalTimeInQueue = 0
+        base.AvgTimeInQueue = 0
+        base.Uses = 0
+    }
+    
+    for _, hold := range env.Holds {
+        hold.QueueStats.Reset(env.Now)
+    }
+    
+    for _, transporter := range env.Transporters {
+        transporter.QueueStats.Reset(env.Now)
+        for _, vehicle := range transporter.Vehicles {
+            vehicle.Reset(env.Now)
+        }
+    }
+    
+    for _, conveyor := range env.Conveyors {
+        conveyor.Reset()
+    }
+    
+    for _, counter := range env.Counters {
+        counter.Reset()
+    }
+    
+    for _, tally := range env.Tallies {
+        tally.Reset()
+    }
+    
+    for _, st := range env.EntityTypes {
+        st.Reset(env.Now)
+    }
+    
+    env.Flows = make(map[string]map[string]int)
+}